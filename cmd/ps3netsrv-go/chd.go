@@ -162,7 +162,92 @@ func (c *chdDecompressCmd) Run(k *kong.Kong) error {
 	return nil
 }
 
+type chdVerifyCmd struct {
+	Image *os.File `arg:"" help:"Path to CHD image to verify."`
+}
+
+func (c *chdVerifyCmd) Run(k *kong.Kong) error {
+	slogHandler := slog.NewTextHandler(k.Stderr, &slog.HandlerOptions{
+		Level: slog.LevelError,
+	})
+
+	log := slog.New(slogHandler)
+
+	lib, err := chd.NewLibCHDR(log)
+	if err != nil {
+		return err
+	}
+
+	f, err := lib.NewFile(c.Image)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	p := mpb.New(mpb.WithOutput(k.Stderr), mpb.WithRefreshRate(180*time.Millisecond))
+	bar := p.New(int64(f.Header.LogicalBytes), mpb.BarStyle().Rbound("|"),
+		mpb.PrependDecorators(
+			decor.Counters(decor.SizeB1024(0), "% .2f / % .2f"),
+		),
+		mpb.AppendDecorators(
+			decor.EwmaETA(decor.ET_STYLE_GO, 30),
+			decor.Name(" ] "),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 30),
+		),
+	)
+
+	start := time.Now()
+	res, err := f.Verify(func(n int) {
+		bar.EwmaIncrBy(n, time.Since(start))
+		start = time.Now()
+	})
+	if err != nil {
+		bar.Abort(false)
+		p.Wait()
+		return err
+	}
+	p.Wait()
+
+	tw := tabwriter.NewWriter(k.Stdout, 10, 0, 2, ' ', 0)
+	for _, he := range res.HunkErrors {
+		if _, err := fmt.Fprintf(tw, "Hunk %d:\tdecompression failed: %v\n", he.Hunk, he.Err); err != nil {
+			return err
+		}
+	}
+
+	checks := res.Checks(f.Header)
+	failed := len(res.HunkErrors)
+	for _, check := range checks {
+		status := "OK"
+		if !check.OK() {
+			status = "MISMATCH"
+			failed++
+		}
+
+		_, err := fmt.Fprintf(tw, "%s:\t%s\texpected %s, computed %s\n",
+			check.Name, status, hex.EncodeToString(check.Expected), hex.EncodeToString(check.Actual))
+		if err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	switch {
+	case failed > 0:
+		return fmt.Errorf("verification failed: %d hunk error(s), %d checksum mismatch(es)",
+			len(res.HunkErrors), failed-len(res.HunkErrors))
+	case len(checks) == 0:
+		_, err = fmt.Fprintln(k.Stdout, "No checksums in header, all hunks decompressed successfully")
+	default:
+		_, err = fmt.Fprintln(k.Stdout, "Image is valid")
+	}
+	return err
+}
+
 type chdApp struct {
 	CHDInfo       chdInfoCmd       `cmd:"" name:"info" help:"Inspect a CHD image and display information."`
 	CHDDecompress chdDecompressCmd `cmd:"" name:"decompress" help:"Decompress CHD image."`
+	CHDVerify     chdVerifyCmd     `cmd:"" name:"verify" help:"Verify CHD image integrity: decompress all hunks and check checksums stored in header."`
 }
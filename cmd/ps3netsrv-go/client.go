@@ -17,6 +17,7 @@ import (
 	"github.com/vbauerster/mpb/v8/decor"
 
 	"github.com/xakep666/ps3netsrv-go/internal/ioutil"
+	"github.com/xakep666/ps3netsrv-go/internal/tlsutil"
 	"github.com/xakep666/ps3netsrv-go/pkg/client"
 )
 
@@ -441,6 +442,8 @@ type clientApp struct {
 	Address    string `help:"Target server address" required:""`
 	BufferSize int64  `help:"Size of buffer for data transfer. Change it only if you know what you doing." type:"binsize" default:"64k"`
 
+	TLS clientTLSOptions `embed:""`
+
 	StatCmd       clientStatCmd       `cmd:"" name:"stat" help:"Display single file/dir info"`
 	ReadDirCmd    clientReadDirCmd    `cmd:"" name:"readdir" help:"Read directory entries"`
 	DirSizeCmd    clientDirSizeCmd    `cmd:"" name:"dirsize" help:"Get directory size"`
@@ -460,5 +463,33 @@ func (c *clientApp) ProvideClient(ctx context.Context) (*client.Client, error) {
 		cop = ioutil.NewCopier()
 	}
 
-	return client.NewClient(ctx, cop, c.Address)
+	opts, err := c.TLS.clientOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.NewClient(ctx, cop, c.Address, opts...)
+}
+
+type clientTLSOptions struct {
+	Enable             bool   `help:"Connect using TLS." name:"tls"`
+	CA                 string `help:"CA certificates file (PEM) to verify server certificate. System roots are used if not provided." name:"tls-ca"`
+	Cert               string `help:"Client certificate file (PEM) for mutual TLS." name:"tls-cert"`
+	Key                string `help:"Client private key file (PEM) for mutual TLS." name:"tls-key"`
+	ServerName         string `help:"Server name to verify certificate against. Host from address is used if not provided." name:"tls-server-name"`
+	InsecureSkipVerify bool   `help:"Don't verify server certificate. Insecure, use for testing only." name:"tls-insecure-skip-verify"`
+}
+
+// clientOptions returns client options for TLS connection. TLS is enabled implicitly if any of files provided.
+func (o *clientTLSOptions) clientOptions() ([]client.Option, error) {
+	if !o.Enable && o.CA == "" && o.Cert == "" {
+		return nil, nil
+	}
+
+	config, err := tlsutil.ClientConfig(o.CA, o.Cert, o.Key, o.ServerName, o.InsecureSkipVerify)
+	if err != nil {
+		return nil, fmt.Errorf("tls config: %w", err)
+	}
+
+	return []client.Option{client.WithTLS(config)}, nil
 }
@@ -15,8 +15,9 @@ import (
 )
 
 type decrypt3k3yCmd struct {
-	Image  *os.File `arg:"" help:"Path to 3k3y image to decrypt."`
-	Output *os.File `arg:"" help:"Path to output image." type:"outputfile"`
+	Image       *os.File `arg:"" help:"Path to 3k3y image to decrypt."`
+	Output      *os.File `arg:"" help:"Path to output image." type:"outputfile"`
+	KeepRegions bool     `help:"Keep unencrypted regions map in the first sector. Required to encrypt image back."`
 }
 
 func (c *decrypt3k3yCmd) Run(k *kong.Kong) error {
@@ -28,7 +29,7 @@ func (c *decrypt3k3yCmd) Run(k *kong.Kong) error {
 		return fmt.Errorf("image is not encrypted")
 	}
 
-	imageWrapped, err := encryptediso.NewEncryptedISO(c.Image, key, true)
+	imageWrapped, err := encryptediso.NewEncryptedISO(c.Image, key, !c.KeepRegions)
 	if err != nil {
 		return err
 	}
@@ -62,9 +63,10 @@ func (c *decrypt3k3yCmd) Run(k *kong.Kong) error {
 }
 
 type decryptRedumpCmd struct {
-	Image  *os.File `arg:"" help:"Path to redump image to decrypt."`
-	Key    *os.File `arg:"" help:"Path to key"`
-	Output *os.File `arg:"" help:"Path to output image." type:"outputfile"`
+	Image       *os.File `arg:"" help:"Path to redump image to decrypt."`
+	Key         *os.File `arg:"" help:"Path to key"`
+	Output      *os.File `arg:"" help:"Path to output image." type:"outputfile"`
+	KeepRegions bool     `help:"Keep unencrypted regions map in the first sector. Required to encrypt image back."`
 }
 
 func (c *decryptRedumpCmd) Run(k *kong.Kong) error {
@@ -73,7 +75,7 @@ func (c *decryptRedumpCmd) Run(k *kong.Kong) error {
 		return fmt.Errorf("key read failed: %w", err)
 	}
 
-	imageWrapped, err := encryptediso.NewEncryptedISO(c.Image, key, true)
+	imageWrapped, err := encryptediso.NewEncryptedISO(c.Image, key, !c.KeepRegions)
 	if err != nil {
 		return err
 	}
@@ -110,3 +112,48 @@ type decryptApp struct {
 	Decrypt3k3y   decrypt3k3yCmd   `cmd:"" name:"3k3y" help:"Decrypt 3k3y image."`
 	DecryptRedump decryptRedumpCmd `cmd:"" name:"redump" help:"Decrypt Redump image."`
 }
+
+type encryptApp struct {
+	Image  *os.File `arg:"" help:"Path to decrypted image with preserved unencrypted regions map."`
+	Output *os.File `arg:"" help:"Path to output image." type:"outputfile"`
+	DKey   *os.File `name:"dkey" required:"" help:"Path to disc key (.dkey) file."`
+}
+
+func (c *encryptApp) Run(k *kong.Kong) error {
+	key, err := encryptediso.ReadKeyFile(c.DKey)
+	if err != nil {
+		return fmt.Errorf("key read failed: %w", err)
+	}
+
+	imageWrapped, err := encryptediso.NewDecryptedISO(c.Image, key)
+	if err != nil {
+		return err
+	}
+
+	fi, err := imageWrapped.Stat()
+	if err != nil {
+		return err
+	}
+
+	p := mpb.New(mpb.WithOutput(k.Stderr), mpb.WithRefreshRate(180*time.Millisecond))
+
+	bar := p.New(fi.Size(),
+		mpb.BarStyle().Rbound("|"),
+		mpb.PrependDecorators(
+			decor.Counters(decor.SizeB1024(0), "% .2f / % .2f"),
+		),
+		mpb.AppendDecorators(
+			decor.EwmaETA(decor.ET_STYLE_GO, 30),
+			decor.Name(" ] "),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 30),
+		),
+	)
+
+	_, err = io.Copy(c.Output, bar.ProxyReader(imageWrapped))
+	if err != nil {
+		return err
+	}
+	p.Wait()
+
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/iso3k3y"
+)
+
+// Encryption check statuses.
+const (
+	encryptionStatusOK         = "ok"
+	encryptionStatusDecrypted  = "decrypted"
+	encryptionStatusUnverified = "unverified" // key found but image has no known files to check it
+	encryptionStatusMissingKey = "missing-key"
+	encryptionStatusInvalidKey = "invalid-key"
+	encryptionStatusError      = "error"
+)
+
+type encryptionCheckResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type encryptionCheckCmd struct {
+	Root  string   `arg:"" help:"Root directory with games." type:"existingdir"`
+	KeyDB []string `help:"Disc keys database: directory with .dkey files, .zip archive of them or .csv/.json map from image name or title ID to key. May be repeated." name:"key-db"`
+	JSON  bool     `help:"Output results in JSON format." name:"json"`
+}
+
+func (c *encryptionCheckCmd) Run(ctx context.Context, k *kong.Kong) error {
+	keys, err := openKeyDB(c.KeyDB)
+	if err != nil {
+		return err
+	}
+
+	// keys are found the same way as during serving
+	fsys := fs.NewFS(fs.NewRelaxedSystemRoot(c.Root), imageOpeners(), []fs.FileWrapper{iso3k3y.KeyExtractionFileWrapper{}})
+	wrapper := encryptediso.FileWrapper{Keys: keys}
+
+	var results []encryptionCheckResult
+	err = filepath.WalkDir(c.Root, func(p string, d iofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		rel, err := filepath.Rel(c.Root, p)
+		if err != nil {
+			return err
+		}
+
+		if !encryptediso.MayBeEncrypted(rel) {
+			return nil
+		}
+
+		res := encryptionCheckResult{Path: rel}
+		res.Status, err = c.check(ctx, fsys, wrapper, rel)
+		if err != nil {
+			res.Status, res.Error = encryptionStatusError, err.Error()
+		}
+
+		results = append(results, res)
+		return ctx.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.JSON {
+		enc := json.NewEncoder(k.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else if err := c.printResults(k.Stdout, results); err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range results {
+		switch r.Status {
+		case encryptionStatusMissingKey, encryptionStatusInvalidKey, encryptionStatusError:
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images can't be served decrypted", failed, len(results))
+	}
+
+	return nil
+}
+
+func (c *encryptionCheckCmd) check(ctx context.Context, fsys *fs.FS, wrapper encryptediso.FileWrapper, p string) (string, error) {
+	f, err := fsys.Open(ctx, p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	key, err := wrapper.FindKey(ctx, fsys, f)
+	switch {
+	case errors.Is(err, iofs.ErrNotExist):
+		if encryptediso.IsEncrypted(f) {
+			return encryptionStatusMissingKey, nil
+		}
+		return encryptionStatusDecrypted, nil
+	case err != nil:
+		return "", fmt.Errorf("read key: %w", err)
+	}
+
+	encrypted, err := encryptediso.NewEncryptedISO(f, key, false)
+	if err != nil {
+		return "", err
+	}
+
+	err = encrypted.CheckKey()
+	switch {
+	case errors.Is(err, nil):
+		return encryptionStatusOK, nil
+	case errors.Is(err, encryptediso.ErrKeyUnverifiable):
+		return encryptionStatusUnverified, nil
+	case errors.Is(err, encryptediso.ErrInvalidKey):
+		return encryptionStatusInvalidKey, nil
+	default:
+		return "", err
+	}
+}
+
+func (c *encryptionCheckCmd) printResults(w io.Writer, results []encryptionCheckResult) error {
+	counts := make(map[string]int)
+
+	tw := tabwriter.NewWriter(w, 10, 0, 2, ' ', 0)
+	for _, r := range results {
+		counts[r.Status]++
+		if r.Status == encryptionStatusOK || r.Status == encryptionStatusDecrypted {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Status, r.Path, r.Error); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "OK: %d, decrypted: %d, unverified: %d, missing key: %d, invalid key: %d, errors: %d\n",
+		counts[encryptionStatusOK], counts[encryptionStatusDecrypted], counts[encryptionStatusUnverified],
+		counts[encryptionStatusMissingKey], counts[encryptionStatusInvalidKey], counts[encryptionStatusError])
+	return err
+}
+
+type encryptionApp struct {
+	Check encryptionCheckCmd `cmd:"" name:"check" help:"Scan games library for encrypted images without valid disc keys."`
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/chd"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/cso"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/iso3k3y"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/seekablezstd"
+)
+
+// imageOpeners transparently decompress images.
+func imageOpeners() []fs.FileOpener {
+	return []fs.FileOpener{
+		chd.NewOpener(slog.Default()),
+		cso.Opener{},
+		seekablezstd.Opener{},
+	}
+}
+
+// openImage opens image through openers, so compressed images are read in decompressed form.
+// 3k3y images are read in redump form, i.e. without 3k3y data.
+func openImage(ctx context.Context, path string) (handler.File, error) {
+	f, _, err := openImageWithKey(ctx, path)
+	return f, err
+}
+
+// openImageWithKey is like openImage but also returns disc key embedded into encrypted 3k3y image.
+func openImageWithKey(ctx context.Context, path string) (handler.File, []byte, error) {
+	dir, name := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+
+	f, err := fs.NewFS(fs.NewRelaxedSystemRoot(dir), imageOpeners(), nil).Open(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key, err := iso3k3y.Test3k3yImage(f)
+	switch {
+	case errors.Is(err, nil):
+		converted, err := iso3k3y.NewISO3k3y(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, nil, err
+		}
+		return converted, key, nil
+	case errors.Is(err, iso3k3y.ErrNot3k3y):
+		return f, nil, nil
+	default:
+		_ = f.Close()
+		return nil, nil, fmt.Errorf("test 3k3y: %w", err)
+	}
+}
+
+// readSeekerAt implements io.ReaderAt over io.ReadSeeker, it's not safe for concurrent use.
+type readSeekerAt struct {
+	rs io.ReadSeeker
+}
+
+func (r readSeekerAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := r.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, err := io.ReadFull(r.rs, p)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+	return n, err
+}
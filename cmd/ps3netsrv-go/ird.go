@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+	"github.com/xakep666/ps3netsrv-go/pkg/ird"
+)
+
+// IRD verification statuses.
+const (
+	irdStatusOK      = "ok"
+	irdStatusMissing = "missing"
+	irdStatusCorrupt = "corrupt"
+	irdStatusExtra   = "extra"   // file is not present on original disc
+	irdStatusNoHash  = "no-hash" // IRD doesn't contain hash for file, only size checked
+	irdStatusError   = "error"
+)
+
+type irdVerifyResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// irdTarget is a game folder or disc image being verified.
+type irdTarget interface {
+	// files lists regular files with their sizes, paths are slash-separated and relative to disc root.
+	files() (map[string]int64, error)
+	// matches hashes file and compares it with expected one.
+	matches(ctx context.Context, file ird.File, progress io.Writer) (bool, error)
+	// parallel reports whether files can be hashed in parallel.
+	parallel() bool
+	io.Closer
+}
+
+type irdVerifyCmd struct {
+	Target string   `arg:"" help:"Game folder (JB format) or disc image to verify." type:"existingpath"`
+	IRD    *os.File `arg:"" help:"IRD file of the game."`
+	Jobs   int      `help:"Amount of files hashed in parallel (folders only)." short:"j" default:"4"`
+	JSON   bool     `help:"Output results in JSON format." name:"json"`
+}
+
+func (c *irdVerifyCmd) Run(ctx context.Context, k *kong.Kong) error {
+	defer c.IRD.Close()
+
+	disc, err := ird.Parse(c.IRD)
+	if err != nil {
+		return err
+	}
+
+	discFiles, err := disc.Files()
+	if err != nil {
+		return err
+	}
+
+	target, err := c.openTarget(ctx, disc)
+	if err != nil {
+		return err
+	}
+	defer target.Close()
+
+	actualFiles, err := target.files()
+	if err != nil {
+		return err
+	}
+
+	if !c.JSON {
+		fmt.Fprintf(k.Stderr, "Verifying %s against IRD of %s %s (version %s)\n", c.Target, disc.TitleID, disc.Title, disc.GameVersion)
+	}
+
+	var results []irdVerifyResult
+	var toHash []ird.File
+	var totalSize int64
+	for _, df := range discFiles {
+		size, ok := actualFiles[df.Path]
+		delete(actualFiles, df.Path)
+		switch {
+		case !ok:
+			results = append(results, irdVerifyResult{Path: df.Path, Status: irdStatusMissing})
+		case size != df.Size:
+			results = append(results, irdVerifyResult{
+				Path:   df.Path,
+				Status: irdStatusCorrupt,
+				Error:  fmt.Sprintf("size %d differs from original %d", size, df.Size),
+			})
+		case !df.HasMD5:
+			results = append(results, irdVerifyResult{Path: df.Path, Status: irdStatusNoHash})
+		default:
+			toHash = append(toHash, df)
+			totalSize += df.Size
+		}
+	}
+
+	for p := range actualFiles {
+		results = append(results, irdVerifyResult{Path: p, Status: irdStatusExtra})
+	}
+
+	p := mpb.New(mpb.WithOutput(k.Stderr), mpb.WithRefreshRate(180*time.Millisecond))
+	bar := p.New(totalSize,
+		mpb.BarStyle().Rbound("|"),
+		mpb.PrependDecorators(
+			decor.Counters(decor.SizeB1024(0), "% .2f / % .2f"),
+		),
+		mpb.AppendDecorators(
+			decor.EwmaETA(decor.ET_STYLE_GO, 30),
+			decor.Name(" ] "),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 30),
+		),
+	)
+
+	hashResults := make([]irdVerifyResult, len(toHash))
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.SetLimit(1)
+	if target.parallel() {
+		eg.SetLimit(max(c.Jobs, 1))
+	}
+	for i, df := range toHash {
+		eg.Go(func() error {
+			res := irdVerifyResult{Path: df.Path, Status: irdStatusCorrupt}
+
+			ok, err := target.matches(egCtx, df, bar.ProxyWriter(io.Discard))
+			switch {
+			case err != nil:
+				res.Status, res.Error = irdStatusError, err.Error()
+			case ok:
+				res.Status = irdStatusOK
+			default:
+				res.Error = "md5 mismatch"
+			}
+
+			hashResults[i] = res
+			return egCtx.Err()
+		})
+	}
+
+	err = eg.Wait()
+	bar.Abort(false)
+	p.Wait()
+	if err != nil {
+		return err
+	}
+
+	results = append(results, hashResults...)
+	slices.SortFunc(results, func(a, b irdVerifyResult) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	if c.JSON {
+		enc := json.NewEncoder(k.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else if err := c.printResults(k.Stdout, results); err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range results {
+		if r.Status != irdStatusOK && r.Status != irdStatusNoHash {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, len(results))
+	}
+
+	return nil
+}
+
+func (c *irdVerifyCmd) openTarget(ctx context.Context, disc *ird.IRD) (irdTarget, error) {
+	fi, err := os.Stat(c.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return irdFolder(c.Target), nil
+	}
+
+	return newIRDImage(ctx, c.Target, disc.Data1)
+}
+
+func (c *irdVerifyCmd) printResults(w io.Writer, results []irdVerifyResult) error {
+	counts := make(map[string]int)
+
+	tw := tabwriter.NewWriter(w, 10, 0, 2, ' ', 0)
+	for _, r := range results {
+		counts[r.Status]++
+		if r.Status == irdStatusOK {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Status, r.Path, r.Error); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "OK: %d, missing: %d, corrupt: %d, extra: %d, no hash: %d, errors: %d\n",
+		counts[irdStatusOK], counts[irdStatusMissing], counts[irdStatusCorrupt], counts[irdStatusExtra],
+		counts[irdStatusNoHash], counts[irdStatusError])
+	return err
+}
+
+// irdFolder is a game folder in JB format, it's content matches disc content.
+type irdFolder string
+
+func (f irdFolder) files() (map[string]int64, error) {
+	ret := make(map[string]int64)
+	err := filepath.WalkDir(string(f), func(p string, d iofs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(string(f), p)
+		if err != nil {
+			return err
+		}
+
+		ret[filepath.ToSlash(rel)] = fi.Size()
+		return nil
+	})
+
+	return ret, err
+}
+
+func (f irdFolder) matches(ctx context.Context, file ird.File, progress io.Writer) (bool, error) {
+	src, err := os.Open(filepath.Join(string(f), filepath.FromSlash(file.Path)))
+	if err != nil {
+		return false, err
+	}
+	defer src.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(io.MultiWriter(h, progress), readerWithContext{ctx: ctx, r: src}); err != nil {
+		return false, err
+	}
+
+	return [md5.Size]byte(h.Sum(nil)) == file.MD5, nil
+}
+
+func (irdFolder) parallel() bool { return true }
+
+func (irdFolder) Close() error { return nil }
+
+// irdImage is a disc image. Image may be encrypted, in this case files are decrypted with key from IRD.
+type irdImage struct {
+	f         handler.File
+	decrypted handler.File // nil if image doesn't contain regions map, so it's definitely decrypted
+	entries   map[string]iso9660.DirectoryEntry
+
+	preferDecrypted bool // last matched file was encrypted
+}
+
+func newIRDImage(ctx context.Context, imagePath string, data1 []byte) (*irdImage, error) {
+	f, err := openImage(ctx, imagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &irdImage{f: f, entries: make(map[string]iso9660.DirectoryEntry)}
+
+	// filesystem structures are never encrypted
+	img, err := iso9660.OpenImage(readSeekerAt{f})
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	var walk func(dir iso9660.DirectoryEntry, dirPath string) error
+	walk = func(dir iso9660.DirectoryEntry, dirPath string) error {
+		entries, err := img.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("read dir %q: %w", dirPath, err)
+		}
+
+		for _, e := range entries {
+			p := path.Join(dirPath, img.Name(e))
+			if e.FileFlags&iso9660.DirFlagDir != 0 {
+				if err := walk(e, p); err != nil {
+					return err
+				}
+				continue
+			}
+
+			ret.entries[p] = e
+		}
+
+		return nil
+	}
+	if err := walk(img.Root(), ""); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	ret.decrypted, err = encryptediso.NewEncryptedISO(f, data1, false)
+	if err != nil {
+		ret.decrypted = nil
+	}
+
+	return ret, nil
+}
+
+func (i *irdImage) files() (map[string]int64, error) {
+	ret := make(map[string]int64, len(i.entries))
+	for p, e := range i.entries {
+		ret[p] = int64(e.ExtentLength)
+	}
+
+	return ret, nil
+}
+
+func (i *irdImage) matches(ctx context.Context, file ird.File, progress io.Writer) (bool, error) {
+	e := i.entries[file.Path]
+
+	readers := []handler.File{i.f}
+	if i.decrypted != nil {
+		readers = append(readers, i.decrypted)
+		if i.preferDecrypted {
+			slices.Reverse(readers)
+		}
+	}
+
+	for idx, r := range readers {
+		// report progress only once
+		w := progress
+		if idx > 0 {
+			w = io.Discard
+		}
+
+		sum, err := hashImageRange(ctx, r, e.ExtentLocation.Bytes(), e.ExtentLength, w)
+		if err != nil {
+			return false, err
+		}
+
+		if sum == file.MD5 {
+			i.preferDecrypted = r == i.decrypted
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (*irdImage) parallel() bool { return false }
+
+func (i *irdImage) Close() error {
+	return i.f.Close()
+}
+
+// hashImageRange computes md5 of image part. Image is read by whole sectors because decryption works per-sector.
+func hashImageRange(ctx context.Context, r io.ReadSeeker, offset, size iso9660.SizeBytes, progress io.Writer) ([md5.Size]byte, error) {
+	if _, err := r.Seek(int64(offset), io.SeekStart); err != nil {
+		return [md5.Size]byte{}, err
+	}
+
+	h := md5.New()
+	buf := make([]byte, 32*iso9660.SectorSize)
+	for remaining := size; remaining > 0; {
+		if err := ctx.Err(); err != nil {
+			return [md5.Size]byte{}, err
+		}
+
+		chunk := min(iso9660.SizeBytes(len(buf)), remaining.AlignToSectors())
+		if _, err := io.ReadFull(r, buf[:chunk]); err != nil {
+			return [md5.Size]byte{}, err
+		}
+
+		data := buf[:min(chunk, remaining)]
+		h.Write(data)
+		progress.Write(data)
+		remaining -= iso9660.SizeBytes(len(data))
+	}
+
+	return [md5.Size]byte(h.Sum(nil)), nil
+}
+
+type irdApp struct {
+	IRDVerify irdVerifyCmd `cmd:"" name:"verify" help:"Verify game folder or disc image against IRD: report missing, corrupt and extra files."`
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/ioutil"
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/viso"
+)
+
+const (
+	discInfoOffset = 0x800 // sector 1
+	consoleIDSize  = 0x10
+	productIDSize  = 0x20
+)
+
+// paramSFOFields are shown in image info, only string fields are supported.
+var paramSFOFields = []string{"TITLE", "TITLE_ID", "CATEGORY", "VERSION", "APP_VER", "PS3_SYSTEM_VER"}
+
+type isoImageArgs struct {
+	Image string   `arg:"" help:"Path to image: ISO, CSO/ZSO, CHD, seekable ZSTD, 3k3y or Redump." type:"existingfile"`
+	DKey  *os.File `name:"dkey" help:"Disc key of encrypted image. By default key is taken from 3k3y image or from .dkey file near image."`
+}
+
+// isoImage is an opened image. Encrypted image is decrypted if key is valid.
+type isoImage struct {
+	handler.File
+	fs         *iso9660.Image
+	regions    []encryptediso.Region // nil if image doesn't contain regions map
+	encryption string
+}
+
+func (a *isoImageArgs) open(ctx context.Context) (*isoImage, error) {
+	if a.DKey != nil {
+		defer a.DKey.Close()
+	}
+
+	f, key, err := openImageWithKey(ctx, a.Image)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err = a.findKey(key)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	ret := &isoImage{File: f}
+	if err := ret.decrypt(key); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	// filesystem structures are never encrypted, but decrypted file is used to read files content
+	ret.fs, err = iso9660.OpenImage(readSeekerAt{ret.File})
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// findKey returns disc key from flag, embedded one or from .dkey file near image.
+// Only invalid key file provided by flag is an error, nil key returned if key not found.
+func (a *isoImageArgs) findKey(embedded []byte) ([]byte, error) {
+	if a.DKey != nil {
+		key, err := encryptediso.ReadKeyFile(a.DKey)
+		if err != nil {
+			return nil, fmt.Errorf("key read failed: %w", err)
+		}
+
+		return key, nil
+	}
+
+	if len(embedded) > 0 {
+		return embedded, nil
+	}
+
+	keyFile, err := os.Open(strings.TrimSuffix(a.Image, filepath.Ext(a.Image)) + ".dkey")
+	if err != nil {
+		return nil, nil
+	}
+	defer keyFile.Close()
+
+	key, err := encryptediso.ReadKeyFile(keyFile)
+	if err != nil {
+		return nil, nil
+	}
+
+	return key, nil
+}
+
+// decrypt determines encryption state and wraps file to decrypt it if possible.
+func (i *isoImage) decrypt(key []byte) error {
+	var err error
+	i.regions, err = encryptediso.EncryptedRegions(i.File)
+	if err != nil {
+		i.regions = nil
+		i.encryption = "not encrypted"
+		return nil
+	}
+
+	if !encryptediso.IsEncrypted(i.File) {
+		i.encryption = "decrypted (regions map kept)"
+		return nil
+	}
+
+	if len(key) == 0 {
+		i.encryption = "encrypted, no key"
+		return nil
+	}
+
+	decrypted, err := encryptediso.NewEncryptedISO(i.File, key, false)
+	if err != nil {
+		return err
+	}
+
+	err = decrypted.CheckKey()
+	switch {
+	case errors.Is(err, nil):
+		i.File, i.encryption = decrypted, "encrypted, key is valid"
+	case errors.Is(err, encryptediso.ErrKeyUnverifiable):
+		i.File, i.encryption = decrypted, "encrypted, key can't be verified"
+	case errors.Is(err, encryptediso.ErrInvalidKey):
+		i.encryption = "encrypted, key doesn't match"
+	default:
+		return err
+	}
+
+	return nil
+}
+
+type isoInfoCmd struct {
+	isoImageArgs
+}
+
+func (c *isoInfoCmd) Run(ctx context.Context, k *kong.Kong) error {
+	img, err := c.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	fi, err := img.Stat()
+	if err != nil {
+		return err
+	}
+
+	pvd := img.fs.Primary
+	tw := tabwriter.NewWriter(k.Stdout, 0, 0, 2, ' ', 0)
+	line := func(key string, value any) {
+		fmt.Fprintf(tw, "%s:\t%v\n", key, value)
+	}
+
+	line("Image", c.Image)
+	line("Size", fmt.Sprintf("%d bytes (%d sectors)", fi.Size(), iso9660.SizeBytes(fi.Size()).Sectors()))
+	line("System ID", strings.TrimSpace(string(pvd.SystemIdentifier)))
+	line("Volume ID", strings.TrimSpace(string(pvd.VolumeIdentifier)))
+	line("Volume set ID", strings.TrimSpace(string(pvd.VolumeSetIdentifier)))
+	line("Publisher", strings.TrimSpace(string(pvd.PublisherIdentifier)))
+	line("Data preparer", strings.TrimSpace(string(pvd.DataPreparerIdentifier)))
+	line("Application", strings.TrimSpace(string(pvd.ApplicationIdentifier)))
+	line("Volume size", fmt.Sprintf("%d sectors", pvd.VolumeSpaceSize))
+	line("Created", formatVolumeTime(pvd.VolumeCreationDateAndTime))
+	line("Modified", formatVolumeTime(pvd.VolumeModificationDateAndTime))
+	line("Joliet", img.fs.Joliet != nil)
+
+	if img.regions != nil {
+		var encryptedSectors iso9660.SizeSectors
+		for _, r := range img.regions {
+			encryptedSectors += r.End - r.Start
+		}
+		line("Regions map", fmt.Sprintf("%d encrypted regions, %d sectors", len(img.regions), encryptedSectors))
+	}
+
+	if consoleID, productID, ok := discInfo(img); ok {
+		line("Console ID", consoleID)
+		line("Product ID", productID)
+	}
+
+	line("Encryption", img.encryption)
+
+	if sfo, err := img.fs.FS().Open(path.Join("PS3_GAME", "PARAM.SFO")); err == nil {
+		for _, field := range paramSFOFields {
+			value, err := viso.SFOField(sfo.(io.ReadSeeker), field)
+			if err != nil {
+				value = "<" + err.Error() + ">"
+			}
+			line("PARAM.SFO "+field, value)
+		}
+		_ = sfo.Close()
+	}
+
+	return tw.Flush()
+}
+
+// discInfo reads PS3 disc info from sector 1.
+func discInfo(f io.ReadSeeker) (consoleID, productID string, ok bool) {
+	var buf [consoleIDSize + productIDSize]byte
+	if err := ioutil.FillBuffer(f, discInfoOffset, buf[:]); err != nil {
+		return "", "", false
+	}
+
+	consoleID = string(bytes.TrimRight(buf[:consoleIDSize], "\x00"))
+	if consoleID == "" {
+		return "", "", false
+	}
+
+	return consoleID, strings.TrimSpace(string(bytes.TrimRight(buf[consoleIDSize:], "\x00"))), true
+}
+
+func formatVolumeTime(ts iso9660.VolumeDescriptorTimestamp) string {
+	t := ts.Time()
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.DateTime + " -07:00")
+}
+
+type isoLsCmd struct {
+	isoImageArgs
+	Path      string `arg:"" optional:"" help:"Directory or file inside image." default:"."`
+	Long      bool   `help:"Show size, modification time and location of files." short:"l"`
+	Recursive bool   `help:"List subdirectories recursively." short:"R"`
+}
+
+func (c *isoLsCmd) Run(ctx context.Context, k *kong.Kong) error {
+	img, err := c.open(ctx)
+	if err != nil {
+		return err
+	}
+	defer img.Close()
+
+	fsys := img.fs.FS()
+	p := path.Clean(strings.Trim(filepath.ToSlash(c.Path), "/"))
+	if p == "" {
+		p = "."
+	}
+
+	tw := tabwriter.NewWriter(k.Stdout, 0, 0, 2, ' ', 0)
+	printEntry := func(name string, fi iofs.FileInfo) {
+		if fi.IsDir() {
+			name += "/"
+		}
+
+		if !c.Long {
+			fmt.Fprintln(tw, name)
+			return
+		}
+
+		de := fi.Sys().(iso9660.DirectoryEntry)
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\n", fi.Mode(), fi.Size(), fi.ModTime().Format(time.DateTime), de.ExtentLocation, name)
+	}
+
+	fi, err := iofs.Stat(fsys, p)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		printEntry(p, fi)
+		return tw.Flush()
+	}
+
+	err = iofs.WalkDir(fsys, p, func(entryPath string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entryPath == p {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel := entryPath
+		if p != "." {
+			rel = strings.TrimPrefix(entryPath, p+"/")
+		}
+		printEntry(rel, fi)
+
+		if d.IsDir() && !c.Recursive {
+			return iofs.SkipDir
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Flush()
+}
+
+type isoApp struct {
+	Info isoInfoCmd `cmd:"" name:"info" help:"Show image information: volume, PS3 disc info, encryption state and PARAM.SFO summary."`
+	Ls   isoLsCmd   `cmd:"" name:"ls" help:"List files inside image."`
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/dat"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/iso3k3y"
+)
+
+const redumpSuffix = ".redump"
+
+type convert3k3yCmd struct {
+	Image  string   `arg:"" help:"Path to 3k3y image." type:"existingfile"`
+	Output string   `help:"Path to output image. Defaults to image path with '.redump' suffix, i.e. 'game.redump.iso'." short:"o" type:"path"`
+	DAT    *os.File `help:"DAT file (i.e. from Redump) to verify result against." name:"dat"`
+}
+
+func (c *convert3k3yCmd) Run(k *kong.Kong) error {
+	in, err := os.Open(c.Image)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	key, err := iso3k3y.Test3k3yImage(in)
+	switch {
+	case errors.Is(err, nil):
+	case errors.Is(err, iso3k3y.ErrNot3k3y):
+		return fmt.Errorf("%s: %w", c.Image, err)
+	default:
+		return fmt.Errorf("failed to test 3k3y image: %w", err)
+	}
+
+	if _, err := in.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	converted, err := iso3k3y.NewISO3k3y(in)
+	if err != nil {
+		return err
+	}
+
+	outputPath := c.Output
+	if outputPath == "" {
+		ext := filepath.Ext(c.Image)
+		outputPath = strings.TrimSuffix(c.Image, ext) + redumpSuffix + ext
+	}
+
+	// check before long conversion, key file is never overwritten too
+	keyPath := strings.TrimSuffix(outputPath, filepath.Ext(outputPath)) + ".dkey"
+	if _, err := os.Stat(keyPath); len(key) > 0 && err == nil {
+		return fmt.Errorf("%s: %w", keyPath, fs.ErrExist)
+	}
+
+	hashes, err := c.write(k, converted, outputPath)
+	if err != nil {
+		return err
+	}
+
+	if len(key) > 0 {
+		if err := c.writeKey(k, key, outputPath, keyPath); err != nil {
+			_ = os.Remove(outputPath) // let user retry
+			return err
+		}
+	} else {
+		fmt.Fprintln(k.Stdout, "Image is decrypted 3k3y, so result is decrypted too and no key is written")
+	}
+
+	if c.DAT != nil {
+		return c.verify(k, hashes, outputPath)
+	}
+
+	return nil
+}
+
+// write writes image without 3k3y data to output and returns its hashes.
+func (c *convert3k3yCmd) write(k *kong.Kong, image *iso3k3y.ISO3k3y, outputPath string) (dat.Hashes, error) {
+	fi, err := image.Stat()
+	if err != nil {
+		return dat.Hashes{}, err
+	}
+
+	// refuse to overwrite existing file, it may be an original image
+	out, err := os.OpenFile(outputPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return dat.Hashes{}, err
+	}
+
+	// partial image is useless and prevents retry
+	written := false
+	defer func() {
+		if !written {
+			_ = out.Close()
+			_ = os.Remove(outputPath)
+		}
+	}()
+
+	p := mpb.New(mpb.WithOutput(k.Stderr), mpb.WithRefreshRate(180*time.Millisecond))
+
+	bar := p.New(fi.Size(),
+		mpb.BarStyle().Rbound("|"),
+		mpb.PrependDecorators(
+			decor.Counters(decor.SizeB1024(0), "% .2f / % .2f"),
+		),
+		mpb.AppendDecorators(
+			decor.EwmaETA(decor.ET_STYLE_GO, 30),
+			decor.Name(" ] "),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 30),
+		),
+	)
+
+	crcHash, md5Hash, sha1Hash := crc32.NewIEEE(), md5.New(), sha1.New()
+	size, err := io.Copy(io.MultiWriter(out, crcHash, md5Hash, sha1Hash), bar.ProxyReader(image))
+	if err != nil {
+		bar.Abort(false)
+		p.Wait()
+		return dat.Hashes{}, err
+	}
+	p.Wait()
+
+	if err := out.Close(); err != nil {
+		return dat.Hashes{}, err
+	}
+	written = true
+
+	fmt.Fprintf(k.Stdout, "Image written to %s\n", outputPath)
+
+	return dat.Hashes{
+		Size: size,
+		CRC:  hex.EncodeToString(crcHash.Sum(nil)),
+		MD5:  hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA1: hex.EncodeToString(sha1Hash.Sum(nil)),
+	}, nil
+}
+
+// writeKey checks that embedded key decrypts written image and writes it to .dkey file near image.
+func (c *convert3k3yCmd) writeKey(k *kong.Kong, key []byte, outputPath, keyPath string) error {
+	out, err := os.Open(outputPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	encrypted, err := encryptediso.NewEncryptedISO(out, key, false)
+	if err != nil {
+		return err
+	}
+
+	err = encrypted.CheckKey()
+	switch {
+	case errors.Is(err, nil):
+	case errors.Is(err, encryptediso.ErrKeyUnverifiable):
+		fmt.Fprintf(k.Stdout, "Warning: %s\n", err)
+	default:
+		return fmt.Errorf("embedded key check failed: %w", err)
+	}
+
+	keyFile, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+
+	_, err = keyFile.WriteString(strings.ToUpper(hex.EncodeToString(key)))
+	if closeErr := keyFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(keyPath)
+		return err
+	}
+
+	fmt.Fprintf(k.Stdout, "Key written to %s\n", keyPath)
+	return nil
+}
+
+func (c *convert3k3yCmd) verify(k *kong.Kong, hashes dat.Hashes, outputPath string) error {
+	defer c.DAT.Close()
+
+	datFile, err := dat.Parse(c.DAT)
+	if err != nil {
+		return err
+	}
+	idx := datFile.Index()
+
+	if m, ok := idx.Lookup(hashes); ok {
+		fmt.Fprintf(k.Stdout, "Verified: %s\n", m.Game.Name)
+		return nil
+	}
+
+	if m, ok := idx.LookupName(filepath.Base(c.Image)); ok {
+		return fmt.Errorf("image hashes don't match %s from DAT", m.Game.Name)
+	}
+
+	fmt.Fprintf(k.Stdout, "Image %s not found in DAT\n", outputPath)
+	return nil
+}
+
+type iso3k3yApp struct {
+	Convert convert3k3yCmd `cmd:"" name:"convert" help:"Convert 3k3y image to Redump one: strip 3k3y data and write embedded key to .dkey file."`
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"net"
+	"sync"
+)
+
+// connLimiter limits amount of simultaneously accepted connections across several listeners.
+// Limit may be changed at any time, already accepted connections are kept if it's lowered.
+type connLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	active int
+	wake   chan struct{} // closed when slot released or limit changed
+}
+
+// newConnLimiter creates limiter, zero or negative limit means no limit.
+func newConnLimiter(n int) *connLimiter {
+	return &connLimiter{limit: n, wake: make(chan struct{})}
+}
+
+func (l *connLimiter) setLimit(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit = n
+	l.wakeLocked()
+}
+
+func (l *connLimiter) wakeLocked() {
+	close(l.wake)
+	l.wake = make(chan struct{})
+}
+
+func (l *connLimiter) acquire(done <-chan struct{}) bool {
+	for {
+		l.mu.Lock()
+		if l.limit <= 0 || l.active < l.limit {
+			l.active++
+			l.mu.Unlock()
+			return true
+		}
+		wake := l.wake
+		l.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-done:
+			return false
+		}
+	}
+}
+
+func (l *connLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.active--
+	l.wakeLocked()
+}
+
+func (l *connLimiter) listener(ln net.Listener) net.Listener {
+	return &limitListener{
+		Listener: ln,
+		limiter:  l,
+		done:     make(chan struct{}),
+	}
+}
+
+type limitListener struct {
+	net.Listener
+
+	limiter   *connLimiter
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *limitListener) Accept() (net.Conn, error) {
+	if !l.limiter.acquire(l.done) {
+		return nil, net.ErrClosed
+	}
+
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		l.limiter.release()
+		return nil, err
+	}
+
+	return &limitConn{
+		Conn:    conn,
+		release: sync.OnceFunc(l.limiter.release),
+	}, nil
+}
+
+func (l *limitListener) Close() error {
+	err := l.Listener.Close()
+	l.closeOnce.Do(func() { close(l.done) })
+	return err
+}
+
+type limitConn struct {
+	net.Conn
+
+	release func()
+}
+
+func (c *limitConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handoff"
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+	"github.com/xakep666/ps3netsrv-go/pkg/iprange"
+	"github.com/xakep666/ps3netsrv-go/pkg/proxyproto"
+	"github.com/xakep666/ps3netsrv-go/pkg/recording"
+)
+
+// mainListener describes listener serving NETISO protocol.
+type mainListener struct {
+	addr       string
+	tls        bool
+	whitelist  *iprange.IPRange // overrides global whitelist if set
+	maxClients int
+}
+
+// parseMainListener parses listen address with optional per-listener options in form
+// "<addr>#<option>[,<option>...]". Supported options:
+//   - "tls" or "plain" - accept only TLS or only plain connections
+//   - "whitelist=<range>" - client whitelist overriding global one
+//   - "max-clients=<n>" - limit of connected clients to this listener in addition to global one
+func parseMainListener(s string, defaults mainListener) (mainListener, error) {
+	addr, options, _ := strings.Cut(s, "#")
+	ml := defaults
+	ml.addr = addr
+
+	if options == "" {
+		return ml, nil
+	}
+
+	for option := range strings.SplitSeq(options, ",") {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "tls":
+			ml.tls = true
+		case "plain":
+			ml.tls = false
+		case "whitelist":
+			r, err := iprange.ParseIPRange(value)
+			if err != nil {
+				return mainListener{}, fmt.Errorf("listener %q whitelist: %w", addr, err)
+			}
+			ml.whitelist = r
+		case "max-clients":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return mainListener{}, fmt.Errorf("listener %q max clients: %w", addr, err)
+			}
+			ml.maxClients = n
+		default:
+			return mainListener{}, fmt.Errorf("listener %q: unknown option %q", addr, key)
+		}
+	}
+
+	return ml, nil
+}
+
+// mainListeners returns listeners serving NETISO protocol.
+// If TLS is configured without dedicated addresses, main listeners accept only TLS connections by default.
+func (sapp *serverApp) mainListeners() ([]mainListener, error) {
+	tlsEnabled := sapp.TLSCert != ""
+
+	var listeners []mainListener
+	add := func(addrs []string, defaults mainListener) error {
+		for _, addr := range addrs {
+			ml, err := parseMainListener(addr, defaults)
+			if err != nil {
+				return err
+			}
+
+			if ml.tls && !tlsEnabled {
+				return fmt.Errorf("listener %q requires TLS certificate", ml.addr)
+			}
+
+			listeners = append(listeners, ml)
+		}
+
+		return nil
+	}
+
+	defaults := mainListener{
+		tls: tlsEnabled && len(sapp.TLSListenAddr) == 0,
+	}
+	if err := add(sapp.ListenAddr, defaults); err != nil {
+		return nil, err
+	}
+
+	defaults.tls = true
+	if err := add(sapp.TLSListenAddr, defaults); err != nil {
+		return nil, err
+	}
+
+	if len(listeners) == 0 {
+		return nil, fmt.Errorf("no listen addresses provided")
+	}
+
+	return listeners, nil
+}
+
+// wrapMainListener applies connection filters and transformations to listener.
+func (sapp *serverApp) wrapMainListener(socket net.Listener, ml mainListener, rc *runtimeConfig, tlsConfig *tls.Config) net.Listener {
+	if ml.whitelist != nil {
+		warnWhitelist(socket, ml.whitelist)
+	} else {
+		warnWhitelist(socket, rc.whitelist.Range())
+	}
+
+	attrs := []any{"addr", logutil.ListenAddressValue(socket.Addr())}
+	if sapp.Upstream != "" {
+		attrs = append(attrs, "upstream", sapp.Upstream)
+	} else {
+		attrs = append(attrs, "root", sapp.rootDescription())
+	}
+	if ml.tls {
+		attrs = append(attrs, "tls", true, "mtls", sapp.TLSClientCA != "")
+	}
+	if ml.whitelist != nil {
+		attrs = append(attrs, "whitelist", ml.whitelist)
+	}
+	if ml.maxClients > 0 {
+		attrs = append(attrs, "max_clients", ml.maxClients)
+	}
+	slog.Info("Listening...", attrs...)
+
+	// order matters: limits must be applied before PROXY header listener because it accepts connections in background,
+	// real client address must be known before filtering, filtering must be done before TLS handshake
+	socket = rc.limiter.listener(socket)
+	if ml.maxClients > 0 {
+		socket = newConnLimiter(ml.maxClients).listener(socket)
+	}
+	if len(sapp.ProxyProtocolTrusted) > 0 {
+		socket = proxyproto.NewListener(socket, sapp.ProxyProtocolTrusted, 0, slog.Default())
+	}
+	if ml.whitelist != nil {
+		socket = iprange.FilterListener(socket, ml.whitelist, false)
+	} else {
+		socket = rc.whitelist.Listener(socket)
+	}
+	if ml.tls {
+		socket = tls.NewListener(socket, tlsConfig)
+	}
+	if sapp.RecordDir != "" {
+		socket = &recording.Listener{
+			Listener:     socket,
+			Dir:          sapp.RecordDir,
+			HashPayloads: sapp.RecordPayloadHash,
+			Logger:       slog.Default(),
+		}
+	}
+
+	return socket
+}
+
+// mainSocket is a socket made for main listener.
+type mainSocket struct {
+	socket net.Listener
+	ml     mainListener
+}
+
+// serverSockets are sockets of all servers. Sockets of disabled servers are nil.
+type serverSockets struct {
+	main  []mainSocket
+	debug net.Listener
+	http  net.Listener
+	nbd   net.Listener
+}
+
+func (ss *serverSockets) close() {
+	for _, ms := range ss.main {
+		_ = ms.socket.Close()
+	}
+	for _, socket := range []net.Listener{ss.debug, ss.http, ss.nbd} {
+		if socket != nil {
+			_ = socket.Close()
+		}
+	}
+}
+
+// listen makes sockets for all enabled servers or takes them from previous process in case of upgrade.
+func (sapp *serverApp) listen(ho *handoff.Handoff) (*serverSockets, error) {
+	mainListeners, err := sapp.mainListeners()
+	if err != nil {
+		return nil, err
+	}
+
+	if sapp.NBDListenAddr != "" && len(sapp.NBDExport) == 0 {
+		return nil, fmt.Errorf("nbd server requires at least one export")
+	}
+
+	var ss serverSockets
+	for _, ml := range mainListeners {
+		sockets, err := ho.Listen(ml.addr, makeListeners)
+		if err != nil {
+			ss.close()
+			return nil, fmt.Errorf("listen on %q failed: %w", ml.addr, err)
+		}
+
+		for _, socket := range sockets {
+			ss.main = append(ss.main, mainSocket{socket: socket, ml: ml})
+		}
+	}
+
+	listenOne := func(addr string) (net.Listener, error) {
+		if addr == "" {
+			return nil, nil
+		}
+
+		sockets, err := ho.Listen(addr, func(addr string) ([]net.Listener, error) {
+			socket, err := makeListener(addr)
+			if err != nil {
+				return nil, err
+			}
+			return []net.Listener{socket}, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return sockets[0], nil
+	}
+
+	if ss.debug, err = listenOne(sapp.DebugServerListenAddr); err != nil {
+		ss.close()
+		return nil, fmt.Errorf("debug server listen failed: %w", err)
+	}
+	if ss.http, err = listenOne(sapp.HTTPListenAddr); err != nil {
+		ss.close()
+		return nil, fmt.Errorf("http server listen failed: %w", err)
+	}
+	if ss.nbd, err = listenOne(sapp.NBDListenAddr); err != nil {
+		ss.close()
+		return nil, fmt.Errorf("nbd server listen failed: %w", err)
+	}
+
+	return &ss, nil
+}
@@ -25,13 +25,20 @@ var (
 )
 
 type app struct {
-	ServerApp  serverApp  `cmd:"" name:"server" help:"Run server."`
-	DecryptApp decryptApp `cmd:"" name:"decrypt" help:"Decrypt encrypted images."`
-	MakeISOApp makeISOApp `cmd:"" name:"make-iso" help:"Make ISO image from directory."`
-	CHDApp     chdApp     `cmd:"" name:"chd" help:"Helpers for CHD images."`
-	CSOApp     csoApp     `cmd:"" name:"cso" help:"Helpers for CSO/ZSO images."`
-	ClientApp  clientApp  `cmd:"" name:"client" help:"Client for netiso protocol"`
-	SvcApp     svcApp
+	ServerApp     serverApp     `cmd:"" name:"server" help:"Run server."`
+	DecryptApp    decryptApp    `cmd:"" name:"decrypt" help:"Decrypt encrypted images."`
+	EncryptApp    encryptApp    `cmd:"" name:"encrypt" help:"Encrypt decrypted image back to Redump form."`
+	MakeISOApp    makeISOApp    `cmd:"" name:"make-iso" help:"Make ISO image from directory."`
+	CHDApp        chdApp        `cmd:"" name:"chd" help:"Helpers for CHD images."`
+	CSOApp        csoApp        `cmd:"" name:"cso" help:"Helpers for CSO/ZSO images."`
+	ClientApp     clientApp     `cmd:"" name:"client" help:"Client for netiso protocol"`
+	ReplayApp     replayApp     `cmd:"" name:"replay" help:"Replay recorded session against server and compare responses."`
+	VerifyApp     verifyApp     `cmd:"" name:"verify" help:"Verify images against DAT file (Redump, No-Intro)."`
+	IRDApp        irdApp        `cmd:"" name:"ird" help:"Helpers for IRD files."`
+	EncryptionApp encryptionApp `cmd:"" name:"encryption" help:"Helpers for encrypted images."`
+	ISO3k3yApp    iso3k3yApp    `cmd:"" name:"3k3y" help:"Helpers for 3k3y images."`
+	ISOApp        isoApp        `cmd:"" name:"iso" help:"Inspect ISO images."`
+	SvcApp        svcApp
 
 	Version kong.VersionFlag `help:"Show application version info."`
 	Config  kong.ConfigFlag  `help:"Load configuration from file." env:"PS3NETSRV_CONFIG_FILE"`
@@ -53,31 +60,40 @@ func (a *app) AbsoluteConfigPath() (string, error) {
 	return filepath.Join(wd, p), nil
 }
 
+// cliArgs are command line arguments application was started with.
+type cliArgs []string
+
 func main() {
 	kongutil.Run(
-		kong.Must(new(app),
-			kong.Name("ps3netsrv-go"),
-			kong.Description("Alternative ps3netsrv implementation for installing games over network."),
-			kong.Configuration(kongini.Loader, configLocations()...),
-			kong.Vars{
-				"version": versionString(),
-			},
-			kong.UsageOnError(),
-			kongutil.OutputFileMapper,
-			kongutil.BinSizeMapper,
-		),
+		kong.Must(new(app), kongOptions()...),
 		func(ctx context.Context, k *kong.Kong, args []string) error {
-			kctx, err := k.Parse(translateArgs(args))
+			args = translateArgs(args)
+			kctx, err := k.Parse(args)
 			if err != nil {
 				return err
 			}
 
 			kctx.BindTo(ctx, (*context.Context)(nil))
+			kctx.Bind(cliArgs(args))
 			return kctx.Run()
 		},
 	)
 }
 
+func kongOptions() []kong.Option {
+	return []kong.Option{
+		kong.Name("ps3netsrv-go"),
+		kong.Description("Alternative ps3netsrv implementation for installing games over network."),
+		kong.Configuration(kongini.Loader, configLocations()...),
+		kong.Vars{
+			"version": versionString(),
+		},
+		kong.UsageOnError(),
+		kongutil.OutputFileMapper,
+		kongutil.BinSizeMapper,
+	}
+}
+
 func versionString() string {
 	var sb strings.Builder
 	sb.WriteString("ps3netsrv-go version ")
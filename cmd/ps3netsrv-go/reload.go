@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"reflect"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+	"github.com/xakep666/ps3netsrv-go/pkg/iprange"
+)
+
+// reloadableOptions are names of options applied without restart.
+var reloadableOptions = []string{"debug", "log-level", "client-whitelist", "allow-write", "max-clients", "read-timeout"}
+
+// runtimeConfig holds options which may be changed while server is running.
+type runtimeConfig struct {
+	args    cliArgs
+	started serverApp // options server was started with, used to detect changes requiring restart
+
+	mu         sync.Mutex // serializes reloads
+	maxClients int
+
+	logLevel    slog.LevelVar
+	allowWrite  atomic.Bool
+	readTimeout atomic.Int64
+	whitelist   *iprange.DynamicFilter
+	limiter     *connLimiter
+}
+
+func newRuntimeConfig(sapp *serverApp, args cliArgs) *runtimeConfig {
+	rc := &runtimeConfig{
+		args:      args,
+		started:   *sapp,
+		whitelist: iprange.NewDynamicFilter(sapp.ClientWhitelist),
+		limiter:   newConnLimiter(sapp.MaxClients),
+
+		maxClients: sapp.MaxClients,
+	}
+	rc.logLevel.Set(sapp.logLevel())
+	rc.allowWrite.Store(sapp.AllowWrite)
+	rc.readTimeout.Store(int64(sapp.ReadTimeout))
+
+	return rc
+}
+
+func (sapp *serverApp) logLevel() slog.Level {
+	if sapp.Debug {
+		return slog.LevelDebug
+	}
+
+	return sapp.LogLevel
+}
+
+func (rc *runtimeConfig) getReadTimeout() time.Duration {
+	return time.Duration(rc.readTimeout.Load())
+}
+
+// reload parses command line, environment and configuration file again and applies reloadable options.
+func (rc *runtimeConfig) reload() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	var cli app
+	k, err := kong.New(&cli, kongOptions()...)
+	if err != nil {
+		return fmt.Errorf("parser init: %w", err)
+	}
+
+	kctx, err := k.Parse(rc.args)
+	if err != nil {
+		return fmt.Errorf("parse configuration: %w", err)
+	}
+
+	sapp := &cli.ServerApp
+	if !sapp.remoteRoot() {
+		sapp.Root = kong.ExpandPath(sapp.Root) // expanded on startup too
+	}
+
+	var changes []any
+	if level := sapp.logLevel(); level != rc.logLevel.Level() {
+		rc.logLevel.Set(level)
+		changes = append(changes, "log_level", level)
+	}
+	if rc.allowWrite.Swap(sapp.AllowWrite) != sapp.AllowWrite {
+		changes = append(changes, "allow_write", sapp.AllowWrite)
+	}
+	if time.Duration(rc.readTimeout.Swap(int64(sapp.ReadTimeout))) != sapp.ReadTimeout {
+		changes = append(changes, "read_timeout", sapp.ReadTimeout)
+	}
+	if rc.maxClients != sapp.MaxClients {
+		rc.limiter.setLimit(sapp.MaxClients)
+		rc.maxClients = sapp.MaxClients
+		changes = append(changes, "max_clients", sapp.MaxClients)
+	}
+	if !reflect.DeepEqual(rc.whitelist.Range(), sapp.ClientWhitelist) {
+		dropped := rc.whitelist.SetRange(sapp.ClientWhitelist)
+		changes = append(changes, "client_whitelist", sapp.ClientWhitelist, "dropped_clients", dropped)
+	}
+
+	if len(changes) > 0 {
+		slog.Info("Configuration reloaded", changes...)
+	} else {
+		slog.Info("Configuration reloaded, nothing changed")
+	}
+
+	if restartRequired := rc.restartRequired(kctx, sapp); len(restartRequired) > 0 {
+		slog.Warn("Changed options require restart to apply", "options", restartRequired)
+	}
+
+	return nil
+}
+
+// restartRequired returns names of changed options which can't be applied without restart.
+func (rc *runtimeConfig) restartRequired(kctx *kong.Context, sapp *serverApp) []string {
+	type target struct {
+		addr uintptr
+		typ  reflect.Type
+	}
+
+	flagNames := make(map[target]string)
+	for _, flag := range kctx.Flags() {
+		if flag.Target.CanAddr() {
+			flagNames[target{addr: flag.Target.UnsafeAddr(), typ: flag.Target.Type()}] = flag.Name
+		}
+	}
+
+	var ret []string
+	var walk func(started, reloaded reflect.Value)
+	walk = func(started, reloaded reflect.Value) {
+		for i := range reloaded.NumField() {
+			field := reloaded.Field(i)
+			name, ok := flagNames[target{addr: field.UnsafeAddr(), typ: field.Type()}]
+			switch {
+			case !ok && field.Kind() == reflect.Struct:
+				walk(started.Field(i), field) // embedded options
+			case !ok, slices.Contains(reloadableOptions, name):
+				// pass
+			case !reflect.DeepEqual(started.Field(i).Interface(), field.Interface()):
+				ret = append(ret, name)
+			}
+		}
+	}
+	walk(reflect.ValueOf(rc.started), reflect.ValueOf(sapp).Elem())
+
+	return ret
+}
+
+// reloadOnSignal reloads configuration when SIGHUP received.
+func (rc *runtimeConfig) reloadOnSignal(ctx context.Context) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			slog.Info("SIGHUP received, reloading configuration")
+			if err := rc.reload(); err != nil {
+				slog.Error("Configuration reload failed", logutil.ErrorAttr(err))
+			}
+		}
+	}
+}
+
+// ServeHTTP reloads configuration on request to debug server.
+func (rc *runtimeConfig) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	slog.Info("Reloading configuration by debug server request")
+	if err := rc.reload(); err != nil {
+		slog.Error("Configuration reload failed", logutil.ErrorAttr(err))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	_, _ = fmt.Fprintln(w, "configuration reloaded")
+}
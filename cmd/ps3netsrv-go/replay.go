@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/xakep666/ps3netsrv-go/internal/ioutil"
+	"github.com/xakep666/ps3netsrv-go/pkg/client"
+	"github.com/xakep666/ps3netsrv-go/pkg/recording"
+)
+
+type replayApp struct {
+	Recording   *os.File `arg:"" help:"Session recording made with 'server --record-dir'."`
+	Address     string   `help:"Target server address" required:""`
+	IgnoreTimes bool     `help:"Don't compare file times."`
+
+	TLS clientTLSOptions `embed:""`
+}
+
+func (r *replayApp) Run(ctx context.Context, k *kong.Kong) error {
+	defer r.Recording.Close()
+
+	entries, err := recording.ReadEntries(r.Recording)
+	if err != nil {
+		return fmt.Errorf("read recording: %w", err)
+	}
+
+	opts, err := r.TLS.clientOptions()
+	if err != nil {
+		return err
+	}
+
+	c, err := client.NewClient(ctx, ioutil.NewCopier(), r.Address, opts...)
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+	defer c.Close()
+
+	mismatches, err := recording.Replay(ctx, c, entries, recording.ReplayOptions{IgnoreTimes: r.IgnoreTimes})
+	for _, m := range mismatches {
+		fmt.Fprintf(k.Stdout, "#%d %s", m.Entry.Seq, m.Entry.Op)
+		if m.Entry.Request.Path != "" {
+			fmt.Fprintf(k.Stdout, " %q", m.Entry.Request.Path)
+		}
+		fmt.Fprintln(k.Stdout)
+		for _, d := range m.Differences {
+			fmt.Fprintf(k.Stdout, "\t%s\n", d)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(k.Stderr, "Replayed %d commands, %d responses differ\n", len(entries), len(mismatches))
+	if len(mismatches) > 0 {
+		return fmt.Errorf("responses differ from recording")
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handoff"
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+)
+
+// upgradeReadyTimeout limits time of new process startup during upgrade.
+const upgradeReadyTimeout = time.Minute
+
+// upgradeOnSignal starts new process of (possibly updated) executable with the same arguments when upgrade signal received.
+// Listeners are passed to new process, so no connections are dropped. After new process is ready
+// server is stopped gracefully: connected clients are served until they become idle or shutdown timeout expires.
+func (sapp *serverApp) upgradeOnSignal(ctx context.Context, ho *handoff.Handoff, stop context.CancelFunc) error {
+	if len(upgradeSignals) == 0 {
+		return nil
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, upgradeSignals...)
+	defer signal.Stop(sig)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-sig:
+		}
+
+		slog.Info("Upgrade signal received, starting new process")
+
+		pid, err := sapp.upgrade(ctx, ho)
+		if err != nil {
+			slog.Error("Upgrade failed, continue serving", logutil.ErrorAttr(err))
+			continue
+		}
+
+		slog.Info("New process is ready, shutting down", "pid", pid)
+		stop()
+		return nil
+	}
+}
+
+func (sapp *serverApp) upgrade(ctx context.Context, ho *handoff.Handoff) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, fmt.Errorf("get executable: %w", err)
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	ctx, cancel := context.WithTimeout(ctx, upgradeReadyTimeout)
+	defer cancel()
+
+	if err := ho.Upgrade(ctx, cmd); err != nil {
+		return 0, err
+	}
+
+	return cmd.Process.Pid, nil
+}
+
+func writePIDFile(path string) error {
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o644); err != nil {
+		return fmt.Errorf("write pid file: %w", err)
+	}
+
+	return nil
+}
+
+// removePIDFile removes PID file if it wasn't overwritten by new process after upgrade.
+func removePIDFile(path string) {
+	content, err := os.ReadFile(path)
+	if err != nil || string(bytes.TrimSpace(content)) != strconv.Itoa(os.Getpid()) {
+		return
+	}
+
+	_ = os.Remove(path)
+}
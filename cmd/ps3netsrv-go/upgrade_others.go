@@ -0,0 +1,10 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var upgradeSignals = []os.Signal{syscall.SIGUSR2}
@@ -0,0 +1,6 @@
+package main
+
+import "os"
+
+// upgradeSignals is empty because Windows doesn't support passing sockets to child process.
+var upgradeSignals []os.Signal
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	iofs "io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/vbauerster/mpb/v8"
+	"github.com/vbauerster/mpb/v8/decor"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/dat"
+)
+
+// Verification statuses.
+const (
+	verifyStatusVerified = "verified"
+	verifyStatusMismatch = "mismatch" // dump with the same name exists in DAT but hashes differ
+	verifyStatusUnknown  = "unknown"
+	verifyStatusError    = "error"
+)
+
+// imageExts are extensions of files checked when directory is provided.
+var imageExts = []string{".iso", ".bin", ".img", ".chd", ".cso", ".zso", ".zst"}
+
+type verifyResult struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Game   string `json:"game,omitempty"`
+	ROM    string `json:"rom,omitempty"`
+	Size   int64  `json:"size"`
+	CRC32  string `json:"crc32,omitempty"`
+	MD5    string `json:"md5,omitempty"`
+	SHA1   string `json:"sha1,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type verifyApp struct {
+	DAT   *os.File `help:"DAT file (Logiqx XML), i.e. from Redump or No-Intro." name:"dat" required:""`
+	Paths []string `arg:"" help:"Images or directories with images to verify." type:"path"`
+	Jobs  int      `help:"Amount of images hashed in parallel." short:"j" default:"4"`
+	JSON  bool     `help:"Output results in JSON format." name:"json"`
+}
+
+func (v *verifyApp) Run(ctx context.Context, k *kong.Kong) error {
+	defer v.DAT.Close()
+
+	datFile, err := dat.Parse(v.DAT)
+	if err != nil {
+		return err
+	}
+	idx := datFile.Index()
+
+	images, err := v.images()
+	if err != nil {
+		return err
+	}
+
+	p := mpb.New(mpb.WithOutput(k.Stderr), mpb.WithRefreshRate(180*time.Millisecond))
+	bar := p.New(0,
+		mpb.BarStyle().Rbound("|"),
+		mpb.PrependDecorators(
+			decor.Counters(decor.SizeB1024(0), "% .2f / % .2f"),
+		),
+		mpb.AppendDecorators(
+			decor.EwmaETA(decor.ET_STYLE_GO, 30),
+			decor.Name(" ] "),
+			decor.EwmaSpeed(decor.SizeB1024(0), "% .2f", 30),
+		),
+	)
+	var total atomic.Int64
+
+	results := make([]verifyResult, len(images))
+	eg, ctx := errgroup.WithContext(ctx)
+	eg.SetLimit(max(v.Jobs, 1))
+	for i, image := range images {
+		eg.Go(func() error {
+			results[i] = v.verify(ctx, idx, image, func(size int64) io.Writer {
+				bar.SetTotal(total.Add(size), false)
+				return bar.ProxyWriter(io.Discard)
+			})
+			return ctx.Err()
+		})
+	}
+
+	err = eg.Wait()
+	bar.SetTotal(-1, true)
+	p.Wait()
+	if err != nil {
+		return err
+	}
+
+	if v.JSON {
+		enc := json.NewEncoder(k.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else if err := v.printResults(k.Stdout, results); err != nil {
+		return err
+	}
+
+	var failed int
+	for _, r := range results {
+		if r.Status == verifyStatusMismatch || r.Status == verifyStatusError {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d images failed verification", failed, len(results))
+	}
+
+	return nil
+}
+
+// images lists provided files and images found in provided directories.
+func (v *verifyApp) images() ([]string, error) {
+	var images []string
+	for _, root := range v.Paths {
+		err := filepath.WalkDir(root, func(path string, d iofs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if d.IsDir() {
+				return nil
+			}
+
+			// explicitly provided file is checked regardless of extension
+			if path == root || slices.Contains(imageExts, strings.ToLower(filepath.Ext(path))) {
+				images = append(images, path)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return images, nil
+}
+
+func (v *verifyApp) verify(ctx context.Context, idx *dat.Index, path string, progress func(size int64) io.Writer) verifyResult {
+	res := verifyResult{Path: path, Status: verifyStatusError}
+
+	f, err := openImage(ctx, path)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	crcHash, md5Hash, sha1Hash := crc32.NewIEEE(), md5.New(), sha1.New()
+	w := io.MultiWriter(crcHash, md5Hash, sha1Hash, progress(fi.Size()))
+	res.Size, err = io.Copy(w, readerWithContext{ctx: ctx, r: f})
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	res.CRC32 = hex.EncodeToString(crcHash.Sum(nil))
+	res.MD5 = hex.EncodeToString(md5Hash.Sum(nil))
+	res.SHA1 = hex.EncodeToString(sha1Hash.Sum(nil))
+
+	m, ok := idx.Lookup(dat.Hashes{Size: res.Size, CRC: res.CRC32, MD5: res.MD5, SHA1: res.SHA1})
+	switch {
+	case ok:
+		res.Status = verifyStatusVerified
+	default:
+		m, ok = idx.LookupName(filepath.Base(path))
+		if ok {
+			res.Status = verifyStatusMismatch
+		} else {
+			res.Status = verifyStatusUnknown
+		}
+	}
+
+	if ok {
+		res.Game, res.ROM = m.Game.Name, m.ROM.Name
+	}
+
+	return res
+}
+
+func (v *verifyApp) printResults(w io.Writer, results []verifyResult) error {
+	counts := make(map[string]int)
+
+	tw := tabwriter.NewWriter(w, 10, 0, 2, ' ', 0)
+	for _, r := range results {
+		counts[r.Status]++
+
+		details := r.Game
+		if r.Error != "" {
+			details = r.Error
+		}
+
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Status, r.Path, details); err != nil {
+			return err
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	_, err := fmt.Fprintf(w, "Verified: %d, mismatch: %d, unknown: %d, errors: %d\n",
+		counts[verifyStatusVerified], counts[verifyStatusMismatch], counts[verifyStatusUnknown], counts[verifyStatusError])
+	return err
+}
+
+// readerWithContext stops reading when context is canceled.
+type readerWithContext struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r readerWithContext) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
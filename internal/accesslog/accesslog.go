@@ -0,0 +1,127 @@
+// Package accesslog implements log of served files and client sessions in JSON Lines format.
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Record types.
+const (
+	TypeFile    = "file"
+	TypeSession = "session"
+)
+
+// FileRecord describes read-only file lifetime: from open to close or opening another file.
+type FileRecord struct {
+	Type       string        `json:"type"`
+	Time       time.Time     `json:"time"` // when file was opened
+	Client     string        `json:"client"`
+	Path       string        `json:"path"`
+	Format     []string      `json:"format,omitempty"` // applied openers and wrappers, empty for plain files
+	Bytes      int64         `json:"bytes"`
+	Reads      int64         `json:"reads"`
+	Sequential float64       `json:"sequential_pct"` // percentage of reads continuing previous one
+	Duration   time.Duration `json:"duration_ns"`
+}
+
+// SessionRecord summarizes client connection.
+type SessionRecord struct {
+	Type     string        `json:"type"`
+	Time     time.Time     `json:"time"` // when client connected
+	Client   string        `json:"client"`
+	Files    int           `json:"files"`
+	Bytes    int64         `json:"bytes"`
+	Reads    int64         `json:"reads"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Log writes records to provided writer and keeps last records in memory.
+// Nil Log discards records.
+type Log struct {
+	w io.Writer
+
+	mu     sync.Mutex
+	recent []json.RawMessage // ring buffer
+	next   int
+	full   bool
+}
+
+// NewLog makes log writing to w (may be nil) and keeping up to keep last records for ServeHTTP.
+func NewLog(w io.Writer, keep int) *Log {
+	return &Log{
+		w:      w,
+		recent: make([]json.RawMessage, keep),
+	}
+}
+
+// WriteFile records file access.
+func (l *Log) WriteFile(rec FileRecord) error {
+	if l == nil {
+		return nil
+	}
+
+	rec.Type = TypeFile
+	return l.write(rec)
+}
+
+// WriteSession records session summary.
+func (l *Log) WriteSession(rec SessionRecord) error {
+	if l == nil {
+		return nil
+	}
+
+	rec.Type = TypeSession
+	return l.write(rec)
+}
+
+func (l *Log) write(rec any) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal access record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.recent) > 0 {
+		l.recent[l.next] = line
+		l.next = (l.next + 1) % len(l.recent)
+		l.full = l.full || l.next == 0
+	}
+
+	if l.w == nil {
+		return nil
+	}
+
+	if _, err := l.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write access record: %w", err)
+	}
+
+	return nil
+}
+
+// Recent returns last records starting from the oldest one.
+func (l *Log) Recent() []json.RawMessage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.full {
+		return append([]json.RawMessage(nil), l.recent[:l.next]...)
+	}
+
+	return append(append([]json.RawMessage(nil), l.recent[l.next:]...), l.recent[:l.next]...)
+}
+
+// ServeHTTP responds with last records in JSON Lines format.
+func (l *Log) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/jsonl")
+
+	for _, rec := range l.Recent() {
+		_, _ = w.Write(append(rec, '\n'))
+	}
+}
@@ -0,0 +1,36 @@
+package accesslog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/accesslog"
+)
+
+func TestLog(t *testing.T) {
+	var buf bytes.Buffer
+	l := accesslog.NewLog(&buf, 2)
+
+	require.NoError(t, l.WriteFile(accesslog.FileRecord{Client: "c", Path: "/1"}))
+	require.NoError(t, l.WriteFile(accesslog.FileRecord{Client: "c", Path: "/2", Format: []string{"cso"}}))
+	require.NoError(t, l.WriteSession(accesslog.SessionRecord{Client: "c", Files: 2}))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 3, "all records must be written")
+
+	var rec accesslog.SessionRecord
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &rec))
+	assert.Equal(t, accesslog.TypeSession, rec.Type)
+	assert.Equal(t, 2, rec.Files)
+
+	rw := httptest.NewRecorder()
+	l.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/access-log", nil))
+	assert.Equal(t, strings.Join(lines[1:], "\n")+"\n", rw.Body.String(), "only last records must be kept")
+}
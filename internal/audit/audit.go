@@ -0,0 +1,74 @@
+// Package audit implements append-only log of modifying operations in JSON Lines format with size-based rotation.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/rotate"
+)
+
+// Operation results.
+const (
+	ResultOK        = "ok"
+	ResultError     = "error"
+	ResultForbidden = "forbidden"
+)
+
+// Record describes single modifying operation.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Client string    `json:"client"`
+	OpCode string    `json:"opcode"`
+	Path   string    `json:"path,omitempty"`
+	Bytes  int64     `json:"bytes,omitempty"` // total amount of bytes written to file
+	Result string    `json:"result"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Log writes records to file rotating it by size. Nil Log discards records.
+type Log struct {
+	f *rotate.File
+}
+
+// NewLog opens or creates log file. Zero or negative maxSize disables rotation.
+func NewLog(path string, maxSize int64, maxBackups int) (*Log, error) {
+	f, err := rotate.Open(path, maxSize, maxBackups)
+	if err != nil {
+		return nil, fmt.Errorf("audit log: %w", err)
+	}
+
+	return &Log{f: f}, nil
+}
+
+// Write appends record to log. Record time is set to current if empty.
+func (l *Log) Write(rec Record) error {
+	if l == nil {
+		return nil
+	}
+
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("marshal audit record: %w", err)
+	}
+
+	if _, err := l.f.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("write audit record: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes log file.
+func (l *Log) Close() error {
+	if l == nil {
+		return nil
+	}
+
+	return l.f.Close()
+}
@@ -0,0 +1,63 @@
+package audit_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/audit"
+)
+
+func readRecords(t *testing.T, path string) []audit.Record {
+	t.Helper()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []audit.Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec audit.Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	require.NoError(t, scanner.Err())
+
+	return records
+}
+
+func TestLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	// each record is a bit shorter than 150 bytes, so only one record fits
+	l, err := audit.NewLog(path, 150, 2)
+	require.NoError(t, err)
+
+	for _, p := range []string{"/1", "/2", "/3", "/4"} {
+		require.NoError(t, l.Write(audit.Record{Client: "127.0.0.1:1234", OpCode: "CmdMkdir", Path: p, Result: audit.ResultOK}))
+	}
+	require.NoError(t, l.Close())
+
+	current := readRecords(t, path)
+	require.Len(t, current, 1)
+	assert.Equal(t, "/4", current[0].Path)
+	assert.False(t, current[0].Time.IsZero())
+
+	assert.Equal(t, "/3", readRecords(t, path+".1")[0].Path)
+	assert.Equal(t, "/2", readRecords(t, path+".2")[0].Path)
+	assert.NoFileExists(t, path+".3", "old backups must be removed")
+
+	// appending to existing file
+	l, err = audit.NewLog(path, 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, l.Write(audit.Record{OpCode: "CmdRmdir", Path: "/4", Result: audit.ResultError, Error: "not empty"}))
+	require.NoError(t, l.Close())
+
+	assert.Len(t, readRecords(t, path), 2)
+}
@@ -0,0 +1,27 @@
+// Package blockcache contains a cache for fixed-size blocks of remote files
+// and a reader that fetches data through it.
+package blockcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Cache stores blocks of remote files identified by key and block index.
+// Implementations must be safe for concurrent use.
+type Cache interface {
+	// Get copies cached block into buf and returns amount of copied bytes.
+	// It returns false if block is not present in cache.
+	Get(key string, block int64, buf []byte) (int, bool)
+
+	// Put stores block data. Cache failures are not fatal for callers so implementation only logs them.
+	Put(key string, block int64, data []byte)
+}
+
+// Key builds a filesystem-safe cache key from provided parts.
+// Parts should include everything that identifies file version (i.e. path, size and modification time).
+func Key(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,275 @@
+package blockcache
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+)
+
+const tmpPrefix = ".tmp-"
+
+type blockID struct {
+	key   string
+	block int64
+}
+
+type diskEntry struct {
+	id      blockID
+	size    int64
+	modTime time.Time // used only during load
+}
+
+// Disk is a [Cache] that stores every block in a separate file: "<dir>/<key>/<block index in hex>".
+// So only fetched blocks of file occupy disk space. Total size of blocks is capped,
+// least recently used blocks are evicted first. Recency survives restarts because block file
+// modification time is updated on every hit.
+type Disk struct {
+	dir      string
+	capacity int64
+	log      *slog.Logger
+
+	mu    sync.Mutex
+	lru   *list.List // of *diskEntry, front is most recently used
+	index map[blockID]*list.Element
+	size  int64
+}
+
+// NewDisk creates directory if necessary and loads already cached blocks from it.
+func NewDisk(dir string, capacity int64, log *slog.Logger) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache dir: %w", err)
+	}
+
+	d := &Disk{
+		dir:      dir,
+		capacity: capacity,
+		log:      log,
+		lru:      list.New(),
+		index:    make(map[blockID]*list.Element),
+	}
+
+	if err := d.load(); err != nil {
+		return nil, fmt.Errorf("load cache: %w", err)
+	}
+
+	d.mu.Lock()
+	d.evictLocked()
+	d.mu.Unlock()
+
+	return d, nil
+}
+
+func (d *Disk) load() error {
+	keyDirs, err := os.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+
+	var entries []*diskEntry
+	for _, keyDir := range keyDirs {
+		if !keyDir.IsDir() {
+			continue
+		}
+
+		blocks, err := os.ReadDir(filepath.Join(d.dir, keyDir.Name()))
+		if err != nil {
+			return err
+		}
+
+		for _, block := range blocks {
+			blockPath := filepath.Join(d.dir, keyDir.Name(), block.Name())
+			if strings.HasPrefix(block.Name(), tmpPrefix) {
+				// leftover from interrupted write
+				_ = os.Remove(blockPath)
+				continue
+			}
+
+			idx, err := strconv.ParseInt(block.Name(), 16, 64)
+			if err != nil {
+				continue
+			}
+
+			info, err := block.Info()
+			if err != nil {
+				continue
+			}
+
+			entries = append(entries, &diskEntry{
+				id:      blockID{key: keyDir.Name(), block: idx},
+				size:    info.Size(),
+				modTime: info.ModTime(),
+			})
+		}
+	}
+
+	// most recently used go to front
+	slices.SortFunc(entries, func(a, b *diskEntry) int {
+		return a.modTime.Compare(b.modTime)
+	})
+
+	for _, entry := range entries {
+		d.index[entry.id] = d.lru.PushFront(entry)
+		d.size += entry.size
+	}
+
+	d.log.Info("Block cache loaded", slog.String("dir", d.dir), slog.Int("blocks", len(entries)), slog.Int64("size", d.size))
+	return nil
+}
+
+func (d *Disk) blockPath(id blockID) string {
+	return filepath.Join(d.dir, id.key, strconv.FormatInt(id.block, 16))
+}
+
+func (d *Disk) Get(key string, block int64, buf []byte) (int, bool) {
+	id := blockID{key: key, block: block}
+
+	d.mu.Lock()
+	elem, ok := d.index[id]
+	if ok {
+		d.lru.MoveToFront(elem)
+	}
+	d.mu.Unlock()
+
+	if !ok {
+		return 0, false
+	}
+
+	path := d.blockPath(id)
+	n, err := readBlockFile(path, buf)
+	if err != nil {
+		d.log.Warn("Cached block read failed, dropping it",
+			slog.String("key", key), slog.Int64("block", block), logutil.ErrorAttr(err))
+		d.drop(id)
+		return 0, false
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(path, now, now) // keep recency for next load
+
+	return n, true
+}
+
+func readBlockFile(path string, buf []byte) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n, err := io.ReadFull(f, buf)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// last block of file may be shorter
+		err = nil
+	}
+
+	return n, err
+}
+
+func (d *Disk) Put(key string, block int64, data []byte) {
+	if int64(len(data)) > d.capacity {
+		return
+	}
+
+	id := blockID{key: key, block: block}
+	if err := d.writeBlockFile(id, data); err != nil {
+		d.log.Warn("Block cache write failed",
+			slog.String("key", key), slog.Int64("block", block), logutil.ErrorAttr(err))
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.index[id]; ok {
+		entry := elem.Value.(*diskEntry)
+		d.size += int64(len(data)) - entry.size
+		entry.size = int64(len(data))
+		d.lru.MoveToFront(elem)
+	} else {
+		d.index[id] = d.lru.PushFront(&diskEntry{id: id, size: int64(len(data))})
+		d.size += int64(len(data))
+	}
+
+	d.evictLocked()
+}
+
+func (d *Disk) writeBlockFile(id blockID, data []byte) error {
+	keyDir := filepath.Join(d.dir, id.key)
+	if err := os.MkdirAll(keyDir, 0o755); err != nil {
+		return err
+	}
+
+	// write to temporary file first to not expose partially written block
+	f, err := os.CreateTemp(keyDir, tmpPrefix+"*")
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	if err = os.Rename(f.Name(), d.blockPath(id)); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
+
+func (d *Disk) drop(id blockID) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if elem, ok := d.index[id]; ok {
+		d.removeLocked(elem)
+	}
+}
+
+func (d *Disk) evictLocked() {
+	for d.size > d.capacity {
+		elem := d.lru.Back()
+		if elem == nil {
+			return
+		}
+
+		d.removeLocked(elem)
+	}
+}
+
+func (d *Disk) removeLocked(elem *list.Element) {
+	entry := d.lru.Remove(elem).(*diskEntry)
+	delete(d.index, entry.id)
+	d.size -= entry.size
+
+	if err := os.Remove(d.blockPath(entry.id)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		d.log.Warn("Evicted block remove failed", slog.String("key", entry.id.key), logutil.ErrorAttr(err))
+	}
+
+	// remove directory of file if it has no more blocks, fails if not empty
+	_ = os.Remove(filepath.Join(d.dir, entry.id.key))
+}
+
+// Size returns total size of cached blocks.
+func (d *Disk) Size() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.size
+}
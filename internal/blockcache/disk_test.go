@@ -0,0 +1,45 @@
+package blockcache_test
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+)
+
+func TestDiskEviction(t *testing.T) {
+	dir := t.TempDir()
+
+	cache, err := blockcache.NewDisk(dir, 25, slog.Default())
+	require.NoError(t, err)
+
+	block := func(b byte) []byte { return bytes.Repeat([]byte{b}, 10) }
+
+	cache.Put("a", 0, block(0))
+	cache.Put("a", 1, block(1))
+
+	// touch block 0, so block 1 becomes least recently used
+	buf := make([]byte, 10)
+	n, ok := cache.Get("a", 0, buf)
+	require.True(t, ok)
+	assert.Equal(t, block(0), buf[:n])
+
+	cache.Put("b", 0, block(2))
+	assert.Equal(t, int64(20), cache.Size())
+
+	_, ok = cache.Get("a", 1, buf)
+	assert.False(t, ok, "least recently used block must be evicted")
+
+	// reopen cache, blocks must be loaded from disk
+	cache, err = blockcache.NewDisk(dir, 25, slog.Default())
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), cache.Size())
+
+	n, ok = cache.Get("b", 0, buf)
+	require.True(t, ok)
+	assert.Equal(t, block(2), buf[:n])
+}
@@ -0,0 +1,70 @@
+package blockcache
+
+import (
+	"container/list"
+	"sync"
+)
+
+type memoryEntry struct {
+	id   blockID
+	data []byte
+}
+
+// Memory is an in-memory [Cache] with least recently used eviction policy.
+type Memory struct {
+	capacity int64
+
+	mu    sync.Mutex
+	lru   *list.List // of *memoryEntry, front is most recently used
+	index map[blockID]*list.Element
+	size  int64
+}
+
+func NewMemory(capacity int64) *Memory {
+	return &Memory{
+		capacity: capacity,
+		lru:      list.New(),
+		index:    make(map[blockID]*list.Element),
+	}
+}
+
+func (m *Memory) Get(key string, block int64, buf []byte) (int, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.index[blockID{key: key, block: block}]
+	if !ok {
+		return 0, false
+	}
+
+	m.lru.MoveToFront(elem)
+	return copy(buf, elem.Value.(*memoryEntry).data), true
+}
+
+func (m *Memory) Put(key string, block int64, data []byte) {
+	if int64(len(data)) > m.capacity {
+		return
+	}
+
+	id := blockID{key: key, block: block}
+	data = append([]byte(nil), data...) // caller may reuse buffer
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if elem, ok := m.index[id]; ok {
+		entry := elem.Value.(*memoryEntry)
+		m.size += int64(len(data)) - int64(len(entry.data))
+		entry.data = data
+		m.lru.MoveToFront(elem)
+	} else {
+		m.index[id] = m.lru.PushFront(&memoryEntry{id: id, data: data})
+		m.size += int64(len(data))
+	}
+
+	for m.size > m.capacity {
+		entry := m.lru.Remove(m.lru.Back()).(*memoryEntry)
+		delete(m.index, entry.id)
+		m.size -= int64(len(entry.data))
+	}
+}
@@ -0,0 +1,111 @@
+package blockcache
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FetchFunc reads remote data at offset into p. It must fill p completely.
+type FetchFunc func(p []byte, off int64) error
+
+// Reader implements [io.ReadSeeker] for remote data of known size.
+// Data is fetched by blocks of fixed size, each fetched block is stored in cache.
+// Reader is not safe for concurrent use.
+type Reader struct {
+	cache     Cache // may be nil
+	key       string
+	blockSize int64
+	size      int64
+	fetch     FetchFunc
+
+	offset   int64
+	buf      []byte // holds data of block bufBlock
+	bufBlock int64
+}
+
+// NewReader constructs Reader. Cache may be nil, in this case only last fetched block is kept.
+func NewReader(cache Cache, key string, blockSize, size int64, fetch FetchFunc) *Reader {
+	return &Reader{
+		cache:     cache,
+		key:       key,
+		blockSize: blockSize,
+		size:      size,
+		fetch:     fetch,
+		buf:       make([]byte, 0, blockSize),
+		bufBlock:  -1,
+	}
+}
+
+func (r *Reader) loadBlock(block int64) ([]byte, error) {
+	if r.bufBlock == block {
+		return r.buf, nil
+	}
+
+	blockLen := min(r.blockSize, r.size-block*r.blockSize)
+	r.buf = r.buf[:blockLen]
+	r.bufBlock = -1
+
+	if r.cache != nil {
+		if n, ok := r.cache.Get(r.key, block, r.buf); ok && int64(n) == blockLen {
+			r.bufBlock = block
+			return r.buf, nil
+		}
+	}
+
+	if err := r.fetch(r.buf, block*r.blockSize); err != nil {
+		return nil, fmt.Errorf("fetch block %d: %w", block, err)
+	}
+
+	if r.cache != nil {
+		r.cache.Put(r.key, block, r.buf)
+	}
+
+	r.bufBlock = block
+	return r.buf, nil
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+
+	var read int
+	for read < len(p) && r.offset < r.size {
+		block := r.offset / r.blockSize
+		data, err := r.loadBlock(block)
+		if err != nil {
+			return read, err
+		}
+
+		n := copy(p[read:], data[r.offset-block*r.blockSize:])
+		read += n
+		r.offset += int64(n)
+	}
+
+	return read, nil
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	r.offset = offset
+	return offset, nil
+}
+
+// Size returns size of remote data.
+func (r *Reader) Size() int64 {
+	return r.size
+}
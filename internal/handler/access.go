@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/accesslog"
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+)
+
+// accessSession accumulates statistics of client connection for access log.
+type accessSession struct {
+	log    *accesslog.Log
+	client string
+	start  time.Time
+
+	files int
+	bytes int64
+	reads int64
+}
+
+func (s *accessSession) close() {
+	err := s.log.WriteSession(accesslog.SessionRecord{
+		Time:     s.start,
+		Client:   s.client,
+		Files:    s.files,
+		Bytes:    s.bytes,
+		Reads:    s.reads,
+		Duration: time.Since(s.start),
+	})
+	if err != nil {
+		slog.Error("Access log write failed", logutil.ErrorAttr(err))
+	}
+}
+
+// accessFile collects read statistics of file for access log. Record is written when file is closed.
+type accessFile struct {
+	File
+
+	session *accessSession
+	path    string
+	opened  time.Time
+
+	bytes      int64
+	reads      int64
+	sequential int64
+	nextOffset int64
+}
+
+func (s *accessSession) wrap(f File, path string) *accessFile {
+	return &accessFile{
+		File:    f,
+		session: s,
+		path:    path,
+		opened:  time.Now(),
+	}
+}
+
+// read accounts single read command covering size bytes of file starting from offset.
+func (f *accessFile) read(offset, size, served int64) {
+	if f.reads > 0 && offset == f.nextOffset {
+		f.sequential++
+	}
+
+	f.reads++
+	f.bytes += served
+	f.nextOffset = offset + size
+}
+
+func (f *accessFile) Close() error {
+	err := f.File.Close()
+
+	rec := accesslog.FileRecord{
+		Time:       f.opened,
+		Client:     f.session.client,
+		Path:       f.path,
+		Bytes:      f.bytes,
+		Reads:      f.reads,
+		Sequential: 100,
+		Duration:   time.Since(f.opened),
+	}
+	if ff, ok := FileAsType[FormattedFile](f.File); ok {
+		rec.Format = ff.Format()
+	}
+	if f.reads > 1 {
+		rec.Sequential = float64(f.sequential) * 100 / float64(f.reads-1)
+	}
+
+	if logErr := f.session.log.WriteFile(rec); logErr != nil {
+		slog.Error("Access log write failed", logutil.ErrorAttr(logErr))
+	}
+
+	f.session.files++
+	f.session.bytes += f.bytes
+	f.session.reads += f.reads
+
+	return err
+}
+
+func (f *accessFile) Unwrap() File {
+	return f.File
+}
+
+// accountRead adds read command to access statistics of currently open file.
+// Size is a length of read file region, served is amount of bytes sent to client.
+func accountRead(ctx *Context, offset, size, served int64) {
+	if af, ok := ctx.State.ROFile.(*accessFile); ok {
+		af.read(offset, size, served)
+	}
+}
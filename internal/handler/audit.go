@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/xakep666/ps3netsrv-go/internal/audit"
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+	"github.com/xakep666/ps3netsrv-go/pkg/proto"
+)
+
+func (h *Handler) audit(ctx *Context, opCode proto.OpCode, path string, written int64, err error) {
+	if h.AuditLog == nil {
+		return
+	}
+
+	rec := audit.Record{
+		Client: ctx.RemoteAddr.String(),
+		OpCode: opCode.String(),
+		Path:   path,
+		Bytes:  written,
+		Result: audit.ResultOK,
+	}
+	switch {
+	case errors.Is(err, ErrWriteForbidden):
+		rec.Result = audit.ResultForbidden
+		rec.Error = err.Error()
+	case err != nil:
+		rec.Result = audit.ResultError
+		rec.Error = err.Error()
+	}
+
+	if err := h.AuditLog.Write(rec); err != nil {
+		slog.ErrorContext(ctx, "Audit log write failed", logutil.ErrorAttr(err))
+	}
+}
+
+// trackedFile counts data written to file to report it (i.e. to audit log) once file is closed.
+type trackedFile struct {
+	WritableFile
+
+	written int64
+	err     error
+	onClose func(written int64, err error)
+}
+
+func (f *trackedFile) Write(p []byte) (int, error) {
+	n, err := f.WritableFile.Write(p)
+	f.written += int64(n)
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+
+	return n, err
+}
+
+func (f *trackedFile) Close() error {
+	err := f.WritableFile.Close()
+	if err != nil && f.err == nil {
+		f.err = err
+	}
+
+	f.onClose(f.written, f.err)
+	return err
+}
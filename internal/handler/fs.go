@@ -14,6 +14,12 @@ type File interface {
 	Name() string
 }
 
+// FormattedFile is a file transformed by filesystem, i.e. decompressed or decrypted.
+type FormattedFile interface {
+	File
+	Format() []string // names of applied openers and wrappers
+}
+
 type WritableFile interface {
 	File
 	io.Writer
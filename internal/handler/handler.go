@@ -11,9 +11,15 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/xakep666/ps3netsrv-go/internal/accesslog"
+	"github.com/xakep666/ps3netsrv-go/internal/audit"
+	"github.com/xakep666/ps3netsrv-go/internal/hooks"
 	"github.com/xakep666/ps3netsrv-go/internal/ioutil"
 	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+	"github.com/xakep666/ps3netsrv-go/internal/playhistory"
+	"github.com/xakep666/ps3netsrv-go/pkg/proto"
 	"github.com/xakep666/ps3netsrv-go/pkg/server"
 )
 
@@ -29,9 +35,51 @@ type Handler struct {
 	Copier     *ioutil.Copier
 	AllowWrite bool
 	OnConnect  func(ctx *Context) error
+
+	// WriteAllowed optionally overrides AllowWrite if write access may be changed while serving.
+	WriteAllowed func() bool
+
+	// AuditLog optionally records modifying operations.
+	AuditLog *audit.Log
+
+	// AccessLog optionally records served files and client sessions.
+	AccessLog *accesslog.Log
+
+	// Hooks optionally runs commands on events.
+	Hooks *hooks.Runner
+
+	// PlayHistory optionally records games played by clients.
+	PlayHistory *playhistory.Store
+}
+
+func (h *Handler) writeAllowed() bool {
+	if h.WriteAllowed != nil {
+		return h.WriteAllowed()
+	}
+
+	return h.AllowWrite
 }
 
 func (h *Handler) Init(ctx *Context) error {
+	client := ctx.RemoteAddr.String()
+
+	if h.AccessLog != nil {
+		session := &accessSession{
+			log:    h.AccessLog,
+			client: client,
+			start:  time.Now(),
+		}
+		ctx.State.access = session
+		ctx.State.onClose = append(ctx.State.onClose, session.close)
+	}
+
+	if h.Hooks != nil {
+		h.Hooks.Fire(hooks.Event{Type: hooks.EventConnect, Client: client})
+		ctx.State.onClose = append(ctx.State.onClose, func() {
+			h.Hooks.Fire(hooks.Event{Type: hooks.EventDisconnect, Client: client})
+		})
+	}
+
 	if h.OnConnect != nil {
 		if err := h.OnConnect(ctx); err != nil {
 			return err
@@ -242,15 +290,35 @@ func (h *Handler) HandleOpenFile(ctx *Context, path string) (fs.FileInfo, error)
 		return nil, err
 	}
 
-	ctx.State.ROFile = f
-	ctx.State.CDSectorSize = 2352 // default sector size
+	h.Hooks.Fire(hooks.Event{Type: hooks.EventFileOpen, Client: ctx.RemoteAddr.String(), Path: path})
 
 	fi, err := f.Stat()
 	if err != nil {
 		log.WarnContext(ctx, "Stat failed", logutil.ErrorAttr(err))
+		_ = f.Close()
 		return nil, err
 	}
 
+	// title id is read at close, so opening of files which are not played isn't slowed down
+	if game, ok := h.PlayHistory.Game(path); ok && !fi.IsDir() {
+		f = &playedFile{
+			File:    f,
+			history: h.PlayHistory,
+			session: playhistory.Session{
+				Game:   game,
+				Client: ctx.RemoteAddr.String(),
+				Start:  time.Now(),
+			},
+		}
+	}
+
+	if ctx.State.access != nil {
+		f = ctx.State.access.wrap(f, path)
+	}
+
+	ctx.State.ROFile = f
+	ctx.State.CDSectorSize = 2352 // default sector size
+
 	// if file size between 2Mb and 848Mb we should try to detect sector size
 	if fi.Size() >= 0x200000 && fi.Size() <= 0x35000000 {
 		sectorSize, err := determineSectorSize(f)
@@ -303,6 +371,7 @@ func (h *Handler) HandleReadFile(ctx *Context, limit uint32, offset uint64, wr s
 	}
 
 	log.DebugContext(ctx, "Read file completed", slog.Int64("read", n))
+	accountRead(ctx, int64(offset), n, n)
 
 	wr.WriteHeader(int32(n))
 	_, err = buf.WriteTo(wr)
@@ -320,7 +389,8 @@ func (h *Handler) HandleReadFileCritical(ctx *Context, limit uint32, offset uint
 		return fmt.Errorf("seek failed: %w", err)
 	}
 
-	_, err := h.Copier.CopyN(w, ctx.State.ROFile, int64(limit))
+	n, err := h.Copier.CopyN(w, ctx.State.ROFile, int64(limit))
+	accountRead(ctx, int64(offset), n, n)
 	return err
 }
 
@@ -342,6 +412,10 @@ func (h *Handler) HandleReadCD2048Critical(ctx *Context, startSector, sectorsCou
 
 	// this command treats sectors as 2048-sized, so if sector size is non-standard, we must skip some bytes at the end
 	offset := psxPrefixSize + int64(startSector)*int64(ctx.State.CDSectorSize)
+	defer func(start int64) {
+		sectors := (offset - start) / int64(ctx.State.CDSectorSize)
+		accountRead(ctx, start, offset-start, sectors*readSize)
+	}(offset)
 	for range sectorsCount {
 		_, err := ctx.State.ROFile.Seek(offset, io.SeekStart)
 		if err != nil {
@@ -363,17 +437,21 @@ func (h *Handler) HandleCreateFile(ctx *Context, path string) error {
 	log := slog.With(slog.String("path", path))
 	log.DebugContext(ctx, "Create file")
 
-	if !h.AllowWrite {
+	if !h.writeAllowed() {
 		log.WarnContext(ctx, "Modifying operation forbidden", slog.String("op", "create"))
+		h.audit(ctx, proto.CmdCreateFile, path, 0, ErrWriteForbidden)
 		return ErrWriteForbidden
 	}
 
 	if ctx.State.WOFile != nil {
-		if err := ctx.State.WOFile.Close(); err != nil {
+		err := ctx.State.WOFile.Close()
+		ctx.State.WOFile = nil
+		if err != nil {
+			// some roots (i.e. S3) store data on close, so client must know that written file is lost
 			log.WarnContext(ctx, "Close already opened W/O file failed", logutil.ErrorAttr(err))
+			h.audit(ctx, proto.CmdCreateFile, path, 0, err)
+			return err
 		}
-
-		ctx.State.WOFile = nil
 	}
 
 	// path is a directory -> closing file, just return
@@ -383,15 +461,29 @@ func (h *Handler) HandleCreateFile(ctx *Context, path string) error {
 	}
 	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.WarnContext(ctx, "Stat failed", logutil.ErrorAttr(err))
+		h.audit(ctx, proto.CmdCreateFile, path, 0, err)
 		return err
 	}
 
 	f, err := h.Fs.Create(ctx, filepath.FromSlash(path))
+	h.audit(ctx, proto.CmdCreateFile, path, 0, err)
 	if err != nil {
 		log.WarnContext(ctx, "Create file failed", logutil.ErrorAttr(err))
 		return err
 	}
 
+	if h.AuditLog != nil || h.Hooks != nil {
+		f = &trackedFile{
+			WritableFile: f,
+			onClose: func(written int64, err error) {
+				h.audit(ctx, proto.CmdWriteFile, path, written, err)
+				if err == nil {
+					h.Hooks.Fire(hooks.Event{Type: hooks.EventUploadComplete, Client: ctx.RemoteAddr.String(), Path: path, Bytes: written})
+				}
+			},
+		}
+	}
+
 	ctx.State.WOFile = f
 	return nil
 }
@@ -399,14 +491,17 @@ func (h *Handler) HandleCreateFile(ctx *Context, path string) error {
 func (h *Handler) HandleWriteFile(ctx *Context, data io.Reader) (int32, error) {
 	slog.DebugContext(ctx, "Write file")
 
-	if !h.AllowWrite {
+	if !h.writeAllowed() {
 		slog.WarnContext(ctx, "Modifying operation forbidden", slog.String("op", "write"))
+		h.audit(ctx, proto.CmdWriteFile, "", 0, ErrWriteForbidden)
 		return 0, ErrWriteForbidden
 	}
 
 	if ctx.State.WOFile == nil {
 		slog.WarnContext(ctx, "File for writing was not opened")
-		return 0, fmt.Errorf("file for writing was not opened")
+		err := fmt.Errorf("file for writing was not opened")
+		h.audit(ctx, proto.CmdWriteFile, "", 0, err)
+		return 0, err
 	}
 
 	written, err := h.Copier.Copy(ctx.State.WOFile, data)
@@ -424,16 +519,21 @@ func (h *Handler) HandleDeleteFile(ctx *Context, path string) error {
 	log := slog.With(slog.String("path", path))
 	log.DebugContext(ctx, "Delete file")
 
-	if !h.AllowWrite {
+	if !h.writeAllowed() {
 		log.WarnContext(ctx, "Modifying operation forbidden", slog.String("op", "rm"))
+		h.audit(ctx, proto.CmdDeleteFile, path, 0, ErrWriteForbidden)
 		return ErrWriteForbidden
 	}
 
-	if err := h.Fs.Remove(ctx, filepath.FromSlash(path)); err != nil {
+	err := h.Fs.Remove(ctx, filepath.FromSlash(path))
+	h.audit(ctx, proto.CmdDeleteFile, path, 0, err)
+	if err != nil {
 		log.WarnContext(ctx, "Remove file failed", logutil.ErrorAttr(err))
 		return err
 	}
 
+	h.Hooks.Fire(hooks.Event{Type: hooks.EventDelete, Client: ctx.RemoteAddr.String(), Path: path})
+
 	return nil
 }
 
@@ -441,12 +541,15 @@ func (h *Handler) HandleMkdir(ctx *Context, path string) error {
 	log := slog.With(slog.String("path", path))
 	log.DebugContext(ctx, "Create directory")
 
-	if !h.AllowWrite {
+	if !h.writeAllowed() {
 		log.WarnContext(ctx, "Modifying operation forbidden", slog.String("op", "mkdir"))
+		h.audit(ctx, proto.CmdMkdir, path, 0, ErrWriteForbidden)
 		return ErrWriteForbidden
 	}
 
-	if err := h.Fs.Mkdir(ctx, filepath.FromSlash(path), os.ModePerm); err != nil {
+	err := h.Fs.Mkdir(ctx, filepath.FromSlash(path), os.ModePerm)
+	h.audit(ctx, proto.CmdMkdir, path, 0, err)
+	if err != nil {
 		log.WarnContext(ctx, "Create directory failed", logutil.ErrorAttr(err))
 		return err
 	}
@@ -458,12 +561,15 @@ func (h *Handler) HandleRmdir(ctx *Context, path string) error {
 	log := slog.With(slog.String("path", path))
 	log.DebugContext(ctx, "Remove directory")
 
-	if !h.AllowWrite {
+	if !h.writeAllowed() {
 		log.WarnContext(ctx, "Modifying operation forbidden", slog.String("op", "rmdir"))
+		h.audit(ctx, proto.CmdRmdir, path, 0, ErrWriteForbidden)
 		return ErrWriteForbidden
 	}
 
-	if err := h.Fs.Remove(ctx, filepath.FromSlash(path)); err != nil {
+	err := h.Fs.Remove(ctx, filepath.FromSlash(path))
+	h.audit(ctx, proto.CmdRmdir, path, 0, err)
+	if err != nil {
 		log.WarnContext(ctx, "Remove directory failed", logutil.ErrorAttr(err))
 		return err
 	}
@@ -0,0 +1,34 @@
+package handler
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+	"github.com/xakep666/ps3netsrv-go/internal/playhistory"
+)
+
+// playedFile records play session to history when game file is closed.
+type playedFile struct {
+	File
+
+	history *playhistory.Store
+	session playhistory.Session
+}
+
+func (f *playedFile) Close() error {
+	f.session.End = time.Now()
+	f.session.TitleID = iso9660.TitleID(f.File)
+
+	err := f.File.Close()
+	if histErr := f.history.Add(f.session); histErr != nil {
+		slog.Error("Play history write failed", logutil.ErrorAttr(histErr))
+	}
+
+	return err
+}
+
+func (f *playedFile) Unwrap() File {
+	return f.File
+}
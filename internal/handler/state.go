@@ -13,6 +13,9 @@ type State struct {
 	WOFile       WritableFile
 
 	OnClose func() error
+
+	access  *accessSession // not nil if access log enabled
+	onClose []func()       // internal callbacks called before OnClose
 }
 
 func (s *State) Close() error {
@@ -44,6 +47,12 @@ func (s *State) Close() error {
 
 	s.CDSectorSize = 0
 
+	for _, fn := range s.onClose {
+		fn()
+	}
+	s.onClose = nil
+	s.access = nil
+
 	if s.OnClose != nil {
 		if err := s.OnClose(); err != nil {
 			errs = append(errs, fmt.Errorf("OnClose error: %w", err))
@@ -0,0 +1,248 @@
+// Package handoff passes listening sockets to a new process, i.e. for binary upgrade without dropping connections.
+// Parent process starts a child with listeners as inherited file descriptors and waits until child reports readiness.
+// Then parent stops accepting connections and exits after serving existing ones while child accepts new connections.
+package handoff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	listenersEnv = "PS3NETSRV_HANDOFF_LISTENERS"
+	readyFDEnv   = "PS3NETSRV_HANDOFF_READY_FD"
+)
+
+// ErrNotReady returned if child process exited or failed before reporting readiness.
+var ErrNotReady = errors.New("child process didn't become ready")
+
+type filer interface {
+	File() (*os.File, error)
+}
+
+// Handoff tracks listeners by address they were made for. It also holds listeners inherited from parent process.
+type Handoff struct {
+	mu        sync.Mutex
+	inherited map[string][]net.Listener
+	listeners map[string][]net.Listener
+	addrs     []string
+	child     bool
+	ready     *os.File
+}
+
+// New makes Handoff and takes listeners passed by parent process if any.
+func New() (*Handoff, error) {
+	h := &Handoff{
+		inherited: make(map[string][]net.Listener),
+		listeners: make(map[string][]net.Listener),
+	}
+
+	defer func() {
+		// prevent usage by further child processes
+		_ = os.Unsetenv(listenersEnv)
+		_ = os.Unsetenv(readyFDEnv)
+	}()
+
+	if readyFD, ok := os.LookupEnv(readyFDEnv); ok {
+		fd, err := strconv.Atoi(readyFD)
+		if err != nil {
+			return nil, fmt.Errorf("parse ready fd: %w", err)
+		}
+
+		h.ready = os.NewFile(uintptr(fd), "handoff-ready")
+		h.child = true
+	}
+
+	listenersValue, ok := os.LookupEnv(listenersEnv)
+	if !ok {
+		return h, nil
+	}
+
+	var fds map[string][]int
+	if err := json.Unmarshal([]byte(listenersValue), &fds); err != nil {
+		return nil, fmt.Errorf("parse inherited listeners: %w", err)
+	}
+
+	for addr, addrFDs := range fds {
+		for _, fd := range addrFDs {
+			f := os.NewFile(uintptr(fd), addr)
+			ln, err := net.FileListener(f)
+			_ = f.Close() // FileListener duplicates descriptor
+			if err != nil {
+				h.closeInherited()
+				return nil, fmt.Errorf("inherited listener %q: %w", addr, err)
+			}
+
+			h.inherited[addr] = append(h.inherited[addr], ln)
+		}
+	}
+
+	return h, nil
+}
+
+// Inherited tells if process was started by parent passing listeners.
+func (h *Handoff) Inherited() bool {
+	return h.child
+}
+
+// Listen returns listeners inherited for provided address or makes them with listen function.
+// Returned listeners are passed to child process on Upgrade.
+func (h *Handoff) Listen(addr string, listen func(addr string) ([]net.Listener, error)) ([]net.Listener, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	listeners, ok := h.inherited[addr]
+	if ok {
+		delete(h.inherited, addr)
+	} else {
+		var err error
+		listeners, err = listen(addr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, exists := h.listeners[addr]; !exists {
+		h.addrs = append(h.addrs, addr)
+	}
+	h.listeners[addr] = append(h.listeners[addr], listeners...)
+
+	return slices.Clone(listeners), nil
+}
+
+// Ready closes inherited listeners which were not requested, i.e. if address was removed from configuration,
+// and reports readiness to parent process.
+func (h *Handoff) Ready() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closeInherited()
+
+	if h.ready == nil {
+		return nil
+	}
+
+	defer func() {
+		_ = h.ready.Close()
+		h.ready = nil
+	}()
+
+	if _, err := h.ready.Write([]byte{1}); err != nil {
+		return fmt.Errorf("notify parent: %w", err)
+	}
+
+	return nil
+}
+
+func (h *Handoff) closeInherited() {
+	for addr, listeners := range h.inherited {
+		for _, ln := range listeners {
+			_ = ln.Close()
+		}
+		delete(h.inherited, addr)
+	}
+}
+
+// Upgrade starts cmd passing all listeners made by Listen to it and waits until it calls Ready.
+// Process is killed if it didn't become ready until ctx expiration.
+// After successful upgrade unix sockets are not removed on listener close because child still uses them.
+func (h *Handoff) Upgrade(ctx context.Context, cmd *exec.Cmd) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fds := make(map[string][]int, len(h.listeners))
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			_ = f.Close()
+		}
+	}()
+
+	const firstExtraFD = 3 // after stdin, stdout and stderr
+	for _, addr := range h.addrs {
+		for _, ln := range h.listeners[addr] {
+			lf, ok := ln.(filer)
+			if !ok {
+				return fmt.Errorf("listener %q: %w", addr, errors.ErrUnsupported)
+			}
+
+			f, err := lf.File()
+			if err != nil {
+				return fmt.Errorf("listener %q file: %w", addr, err)
+			}
+
+			files = append(files, f)
+			fds[addr] = append(fds[addr], firstExtraFD+len(cmd.ExtraFiles)+len(files)-1)
+		}
+	}
+
+	fdsValue, err := json.Marshal(fds)
+	if err != nil {
+		return fmt.Errorf("marshal listeners: %w", err)
+	}
+
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("ready pipe: %w", err)
+	}
+	defer readyR.Close()
+	files = append(files, readyW)
+
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	cmd.Env = slices.DeleteFunc(cmd.Env, func(kv string) bool {
+		return strings.HasPrefix(kv, listenersEnv+"=") || strings.HasPrefix(kv, readyFDEnv+"=")
+	})
+	cmd.Env = append(cmd.Env,
+		listenersEnv+"="+string(fdsValue),
+		readyFDEnv+"="+strconv.Itoa(firstExtraFD+len(cmd.ExtraFiles)+len(files)-1),
+	)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, files...)
+
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start child: %w", err)
+	}
+
+	// close our copy of write end, so read returns EOF if child exits without reporting readiness
+	_ = readyW.Close()
+
+	readyErr := make(chan error, 1)
+	go func() {
+		var b [1]byte
+		_, err := io.ReadFull(readyR, b[:])
+		readyErr <- err
+	}()
+
+	select {
+	case err = <-readyErr:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return fmt.Errorf("%w: %w", ErrNotReady, err)
+	}
+
+	for _, listeners := range h.listeners {
+		for _, ln := range listeners {
+			if ul, ok := ln.(*net.UnixListener); ok {
+				ul.SetUnlinkOnClose(false)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,117 @@
+package handoff_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handoff"
+)
+
+const (
+	childModeEnv = "HANDOFF_TEST_CHILD"
+	testAddr     = "test-addr"
+)
+
+// TestMain runs test binary as child process if requested.
+func TestMain(m *testing.M) {
+	switch os.Getenv(childModeEnv) {
+	case "":
+		os.Exit(m.Run())
+	case "serve":
+		os.Exit(serveChild())
+	case "fail":
+		os.Exit(1) // exit without reporting readiness
+	}
+}
+
+// serveChild accepts single connection on inherited listener and writes greeting.
+func serveChild() int {
+	h, err := handoff.New()
+	if err != nil || !h.Inherited() {
+		return 2
+	}
+
+	listeners, err := h.Listen(testAddr, func(string) ([]net.Listener, error) {
+		return nil, io.ErrUnexpectedEOF // must not be called
+	})
+	if err != nil || len(listeners) != 1 {
+		return 3
+	}
+
+	if err = h.Ready(); err != nil {
+		return 4
+	}
+
+	conn, err := listeners[0].Accept()
+	if err != nil {
+		return 5
+	}
+	defer conn.Close()
+
+	_, _ = io.WriteString(conn, "hello from child")
+	return 0
+}
+
+func listen(t *testing.T) (*handoff.Handoff, string) {
+	t.Helper()
+
+	h, err := handoff.New()
+	require.NoError(t, err)
+	assert.False(t, h.Inherited())
+
+	listeners, err := h.Listen(testAddr, func(string) ([]net.Listener, error) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{ln}, nil
+	})
+	require.NoError(t, err)
+	require.Len(t, listeners, 1)
+	t.Cleanup(func() { _ = listeners[0].Close() })
+
+	return h, listeners[0].Addr().String()
+}
+
+func childCommand(mode string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), childModeEnv+"="+mode)
+	cmd.Stderr = os.Stderr
+	return cmd
+}
+
+func TestUpgrade(t *testing.T) {
+	h, addr := listen(t)
+
+	cmd := childCommand("serve")
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	defer cancel()
+
+	require.NoError(t, h.Upgrade(ctx, cmd))
+	t.Cleanup(func() { _ = cmd.Process.Kill() })
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	greeting, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, "hello from child", string(greeting))
+
+	require.NoError(t, cmd.Wait())
+}
+
+func TestUpgradeChildFailed(t *testing.T) {
+	h, _ := listen(t)
+
+	err := h.Upgrade(t.Context(), childCommand("fail"))
+	assert.ErrorIs(t, err, handoff.ErrNotReady)
+}
@@ -0,0 +1,177 @@
+// Package hooks runs local commands on server events, i.e. to rescan catalog after upload or send a notification.
+// Event data is passed to command in environment variables and as JSON object on stdin.
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+)
+
+// Event types.
+const (
+	EventConnect        = "connect"
+	EventDisconnect     = "disconnect"
+	EventFileOpen       = "file-open"
+	EventUploadComplete = "upload-complete"
+	EventDelete         = "delete"
+	EventIdleShutdown   = "idle-shutdown"
+)
+
+// Events lists all supported event types.
+var Events = []string{EventConnect, EventDisconnect, EventFileOpen, EventUploadComplete, EventDelete, EventIdleShutdown}
+
+// queueSize limits amount of events waiting for free slot. Events are dropped when queue is full.
+const queueSize = 128
+
+// Event describes what happened.
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Client string    `json:"client,omitempty"`
+	Path   string    `json:"path,omitempty"`
+	Bytes  int64     `json:"bytes,omitempty"` // size of uploaded data
+}
+
+func (e *Event) environ() []string {
+	env := []string{
+		"PS3NETSRV_EVENT=" + e.Type,
+		"PS3NETSRV_EVENT_TIME=" + e.Time.Format(time.RFC3339Nano),
+	}
+	if e.Client != "" {
+		env = append(env, "PS3NETSRV_CLIENT="+e.Client)
+	}
+	if e.Path != "" {
+		env = append(env, "PS3NETSRV_PATH="+e.Path)
+	}
+	if e.Type == EventUploadComplete {
+		env = append(env, "PS3NETSRV_BYTES="+strconv.FormatInt(e.Bytes, 10))
+	}
+
+	return env
+}
+
+// Runner executes commands configured for events. Commands are run asynchronously with limited concurrency.
+// Nil Runner ignores events.
+type Runner struct {
+	commands map[string]string
+	timeout  time.Duration
+
+	mu     sync.Mutex
+	queue  chan Event
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewRunner makes Runner executing commands (event type to shell command) with provided timeout.
+// Zero or negative timeout means no timeout.
+func NewRunner(commands map[string]string, timeout time.Duration, concurrency int) (*Runner, error) {
+	for event := range commands {
+		if !slices.Contains(Events, event) {
+			return nil, fmt.Errorf("unknown hook event %q, supported: %v", event, Events)
+		}
+	}
+
+	r := &Runner{
+		commands: commands,
+		timeout:  timeout,
+		queue:    make(chan Event, queueSize),
+	}
+
+	for range max(concurrency, 1) {
+		r.wg.Go(r.worker)
+	}
+
+	return r, nil
+}
+
+// Fire schedules command for event if it's configured. Event time is set to current if empty.
+// It doesn't wait for command execution.
+func (r *Runner) Fire(ev Event) {
+	if r == nil {
+		return
+	}
+
+	if _, ok := r.commands[ev.Type]; !ok {
+		return
+	}
+
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return
+	}
+
+	select {
+	case r.queue <- ev:
+	default:
+		slog.Warn("Too many pending hooks, event dropped", slog.String("event", ev.Type))
+	}
+}
+
+// Close stops accepting events and waits until scheduled commands finish.
+func (r *Runner) Close() {
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+}
+
+func (r *Runner) worker() {
+	for ev := range r.queue {
+		r.run(ev)
+	}
+}
+
+func (r *Runner) run(ev Event) {
+	log := slog.With(slog.String("event", ev.Type))
+
+	input, err := json.Marshal(ev)
+	if err != nil {
+		log.Error("Hook event marshal failed", logutil.ErrorAttr(err))
+		return
+	}
+
+	ctx := context.Background()
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	cmd := shellCommand(ctx, r.commands[ev.Type])
+	cmd.Env = append(os.Environ(), ev.environ()...)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.WaitDelay = time.Second // don't wait for background processes holding output
+
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		log.Warn("Hook failed", logutil.ErrorAttr(err), slog.String("output", string(output)))
+		return
+	}
+
+	log.Debug("Hook completed", slog.Duration("duration", time.Since(start)), slog.String("output", string(output)))
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+
+package hooks_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/hooks"
+)
+
+func TestRunner(t *testing.T) {
+	dir := t.TempDir()
+
+	r, err := hooks.NewRunner(map[string]string{
+		hooks.EventUploadComplete: `echo "$PS3NETSRV_PATH $PS3NETSRV_BYTES" > "` + filepath.Join(dir, "env") + `"; cat > "` + filepath.Join(dir, "stdin") + `"`,
+		hooks.EventDelete:         "sleep 10",
+	}, time.Second, 2)
+	require.NoError(t, err)
+
+	r.Fire(hooks.Event{Type: hooks.EventUploadComplete, Client: "127.0.0.1:1234", Path: "/PS3ISO/game.iso", Bytes: 42})
+	r.Fire(hooks.Event{Type: hooks.EventDelete, Path: "/PS3ISO/game.iso"})
+	r.Fire(hooks.Event{Type: hooks.EventConnect}) // not configured
+
+	start := time.Now()
+	r.Close()
+	assert.Less(t, time.Since(start), 5*time.Second, "command must be killed after timeout")
+
+	env, err := os.ReadFile(filepath.Join(dir, "env"))
+	require.NoError(t, err)
+	assert.Equal(t, "/PS3ISO/game.iso 42\n", string(env))
+
+	stdin, err := os.ReadFile(filepath.Join(dir, "stdin"))
+	require.NoError(t, err)
+
+	var ev hooks.Event
+	require.NoError(t, json.Unmarshal(stdin, &ev))
+	assert.Equal(t, hooks.EventUploadComplete, ev.Type)
+	assert.Equal(t, "127.0.0.1:1234", ev.Client)
+	assert.False(t, ev.Time.IsZero())
+
+	_, err = hooks.NewRunner(map[string]string{"unknown": "true"}, 0, 1)
+	assert.Error(t, err)
+}
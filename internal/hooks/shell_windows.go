@@ -0,0 +1,14 @@
+package hooks
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "cmd.exe")
+	// pass command line as-is because cmd.exe has own quoting rules
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `cmd.exe /S /C "` + command + `"`}
+	return cmd
+}
@@ -0,0 +1,360 @@
+package iso9660
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/unicode"
+)
+
+const (
+	directoryEntryFixedSize = 33
+	maxVolumeDescriptors    = 64       // sanity limit for descriptors set
+	maxDirectorySize        = 16 << 20 // sanity limit for directory extent, enough for tens of thousands records
+)
+
+// ErrNotISO9660 occurs when image doesn't contain iso9660 volume descriptors.
+var ErrNotISO9660 = errors.New("not an iso9660 image")
+
+// DecodeDirectoryEntry decodes directory record placed in the beginning of data.
+// Zero returned size means that no more records in current sector (rest of sector is zero-padded).
+func DecodeDirectoryEntry(data []byte) (DirectoryEntry, SizeBytes, error) {
+	if len(data) == 0 || data[0] == 0 {
+		return DirectoryEntry{}, 0, nil
+	}
+
+	recordLen := int(data[0])
+	if recordLen < directoryEntryFixedSize || recordLen > len(data) {
+		return DirectoryEntry{}, 0, fmt.Errorf("invalid directory record length %d", recordLen)
+	}
+
+	identifierLen := int(data[32])
+	identifierEnd := directoryEntryFixedSize + identifierLen
+	if identifierEnd > recordLen {
+		return DirectoryEntry{}, 0, fmt.Errorf("directory record identifier length %d exceeds record", identifierLen)
+	}
+
+	systemUseStart := identifierEnd + (identifierLen+1)%2 // identifier padded to even length
+
+	return DirectoryEntry{
+		FixedDirectoryEntry: FixedDirectoryEntry{
+			ExtendedAttributeRecordLength: data[1],
+			ExtentLocation:                SizeSectors(binary.LittleEndian.Uint32(data[2:])),
+			ExtentLength:                  SizeBytes(binary.LittleEndian.Uint32(data[10:])),
+			RecordingDateTime:             decodeRecordingTimestamp(data[18:25]),
+			FileFlags:                     data[25],
+			InterleaveSize:                data[26],
+			InterleaveSkip:                data[27],
+			VolumeSequenceNumber:          binary.LittleEndian.Uint16(data[28:]),
+			Identifier:                    StringD1(data[directoryEntryFixedSize:identifierEnd]),
+		},
+		SystemUse: data[min(systemUseStart, recordLen):recordLen],
+	}, SizeBytes(recordLen), nil
+}
+
+func decodeRecordingTimestamp(data []byte) RecordingTimestamp {
+	loc := time.FixedZone("", int(int8(data[6]))*15*60)
+	return RecordingTimestamp(time.Date(int(data[0])+1900, time.Month(data[1]), int(data[2]),
+		int(data[3]), int(data[4]), int(data[5]), 0, loc))
+}
+
+func decodeVolumeDescriptorTimestamp(data []byte) VolumeDescriptorTimestamp {
+	digits := func(s []byte) int {
+		ret := 0
+		for _, c := range s {
+			if c < '0' || c > '9' {
+				return 0
+			}
+			ret = ret*10 + int(c-'0')
+		}
+		return ret
+	}
+
+	return VolumeDescriptorTimestamp{
+		Year:      digits(data[0:4]),
+		Month:     digits(data[4:6]),
+		Day:       digits(data[6:8]),
+		Hour:      digits(data[8:10]),
+		Minute:    digits(data[10:12]),
+		Second:    digits(data[12:14]),
+		Hundredth: digits(data[14:16]),
+		Offset:    int(int8(data[16])),
+	}
+}
+
+// Time converts timestamp to time.Time. Zero time returned if timestamp is not specified.
+func (ts VolumeDescriptorTimestamp) Time() time.Time {
+	if ts.Year == 0 {
+		return time.Time{}
+	}
+
+	return time.Date(ts.Year, time.Month(ts.Month), ts.Day, ts.Hour, ts.Minute, ts.Second, ts.Hundredth*10_000_000,
+		time.FixedZone("", ts.Offset*15*60))
+}
+
+// DecodeVolumeDescriptor decodes volume descriptor sector.
+// Body is decoded only for primary and supplementary descriptors.
+func DecodeVolumeDescriptor(sector []byte) (VolumeDescriptor, error) {
+	if len(sector) < int(SectorSize) {
+		return VolumeDescriptor{}, io.ErrUnexpectedEOF
+	}
+
+	vd := VolumeDescriptor{
+		Header: VolumeDescriptorHeader{
+			Type:       sector[0],
+			Identifier: [5]byte(sector[1:6]),
+			Version:    sector[6],
+		},
+	}
+	if vd.Header.Identifier != StandardIdentifierBytes {
+		return VolumeDescriptor{}, ErrNotISO9660
+	}
+
+	if vd.Header.Type != VolumeTypePrimary && vd.Header.Type != VolumeTypeSupplementary {
+		return vd, nil
+	}
+
+	root, _, err := DecodeDirectoryEntry(sector[156:190])
+	if err != nil {
+		return VolumeDescriptor{}, fmt.Errorf("root directory record: %w", err)
+	}
+
+	vd.Primary = &PrimaryVolumeDescriptorBody{
+		SystemIdentifier:     StringA(sector[8:40]),
+		VolumeIdentifier:     StringD(sector[40:72]),
+		VolumeSpaceSize:      SizeSectors(binary.LittleEndian.Uint32(sector[80:])),
+		EscapeSequences:      strings.TrimRight(string(sector[88:120]), "\x00"),
+		VolumeSetSize:        SizeBytes(binary.LittleEndian.Uint16(sector[120:])),
+		VolumeSequenceNumber: binary.LittleEndian.Uint16(sector[124:]),
+		LogicalBlockSize:     SizeBytes(binary.LittleEndian.Uint16(sector[128:])),
+		PathTableSize:        SizeBytes(binary.LittleEndian.Uint32(sector[132:])),
+		TypeLPathTableLoc:    SizeSectors(binary.LittleEndian.Uint32(sector[140:])),
+		OptTypeLPathTableLoc: SizeSectors(binary.LittleEndian.Uint32(sector[144:])),
+		TypeMPathTableLoc:    SizeSectors(binary.BigEndian.Uint32(sector[148:])),
+		OptTypeMPathTableLoc: SizeSectors(binary.BigEndian.Uint32(sector[152:])),
+		RootDirectoryEntry:   &root.FixedDirectoryEntry,
+
+		VolumeSetIdentifier:           StringD(sector[190:318]),
+		PublisherIdentifier:           StringA(sector[318:446]),
+		DataPreparerIdentifier:        StringA(sector[446:574]),
+		ApplicationIdentifier:         StringA(sector[574:702]),
+		CopyrightFileIdentifier:       StringD(sector[702:739]),
+		AbstractFileIdentifier:        StringD(sector[739:776]),
+		BibliographicFileIdentifier:   StringD(sector[776:813]),
+		VolumeCreationDateAndTime:     decodeVolumeDescriptorTimestamp(sector[813:830]),
+		VolumeModificationDateAndTime: decodeVolumeDescriptorTimestamp(sector[830:847]),
+		VolumeExpirationDateAndTime:   decodeVolumeDescriptorTimestamp(sector[847:864]),
+		VolumeEffectiveDateAndTime:    decodeVolumeDescriptorTimestamp(sector[864:881]),
+		FileStructureVersion:          sector[881],
+		ApplicationUsed:               sector[883:1395],
+	}
+
+	return vd, nil
+}
+
+// DecodePathTable decodes path table of provided byte order (little-endian for type L and big-endian for type M).
+func DecodePathTable(data []byte, order binary.ByteOrder) ([]PathTableEntry, error) {
+	var ret []PathTableEntry
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 8 {
+			return nil, fmt.Errorf("path table entry at %d: %w", pos, io.ErrUnexpectedEOF)
+		}
+
+		idLen := int(data[pos])
+		if idLen == 0 { // padding at the end of table
+			break
+		}
+
+		idEnd := pos + 8 + idLen
+		if idEnd > len(data) {
+			return nil, fmt.Errorf("path table entry at %d: identifier length %d exceeds table", pos, idLen)
+		}
+
+		ret = append(ret, PathTableEntry{
+			ExtendedAttributeRecordLength: data[pos+1],
+			DirLocation:                   SizeSectors(order.Uint32(data[pos+2:])),
+			ParentDirNumber:               int16(order.Uint16(data[pos+6:])),
+			DirIdentifier:                 StringD1(data[pos+8 : idEnd]),
+		})
+		if len(ret) > PathTableItemsLimit {
+			return nil, fmt.Errorf("too many path table entries")
+		}
+
+		pos = idEnd + idLen%2 // identifier padded to even length
+	}
+
+	return ret, nil
+}
+
+// Image provides read-only access to filesystem structures of iso9660 image.
+// Joliet names are preferred if supplementary volume descriptor presents.
+type Image struct {
+	r io.ReaderAt
+
+	Primary *PrimaryVolumeDescriptorBody
+	Joliet  *PrimaryVolumeDescriptorBody // nil if no joliet extension
+}
+
+// OpenImage reads volume descriptors of image.
+func OpenImage(r io.ReaderAt) (*Image, error) {
+	ret := &Image{r: r}
+	sector := make([]byte, SectorSize)
+
+	for i := range SizeSectors(maxVolumeDescriptors) {
+		if err := ret.readSector(SystemAreaSize.Sectors()+i, sector); err != nil {
+			return nil, fmt.Errorf("read volume descriptor %d: %w", i, err)
+		}
+
+		vd, err := DecodeVolumeDescriptor(sector)
+		if err != nil {
+			return nil, fmt.Errorf("decode volume descriptor %d: %w", i, err)
+		}
+
+		switch vd.Header.Type {
+		case VolumeTypePrimary:
+			ret.Primary = vd.Primary
+		case VolumeTypeSupplementary:
+			if strings.HasPrefix(vd.Primary.EscapeSequences, "%/") { // joliet levels 1-3
+				ret.Joliet = vd.Primary
+			}
+		case VolumeTypeTerminator:
+			if ret.Primary == nil {
+				return nil, fmt.Errorf("no primary volume descriptor")
+			}
+			return ret, nil
+		}
+	}
+
+	return nil, fmt.Errorf("volume descriptors set terminator not found")
+}
+
+// Root returns root directory record.
+func (img *Image) Root() DirectoryEntry {
+	if img.Joliet != nil {
+		return DirectoryEntry{FixedDirectoryEntry: *img.Joliet.RootDirectoryEntry}
+	}
+
+	return DirectoryEntry{FixedDirectoryEntry: *img.Primary.RootDirectoryEntry}
+}
+
+// Name returns decoded name of entry without version suffix (";1").
+func (img *Image) Name(de DirectoryEntry) string {
+	name := string(de.Identifier)
+	if img.Joliet != nil {
+		name, _ = unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM).NewDecoder().String(name)
+	}
+
+	if idx := strings.LastIndexByte(name, ';'); idx >= 0 {
+		name = name[:idx]
+	}
+
+	return strings.TrimSuffix(name, ".") // iso9660 names without extension have trailing dot
+}
+
+// PathTable reads type L path table of volume used for traversal (Joliet if presents).
+func (img *Image) PathTable() ([]PathTableEntry, error) {
+	pvd := img.Primary
+	if img.Joliet != nil {
+		pvd = img.Joliet
+	}
+
+	data := make([]byte, pvd.PathTableSize)
+	if _, err := img.r.ReadAt(data, int64(pvd.TypeLPathTableLoc.Bytes())); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read path table: %w", err)
+	}
+
+	return DecodePathTable(data, binary.LittleEndian)
+}
+
+// Extent is a continuous part of file data.
+type Extent struct {
+	Location SizeSectors
+	Length   SizeBytes
+}
+
+// dirRecord is a directory record with all extents of multi-extent file.
+type dirRecord struct {
+	DirectoryEntry
+	extents []Extent
+}
+
+// ReadDir reads records of directory skipping '.' and '..' entries.
+// Multi-extent files records are merged to one with total length and location of first extent.
+func (img *Image) ReadDir(dir DirectoryEntry) ([]DirectoryEntry, error) {
+	records, err := img.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]DirectoryEntry, len(records))
+	for i, r := range records {
+		ret[i] = r.DirectoryEntry
+	}
+
+	return ret, nil
+}
+
+func (img *Image) readDir(dir DirectoryEntry) ([]dirRecord, error) {
+	if dir.FileFlags&DirFlagDir == 0 {
+		return nil, fmt.Errorf("not a directory")
+	}
+
+	// record may be corrupted, don't trust its length
+	if dir.ExtentLocation < 0 || dir.ExtentLength > maxDirectorySize ||
+		dir.ExtentLocation.Bytes()+dir.ExtentLength > img.Primary.VolumeSpaceSize.Bytes() {
+		return nil, fmt.Errorf("directory extent at sector %d of %d bytes is out of volume", dir.ExtentLocation, dir.ExtentLength)
+	}
+
+	data := make([]byte, dir.ExtentLength.AlignToSectors())
+	if _, err := img.r.ReadAt(data, int64(dir.ExtentLocation.Bytes())); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read directory extent: %w", err)
+	}
+
+	var (
+		ret         []dirRecord
+		multiExtent bool // previous record is not last extent of file
+	)
+	for sectorStart := SizeBytes(0); sectorStart < SizeBytes(len(data)); sectorStart += SectorSize {
+		sector := data[sectorStart : sectorStart+SectorSize]
+		for pos := SizeBytes(0); pos < SectorSize; {
+			de, size, err := DecodeDirectoryEntry(sector[pos:])
+			if err != nil {
+				return nil, fmt.Errorf("record at %d: %w", sectorStart+pos, err)
+			}
+			if size == 0 {
+				break
+			}
+			pos += size
+
+			if de.Identifier == "\x00" || de.Identifier == "\x01" { // '.' and '..'
+				continue
+			}
+
+			extent := Extent{Location: de.ExtentLocation, Length: de.ExtentLength}
+			if last := len(ret) - 1; multiExtent && last >= 0 && ret[last].Identifier == de.Identifier {
+				ret[last].ExtentLength += de.ExtentLength
+				ret[last].extents = append(ret[last].extents, extent)
+			} else {
+				ret = append(ret, dirRecord{DirectoryEntry: de, extents: []Extent{extent}})
+			}
+			multiExtent = de.FileFlags&DirFlagMultiExtent != 0
+		}
+	}
+
+	return ret, nil
+}
+
+func (img *Image) readSector(sector SizeSectors, buf []byte) error {
+	n, err := img.r.ReadAt(buf, int64(sector.Bytes()))
+	if n == len(buf) {
+		return nil
+	}
+	if err == nil || errors.Is(err, io.EOF) {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,266 @@
+package iso9660_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+	"github.com/xakep666/ps3netsrv-go/internal/osutil/filesystem"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/viso"
+)
+
+func TestImage(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = root.Close() })
+
+	files := map[string]string{
+		"test.txt":                  "hello world",
+		"dir1/Long File Name.bin":   string(bytes.Repeat([]byte{0xAB}, 3000)),
+		"dir1/DIR2/b.txt":           "b content",
+		"dir1/DIR2/no_extension":    "no extension",
+		"dir3/small_file_with_name": "small",
+	}
+	for name, content := range files {
+		require.NoError(t, root.MkdirAll(filepath.Join("iso_root", filepath.Dir(name)), os.ModePerm))
+		require.NoError(t, root.WriteFile(filepath.Join("iso_root", name), []byte(content), os.ModePerm))
+	}
+
+	vi, err := viso.NewVirtualISO(t.Context(), pkgfs.NewFS(filesystem.NewStrictSystemRoot(root), nil, nil), "iso_root", false)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = vi.Close() })
+
+	fi, err := vi.Stat()
+	require.NoError(t, err)
+
+	data := make([]byte, fi.Size())
+	_, err = io.ReadFull(vi, data)
+	require.NoError(t, err)
+
+	img, err := iso9660.OpenImage(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.NotNil(t, img.Joliet)
+	assert.EqualValues(t, len(data), img.Primary.VolumeSpaceSize.Bytes())
+
+	found := make(map[string]string)
+	var walk func(dir iso9660.DirectoryEntry, prefix string)
+	walk = func(dir iso9660.DirectoryEntry, prefix string) {
+		entries, err := img.ReadDir(dir)
+		require.NoError(t, err)
+
+		for _, e := range entries {
+			name := img.Name(e)
+			if e.FileFlags&iso9660.DirFlagDir != 0 {
+				walk(e, prefix+name+"/")
+				continue
+			}
+
+			start := e.ExtentLocation.Bytes()
+			found[prefix+name] = string(data[start : start+e.ExtentLength])
+		}
+	}
+	walk(img.Root(), "")
+
+	assert.Equal(t, files, found)
+}
+
+func TestFS(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = root.Close() })
+
+	require.NoError(t, root.MkdirAll("iso_root/PS3_GAME/USRDIR", os.ModePerm))
+	require.NoError(t, root.WriteFile("iso_root/PS3_GAME/PARAM.SFO", []byte("sfo"), os.ModePerm))
+	require.NoError(t, root.WriteFile("iso_root/PS3_GAME/USRDIR/EBOOT.BIN", bytes.Repeat([]byte{0xCD}, 5000), os.ModePerm))
+	require.NoError(t, root.WriteFile("iso_root/PS3_DISC.SFB", []byte("sfb"), os.ModePerm))
+
+	vi, err := viso.NewVirtualISO(t.Context(), pkgfs.NewFS(filesystem.NewStrictSystemRoot(root), nil, nil), "iso_root", false)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = vi.Close() })
+
+	fi, err := vi.Stat()
+	require.NoError(t, err)
+
+	data := make([]byte, fi.Size())
+	_, err = io.ReadFull(vi, data)
+	require.NoError(t, err)
+
+	img, err := iso9660.OpenImage(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	require.NoError(t, fstest.TestFS(img.FS(), "PS3_DISC.SFB", "PS3_GAME/PARAM.SFO", "PS3_GAME/USRDIR/EBOOT.BIN"))
+
+	eboot, err := fs.ReadFile(img.FS(), "PS3_GAME/USRDIR/EBOOT.BIN")
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte{0xCD}, 5000), eboot)
+
+	pathTable, err := img.PathTable()
+	require.NoError(t, err)
+	var dirs []string
+	for _, e := range pathTable {
+		dirs = append(dirs, string(e.DirIdentifier))
+	}
+	assert.Len(t, dirs, 3) // root, PS3_GAME and USRDIR
+}
+
+func TestFS_MultiExtent(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = root.Close() })
+
+	content := make([]byte, 2*iso9660.SectorSize+1000)
+	for i := range content {
+		content[i] = byte(i / int(iso9660.SectorSize)) // sector number to catch wrong extents order
+	}
+
+	require.NoError(t, root.MkdirAll("iso_root", os.ModePerm))
+	require.NoError(t, root.WriteFile("iso_root/a.bin", []byte("before"), os.ModePerm))
+	require.NoError(t, root.WriteFile("iso_root/big.bin", content, os.ModePerm))
+	require.NoError(t, root.WriteFile("iso_root/z.bin", []byte("after"), os.ModePerm))
+
+	vi, err := viso.NewVirtualISO(t.Context(), pkgfs.NewFS(filesystem.NewStrictSystemRoot(root), nil, nil), "iso_root", false)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = vi.Close() })
+
+	fi, err := vi.Stat()
+	require.NoError(t, err)
+
+	data := make([]byte, fi.Size())
+	_, err = io.ReadFull(vi, data)
+	require.NoError(t, err)
+
+	img, err := iso9660.OpenImage(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	// split record of big.bin to 3 extents placed in order: 2nd sector, 1st sector, rest
+	dirStart := img.Root().ExtentLocation.Bytes()
+	dirSector := data[dirStart : dirStart+iso9660.SectorSize]
+
+	var patched []byte
+	for pos := 0; pos < len(dirSector) && dirSector[pos] > 0; pos += int(dirSector[pos]) {
+		record := dirSector[pos : pos+int(dirSector[pos])]
+		de, _, err := iso9660.DecodeDirectoryEntry(record)
+		require.NoError(t, err)
+
+		if img.Name(de) != "big.bin" {
+			patched = append(patched, record...)
+			continue
+		}
+
+		for _, extent := range []struct {
+			location iso9660.SizeSectors
+			length   iso9660.SizeBytes
+			last     bool
+		}{
+			{location: de.ExtentLocation + 1, length: iso9660.SectorSize},
+			{location: de.ExtentLocation, length: iso9660.SectorSize},
+			{location: de.ExtentLocation + 2, length: 1000, last: true},
+		} {
+			part := bytes.Clone(record)
+			binary.LittleEndian.PutUint32(part[2:], uint32(extent.location))
+			binary.BigEndian.PutUint32(part[6:], uint32(extent.location))
+			binary.LittleEndian.PutUint32(part[10:], uint32(extent.length))
+			binary.BigEndian.PutUint32(part[14:], uint32(extent.length))
+			if !extent.last {
+				part[25] |= byte(iso9660.DirFlagMultiExtent)
+			}
+			patched = append(patched, part...)
+		}
+	}
+	require.LessOrEqual(t, len(patched), len(dirSector))
+	copy(dirSector, patched)
+	clear(dirSector[len(patched):])
+
+	fsys := img.FS()
+	require.NoError(t, fstest.TestFS(fsys, "a.bin", "big.bin", "z.bin"))
+
+	entries, err := fs.ReadDir(fsys, ".")
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	info, err := entries[1].Info()
+	require.NoError(t, err)
+	assert.Equal(t, "big.bin", info.Name())
+	assert.EqualValues(t, len(content), info.Size())
+
+	expected := slices.Concat(content[iso9660.SectorSize:2*iso9660.SectorSize], content[:iso9660.SectorSize], content[2*iso9660.SectorSize:])
+	big, err := fs.ReadFile(fsys, "big.bin")
+	require.NoError(t, err)
+	assert.Equal(t, expected, big)
+
+	// read crossing extents borders
+	f, err := fsys.Open("big.bin")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	buf := make([]byte, iso9660.SectorSize+10)
+	n, err := f.(io.ReaderAt).ReadAt(buf, int64(iso9660.SectorSize)-5)
+	require.NoError(t, err)
+	assert.Equal(t, expected[iso9660.SectorSize-5:2*iso9660.SectorSize+5], buf[:n])
+
+	n, err = f.(io.ReaderAt).ReadAt(buf, int64(len(expected))-10)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, expected[len(expected)-10:], buf[:n])
+}
+
+func TestImage_CorruptedDirectory(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = root.Close() })
+
+	require.NoError(t, root.MkdirAll("iso_root/dir", os.ModePerm))
+	require.NoError(t, root.WriteFile("iso_root/dir/file.bin", []byte("content"), os.ModePerm))
+
+	vi, err := viso.NewVirtualISO(t.Context(), pkgfs.NewFS(filesystem.NewStrictSystemRoot(root), nil, nil), "iso_root", false)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = vi.Close() })
+
+	fi, err := vi.Stat()
+	require.NoError(t, err)
+
+	data := make([]byte, fi.Size())
+	_, err = io.ReadFull(vi, data)
+	require.NoError(t, err)
+
+	img, err := iso9660.OpenImage(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	entries, err := img.ReadDir(img.Root())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// huge length must not be allocated
+	dirRecordStart := img.Root().ExtentLocation.Bytes()
+	dirSector := data[dirRecordStart : dirRecordStart+iso9660.SectorSize]
+	for pos := 0; pos < len(dirSector) && dirSector[pos] > 0; pos += int(dirSector[pos]) {
+		record := dirSector[pos : pos+int(dirSector[pos])]
+		de, _, err := iso9660.DecodeDirectoryEntry(record)
+		require.NoError(t, err)
+
+		if img.Name(de) == "dir" {
+			binary.LittleEndian.PutUint32(record[10:], 0xFFFFF000)
+			binary.BigEndian.PutUint32(record[14:], 0xFFFFF000)
+		}
+	}
+
+	entries, err = img.ReadDir(img.Root())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	_, err = img.ReadDir(entries[0])
+	assert.ErrorContains(t, err, "out of volume")
+
+	_, err = fs.ReadDir(img.FS(), "dir")
+	assert.ErrorContains(t, err, "out of volume")
+}
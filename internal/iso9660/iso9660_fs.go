@@ -0,0 +1,230 @@
+package iso9660
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FS exposes image filesystem as io/fs.FS. Opened files implement io.ReaderAt and io.Seeker.
+type FS struct {
+	img *Image
+}
+
+// FS returns filesystem of image.
+func (img *Image) FS() *FS {
+	return &FS{img: img}
+}
+
+var (
+	_ fs.ReadDirFS = (*FS)(nil)
+	_ fs.StatFS    = (*FS)(nil)
+)
+
+func (fsys *FS) Open(name string) (fs.File, error) {
+	info, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &dirFile{fsys: fsys, info: info}, nil
+	}
+
+	return &file{
+		info:          info,
+		SectionReader: io.NewSectionReader(extentsReaderAt{r: fsys.img.r, extents: info.rec.extents}, 0, info.Size()),
+	}, nil
+}
+
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.lookup("stat", name)
+}
+
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := fsys.readDir(info)
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: err}
+	}
+
+	ret := make([]fs.DirEntry, len(infos))
+	for i, fi := range infos {
+		ret[i] = fs.FileInfoToDirEntry(fi)
+	}
+
+	return ret, nil
+}
+
+// readDir lists directory sorted by name as io/fs requires.
+func (fsys *FS) readDir(dir *fileInfo) ([]*fileInfo, error) {
+	if !dir.IsDir() {
+		return nil, errors.New("not a directory")
+	}
+
+	records, err := fsys.img.readDir(dir.rec.DirectoryEntry)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]*fileInfo, len(records))
+	for i, r := range records {
+		ret[i] = &fileInfo{name: fsys.img.Name(r.DirectoryEntry), rec: r}
+	}
+
+	slices.SortFunc(ret, func(a, b *fileInfo) int {
+		return strings.Compare(a.name, b.name)
+	})
+
+	return ret, nil
+}
+
+func (fsys *FS) lookup(op, name string) (*fileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	root := fsys.img.Root()
+	cur := &fileInfo{name: ".", rec: dirRecord{
+		DirectoryEntry: root,
+		extents:        []Extent{{Location: root.ExtentLocation, Length: root.ExtentLength}},
+	}}
+	if name == "." {
+		return cur, nil
+	}
+
+	for elem := range strings.SplitSeq(name, "/") {
+		if !cur.IsDir() {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+
+		entries, err := fsys.readDir(cur)
+		if err != nil {
+			return nil, &fs.PathError{Op: op, Path: name, Err: err}
+		}
+
+		idx := slices.IndexFunc(entries, func(fi *fileInfo) bool { return fi.name == elem })
+		if idx < 0 {
+			return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+
+		cur = entries[idx]
+	}
+
+	return cur, nil
+}
+
+type fileInfo struct {
+	name string
+	rec  dirRecord
+}
+
+func (fi *fileInfo) Name() string { return path.Base(fi.name) }
+
+func (fi *fileInfo) Size() int64 { return int64(fi.rec.ExtentLength) }
+
+func (fi *fileInfo) Mode() fs.FileMode {
+	if fi.IsDir() {
+		return fs.ModeDir | 0o555
+	}
+
+	return 0o444
+}
+
+func (fi *fileInfo) ModTime() time.Time { return time.Time(fi.rec.RecordingDateTime) }
+
+func (fi *fileInfo) IsDir() bool { return fi.rec.FileFlags&DirFlagDir != 0 }
+
+// Sys returns DirectoryEntry of file.
+func (fi *fileInfo) Sys() any { return fi.rec.DirectoryEntry }
+
+type file struct {
+	*io.SectionReader
+	info *fileInfo
+}
+
+func (f *file) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+func (f *file) Close() error { return nil }
+
+type dirFile struct {
+	fsys    *FS
+	info    *fileInfo
+	entries []*fileInfo // nil until first ReadDir
+	offset  int
+}
+
+func (d *dirFile) Stat() (fs.FileInfo, error) { return d.info, nil }
+
+func (d *dirFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: errors.New("is a directory")}
+}
+
+func (d *dirFile) Close() error { return nil }
+
+func (d *dirFile) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		entries, err := d.fsys.readDir(d.info)
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.info.name, Err: err}
+		}
+		d.entries = entries
+	}
+
+	rest := d.entries[d.offset:]
+	if n > 0 {
+		if len(rest) == 0 {
+			return nil, io.EOF
+		}
+		rest = rest[:min(n, len(rest))]
+	}
+	d.offset += len(rest)
+
+	ret := make([]fs.DirEntry, len(rest))
+	for i, fi := range rest {
+		ret[i] = fs.FileInfoToDirEntry(fi)
+	}
+
+	return ret, nil
+}
+
+// extentsReaderAt reads data of multi-extent file as one continuous stream.
+type extentsReaderAt struct {
+	r       io.ReaderAt
+	extents []Extent
+}
+
+func (e extentsReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	read := 0
+	for _, extent := range e.extents {
+		length := int64(extent.Length)
+		if off >= length {
+			off -= length
+			continue
+		}
+
+		chunk := p[read : read+int(min(int64(len(p)-read), length-off))]
+		n, err := e.r.ReadAt(chunk, int64(extent.Location.Bytes())+off)
+		read += n
+		switch {
+		case n < len(chunk) && (err == nil || errors.Is(err, io.EOF)):
+			return read, io.ErrUnexpectedEOF // image is truncated
+		case n < len(chunk):
+			return read, err
+		case read == len(p):
+			return read, nil
+		}
+
+		off = 0
+	}
+
+	return read, io.EOF
+}
@@ -0,0 +1,33 @@
+package iso9660
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/xakep666/ps3netsrv-go/internal/ioutil"
+)
+
+const (
+	discInfoOffset = 0x800 // sector 1
+	consoleIDSize  = 0x10
+	productIDSize  = 0x20
+)
+
+var ps3ConsoleID = []byte("PlayStation3")
+
+// TitleID returns title ID (i.e. BLES00000) of PS3 disc image from disc info sector.
+// Empty string returned if image doesn't have it, i.e. for other consoles.
+func TitleID(f io.ReadSeeker) string {
+	var buf [consoleIDSize + productIDSize]byte
+	if err := ioutil.FillBuffer(f, discInfoOffset, buf[:]); err != nil {
+		return ""
+	}
+
+	if !bytes.Equal(bytes.TrimRight(buf[:consoleIDSize], "\x00"), ps3ConsoleID) {
+		return ""
+	}
+
+	// stored like "BLES-00000" padded with spaces
+	return strings.ReplaceAll(strings.TrimSpace(string(buf[consoleIDSize:])), "-", "")
+}
@@ -0,0 +1,26 @@
+package logutil
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LevelHandler filters records by Level in addition to wrapped handler.
+// It's useful to change level of handlers which don't accept slog.Leveler.
+type LevelHandler struct {
+	slog.Handler
+
+	Level slog.Leveler
+}
+
+func (h *LevelHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.Level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h *LevelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LevelHandler{Handler: h.Handler.WithAttrs(attrs), Level: h.Level}
+}
+
+func (h *LevelHandler) WithGroup(name string) slog.Handler {
+	return &LevelHandler{Handler: h.Handler.WithGroup(name), Level: h.Level}
+}
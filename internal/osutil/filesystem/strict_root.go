@@ -1,6 +1,10 @@
 package filesystem
 
-import "os"
+import (
+	"os"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+)
 
 // StrictSystemRoot wraps *os.Root to make it usable on 32-bit platforms.
 //
@@ -22,10 +26,20 @@ func NewStrictSystemRoot(root *os.Root) StrictSystemRoot {
 	return StrictSystemRoot{Root: root}
 }
 
-func (r StrictSystemRoot) Open(path string) (*os.File, error) {
-	return r.Root.OpenFile(path, os.O_RDONLY|openLargeFile, 0)
+func (r StrictSystemRoot) Open(path string) (handler.File, error) {
+	f, err := r.Root.OpenFile(path, os.O_RDONLY|openLargeFile, 0)
+	if err != nil {
+		return nil, err // avoid typed nil
+	}
+
+	return f, nil
 }
 
-func (r StrictSystemRoot) Create(path string) (*os.File, error) {
-	return r.Root.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC|openLargeFile, 0666)
+func (r StrictSystemRoot) Create(path string) (handler.WritableFile, error) {
+	f, err := r.Root.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC|openLargeFile, 0666)
+	if err != nil {
+		return nil, err // avoid typed nil
+	}
+
+	return f, nil
 }
@@ -0,0 +1,275 @@
+// Package playhistory keeps track of games played by clients.
+// Sessions are persisted to a file in JSON Lines format, so history survives restarts.
+package playhistory
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RecentDir is a name of virtual directory with recently played games in category root.
+const RecentDir = "RECENT"
+
+// maxSessions limits amount of sessions kept in store, older ones are removed on load.
+const maxSessions = 1000
+
+const (
+	virtualPS3ISOPrefix = "***PS3***/"
+	virtualISOPrefix    = "***DVD***/"
+)
+
+// imageCategories contains game images.
+var imageCategories = []string{"PS3ISO", "PS2ISO", "PSXISO", "PSPISO", "BDISO", "DVDISO"}
+
+// dirCategories contains games in directory format served as virtual iso.
+var dirCategories = []string{"GAMES", "GAMEZ"}
+
+// nonGameExts are extensions of files residing near images but not played, i.e. covers.
+var nonGameExts = []string{".jpg", ".jpeg", ".png", ".sfo", ".dkey", ".cue", ".ini", ".txt", ".xml"}
+
+// Session describes single game play.
+type Session struct {
+	Game     string        `json:"game"` // path relative to root, i.e. "PS3ISO/game.iso" or "GAMES/BLES00000-Game"
+	TitleID  string        `json:"title_id,omitempty"`
+	Client   string        `json:"client"`
+	Start    time.Time     `json:"start"`
+	End      time.Time     `json:"end"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+// Store keeps play sessions in memory and appends them to file.
+// Nil Store doesn't track anything.
+type Store struct {
+	path        string
+	recent      int
+	minDuration time.Duration
+
+	mu       sync.Mutex
+	sessions []Session // ordered by end time
+}
+
+// Open loads sessions from file. Up to recent games per category are listed by [Store.Recent].
+// Sessions shorter than minDuration are ignored, i.e. when client only reads image header.
+func Open(path string, recent int, minDuration time.Duration) (*Store, error) {
+	s := &Store{
+		path:        path,
+		recent:      recent,
+		minDuration: minDuration,
+	}
+
+	if err := s.load(); err != nil {
+		return nil, fmt.Errorf("load play history: %w", err)
+	}
+
+	return s, nil
+}
+
+func (s *Store) load() error {
+	f, err := os.Open(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var sess Session
+		if err := json.Unmarshal(scanner.Bytes(), &sess); err != nil {
+			continue // skip partially written line
+		}
+
+		s.sessions = append(s.sessions, sess)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if len(s.sessions) <= maxSessions {
+		return nil
+	}
+
+	s.sessions = slices.Clone(s.sessions[len(s.sessions)-maxSessions:])
+	return s.compact()
+}
+
+// compact rewrites file with sessions kept in memory.
+func (s *Store) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, sess := range s.sessions {
+		if err := enc.Encode(sess); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// Game tells if requested path (as sent by client) is a game and returns its path relative to root.
+// Paths inside virtual recent directory are resolved to original ones.
+func (s *Store) Game(requestPath string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+
+	p := strings.TrimPrefix(requestPath, "/")
+	virtual := strings.HasPrefix(p, virtualPS3ISOPrefix) || strings.HasPrefix(p, virtualISOPrefix)
+	p = strings.TrimPrefix(strings.TrimPrefix(p, virtualPS3ISOPrefix), virtualISOPrefix)
+
+	category, rest, ok := strings.Cut(p, "/")
+	if !ok || rest == "" {
+		return "", false
+	}
+
+	if name, ok := strings.CutPrefix(rest, RecentDir+"/"); ok {
+		original, found := s.Resolve(category, name)
+		if !found {
+			return "", false
+		}
+
+		category, rest, _ = strings.Cut(original, "/")
+	}
+
+	switch {
+	case slices.Contains(dirCategories, category):
+		// only whole directory served as virtual iso is a game
+		if !virtual || strings.Contains(rest, "/") {
+			return "", false
+		}
+	case slices.Contains(imageCategories, category):
+		if slices.Contains(nonGameExts, strings.ToLower(path.Ext(rest))) {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+
+	return category + "/" + rest, true
+}
+
+// Add records finished session.
+func (s *Store) Add(sess Session) error {
+	if s == nil {
+		return nil
+	}
+
+	if sess.Duration == 0 {
+		sess.Duration = sess.End.Sub(sess.Start)
+	}
+
+	if sess.Duration < s.minDuration {
+		return nil
+	}
+
+	line, err := json.Marshal(sess)
+	if err != nil {
+		return fmt.Errorf("marshal play session: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions = append(s.sessions, sess)
+	if len(s.sessions) > maxSessions {
+		s.sessions = slices.Delete(s.sessions, 0, len(s.sessions)-maxSessions)
+	}
+
+	f, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("open play history: %w", err)
+	}
+
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("write play history: %w", err)
+	}
+
+	return nil
+}
+
+// Sessions returns all sessions, newest first.
+func (s *Store) Sessions() []Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ret := slices.Clone(s.sessions)
+	slices.Reverse(ret)
+	return ret
+}
+
+// Recent returns paths of games recently played in category, newest first.
+func (s *Store) Recent(category string) []string {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ret []string
+	for i := len(s.sessions) - 1; i >= 0 && len(ret) < s.recent; i-- {
+		game := s.sessions[i].Game
+		if !strings.HasPrefix(game, category+"/") || slices.Contains(ret, game) {
+			continue
+		}
+
+		// games with the same name from different subdirectories can't be listed together
+		if slices.ContainsFunc(ret, func(g string) bool { return path.Base(g) == path.Base(game) }) {
+			continue
+		}
+
+		ret = append(ret, game)
+	}
+
+	return ret
+}
+
+// Resolve finds original path of game listed in recent directory of category by its name.
+func (s *Store) Resolve(category, name string) (string, bool) {
+	for _, game := range s.Recent(category) {
+		if path.Base(game) == name {
+			return game, true
+		}
+	}
+
+	return "", false
+}
+
+// ServeHTTP responds with all sessions in JSON, newest first.
+func (s *Store) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.Sessions())
+}
@@ -0,0 +1,57 @@
+package playhistory_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/playhistory"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	s, err := playhistory.Open(path, 2, time.Minute)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		request string
+		game    string
+	}{
+		{request: "/PS3ISO/game.iso", game: "PS3ISO/game.iso"},
+		{request: "/PS3ISO/sub/game.iso", game: "PS3ISO/sub/game.iso"},
+		{request: "/***PS3***/GAMES/BLES00000-Game", game: "GAMES/BLES00000-Game"},
+		{request: "/PS3ISO/game.jpg"},
+		{request: "/GAMES/BLES00000-Game/PS3_GAME/PARAM.SFO"},
+		{request: "/PS3ISO"},
+		{request: "/video/movie.mkv"},
+	} {
+		game, ok := s.Game(tc.request)
+		assert.Equal(t, tc.game != "", ok, tc.request)
+		assert.Equal(t, tc.game, game, tc.request)
+	}
+
+	start := time.Now().Add(-time.Hour)
+	for _, game := range []string{"PS3ISO/a.iso", "PS3ISO/b.iso", "PS2ISO/c.iso", "PS3ISO/a.iso", "PS3ISO/c.iso"} {
+		start = start.Add(10 * time.Minute)
+		require.NoError(t, s.Add(playhistory.Session{Game: game, Start: start, End: start.Add(5 * time.Minute)}))
+	}
+	require.NoError(t, s.Add(playhistory.Session{Game: "PS3ISO/short.iso", Start: start, End: start.Add(time.Second)}))
+
+	assert.Equal(t, []string{"PS3ISO/c.iso", "PS3ISO/a.iso"}, s.Recent("PS3ISO"))
+
+	game, ok := s.Game("/PS3ISO/RECENT/a.iso")
+	assert.True(t, ok)
+	assert.Equal(t, "PS3ISO/a.iso", game, "recent game must be resolved to original path")
+
+	// reopen to check persistence
+	s, err = playhistory.Open(path, 10, 0)
+	require.NoError(t, err)
+	sessions := s.Sessions()
+	require.Len(t, sessions, 5, "short session must not be stored")
+	assert.Equal(t, "PS3ISO/c.iso", sessions[0].Game)
+	assert.Equal(t, 5*time.Minute, sessions[0].Duration)
+}
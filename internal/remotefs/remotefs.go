@@ -0,0 +1,114 @@
+// Package remotefs contains parts shared by system roots serving files from remote storage:
+// file information and lazily listed directory.
+package remotefs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// FileInfo describes remote file or directory.
+type FileInfo struct {
+	FileName  string
+	FileSize  int64
+	Directory bool
+	Writable  bool // storage accepts writes, affects only reported mode
+	Modified  time.Time
+	Accessed  time.Time // optional, zero if storage doesn't provide it
+	Changed   time.Time // optional, zero if storage doesn't provide it
+}
+
+func (fi *FileInfo) Name() string { return fi.FileName }
+
+func (fi *FileInfo) Size() int64 { return fi.FileSize }
+
+func (fi *FileInfo) Mode() fs.FileMode {
+	switch {
+	case fi.Directory && fi.Writable:
+		return fs.ModeDir | 0o755
+	case fi.Directory:
+		return fs.ModeDir | 0o555
+	case fi.Writable:
+		return 0o644
+	default:
+		return 0o444
+	}
+}
+
+func (fi *FileInfo) ModTime() time.Time { return fi.Modified }
+
+func (fi *FileInfo) IsDir() bool { return fi.Directory }
+
+func (fi *FileInfo) Sys() any { return nil }
+
+func (fi *FileInfo) AccessTime() time.Time { return fi.Accessed }
+
+func (fi *FileInfo) ChangeTime() time.Time { return fi.Changed }
+
+// Dir is a remote directory listed on first ReadDir call.
+type Dir struct {
+	name string
+	info fs.FileInfo
+	list func() ([]fs.DirEntry, error)
+
+	entries []fs.DirEntry
+	loaded  bool
+}
+
+// NewDir makes directory named name (as requested from system root) listed by list.
+func NewDir(name string, info fs.FileInfo, list func() ([]fs.DirEntry, error)) *Dir {
+	return &Dir{
+		name: name,
+		info: info,
+		list: list,
+	}
+}
+
+func (d *Dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.loaded {
+		entries, err := d.list()
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: err}
+		}
+
+		d.entries = entries
+		d.loaded = true
+	}
+
+	if n <= 0 {
+		ret := d.entries
+		d.entries = nil
+		return ret, nil
+	}
+
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	n = min(n, len(d.entries))
+	ret := d.entries[:n]
+	d.entries = d.entries[n:]
+	return ret, nil
+}
+
+func (d *Dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.ErrUnsupported}
+}
+
+func (d *Dir) Seek(int64, int) (int64, error) {
+	return 0, nil
+}
+
+func (d *Dir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+func (d *Dir) Name() string {
+	return d.name
+}
+
+func (d *Dir) Close() error {
+	return nil
+}
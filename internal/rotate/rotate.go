@@ -0,0 +1,118 @@
+// Package rotate implements append-only file with size-based rotation.
+package rotate
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// File appends data to file. When file size exceeds limit, it's renamed to "<path>.1",
+// previous backups are shifted ("<path>.1" to "<path>.2" and so on) and the oldest ones are removed.
+type File struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// Open opens or creates file. Zero or negative maxSize disables rotation.
+func Open(path string, maxSize int64, maxBackups int) (*File, error) {
+	f := &File{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return fmt.Errorf("open: %w", err)
+	}
+
+	st, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("stat: %w", err)
+	}
+
+	f.f, f.size = file, st.Size()
+	return nil
+}
+
+// Write appends p to file. File is rotated before writing if it would exceed size limit,
+// so p is never split between files.
+func (f *File) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f == nil {
+		return 0, fs.ErrClosed
+	}
+
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.f.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *File) rotate() error {
+	if err := f.f.Close(); err != nil {
+		return fmt.Errorf("close: %w", err)
+	}
+	f.f = nil
+
+	backup := func(i int) string {
+		return f.path + "." + strconv.Itoa(i)
+	}
+
+	if f.maxBackups <= 0 {
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("remove: %w", err)
+		}
+	} else {
+		for i := f.maxBackups - 1; i > 0; i-- {
+			if err := os.Rename(backup(i), backup(i+1)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("shift backup: %w", err)
+			}
+		}
+
+		if err := os.Rename(f.path, backup(1)); err != nil {
+			return fmt.Errorf("rotate: %w", err)
+		}
+	}
+
+	return f.open()
+}
+
+// Close closes underlying file.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.f == nil {
+		return nil
+	}
+
+	err := f.f.Close()
+	f.f = nil
+	return err
+}
@@ -0,0 +1,43 @@
+package testutil
+
+import (
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+)
+
+// EncryptedImage makes Redump-like image of random content with the first and the last sectors unencrypted.
+// It returns decrypted image (with regions map kept), encrypted one and disc key.
+func EncryptedImage(t *testing.T, sectors uint32) (decrypted, encrypted, key []byte) {
+	t.Helper()
+
+	decrypted = make([]byte, iso9660.SizeSectors(sectors).Bytes())
+	_, _ = rand.Read(decrypted)
+
+	encryptediso.PutRegionsMap(decrypted, [][2]uint32{{0, 1}, {sectors - 1, sectors}})
+
+	key = make([]byte, 16)
+	_, _ = rand.Read(key)
+
+	decryptedPath := filepath.Join(t.TempDir(), "decrypted.iso")
+	require.NoError(t, os.WriteFile(decryptedPath, decrypted, os.ModePerm))
+
+	f, err := os.Open(decryptedPath)
+	require.NoError(t, err)
+	defer f.Close()
+
+	encrypter, err := encryptediso.NewDecryptedISO(f, key)
+	require.NoError(t, err)
+
+	encrypted, err = io.ReadAll(encrypter)
+	require.NoError(t, err)
+
+	return decrypted, encrypted, key
+}
@@ -0,0 +1,88 @@
+package testutil
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/ird"
+)
+
+// EncodeIRD makes gzip-compressed IRD file of disc.Version, version 9 is used if it's not set.
+func EncodeIRD(t *testing.T, disc *ird.IRD) []byte {
+	t.Helper()
+
+	version := disc.Version
+	if version == 0 {
+		version = 9
+	}
+
+	gzipped := func(data []byte) []byte {
+		var buf bytes.Buffer
+		gzw := gzip.NewWriter(&buf)
+		_, err := gzw.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, gzw.Close())
+		return buf.Bytes()
+	}
+
+	fixed := func(s string, size int) []byte {
+		return []byte(fmt.Sprintf("%-*s", size, s)[:size])
+	}
+
+	le := binary.LittleEndian
+	data := []byte("3IRD")
+	data = append(data, version)
+	data = append(data, fixed(disc.TitleID, 9)...)
+	data = append(data, byte(len(disc.Title)))
+	data = append(data, disc.Title...)
+	data = append(data, fixed(disc.SystemVersion, 4)...)
+	data = append(data, fixed(disc.GameVersion, 5)...)
+	data = append(data, fixed(disc.AppVersion, 5)...)
+	if version == 7 {
+		data = le.AppendUint32(data, 0) // id
+	}
+
+	for _, section := range [][]byte{disc.Header, disc.Footer} {
+		compressed := gzipped(section)
+		data = le.AppendUint32(data, uint32(len(compressed)))
+		data = append(data, compressed...)
+	}
+
+	data = append(data, byte(len(disc.RegionHashes)))
+	for _, h := range disc.RegionHashes {
+		data = append(data, h[:]...)
+	}
+
+	data = le.AppendUint32(data, uint32(len(disc.FileHashes)))
+	for _, h := range disc.FileHashes {
+		data = le.AppendUint64(data, uint64(h.Sector))
+		data = append(data, h.MD5[:]...)
+	}
+
+	data = le.AppendUint32(data, 0) // extra config and attachments
+	type field struct {
+		value []byte
+		size  int
+	}
+	fields := []field{{disc.PIC, 115}, {disc.Data1, 16}, {disc.Data2, 16}}
+	if version < 9 {
+		fields = []field{{disc.Data1, 16}, {disc.Data2, 16}, {disc.PIC, 115}}
+	}
+	for _, f := range fields {
+		padded := make([]byte, f.size)
+		copy(padded, f.value)
+		data = append(data, padded...)
+	}
+	if version > 7 {
+		data = le.AppendUint32(data, disc.UID)
+	}
+	data = le.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+	return gzipped(data)
+}
@@ -0,0 +1,206 @@
+// Package tlsutil builds TLS configurations from certificate files.
+// Server certificates are reloaded automatically when files are changed, so certificates
+// issued by ACME clients or internal CA may be rotated without server restart.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+)
+
+// reloadCheckInterval is a minimal interval between checks of certificate files changes.
+const reloadCheckInterval = 10 * time.Second
+
+// ServerConfig holds server certificate and optional CA to verify client certificates (mutual TLS).
+// Files are watched for changes and reloaded during handshake.
+type ServerConfig struct {
+	certFile, keyFile, clientCAFile string
+	logger                          *slog.Logger
+	checkInterval                   time.Duration
+
+	mu        sync.Mutex
+	config    *tls.Config
+	stamps    []fileStamp
+	lastCheck time.Time
+}
+
+// NewServerConfig loads certificate and key. If clientCAFile is not empty, clients must present certificate
+// signed by one of CAs from this file.
+func NewServerConfig(certFile, keyFile, clientCAFile string, logger *slog.Logger) (*ServerConfig, error) {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	c := &ServerConfig{
+		certFile:      certFile,
+		keyFile:       keyFile,
+		clientCAFile:  clientCAFile,
+		logger:        logger,
+		checkInterval: reloadCheckInterval,
+	}
+
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// TLSConfig returns configuration for tls.NewListener.
+func (c *ServerConfig) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return c.current(), nil
+		},
+	}
+}
+
+func (c *ServerConfig) files() []string {
+	files := []string{c.certFile, c.keyFile}
+	if c.clientCAFile != "" {
+		files = append(files, c.clientCAFile)
+	}
+	return files
+}
+
+func (c *ServerConfig) current() *tls.Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.lastCheck) < c.checkInterval {
+		return c.config
+	}
+	c.lastCheck = time.Now()
+
+	stamps, err := statFiles(c.files())
+	if err != nil {
+		c.logger.Warn("Certificate files stat failed", logutil.ErrorAttr(err))
+		return c.config
+	}
+
+	if !slices.EqualFunc(stamps, c.stamps, fileStamp.equal) {
+		if err := c.loadLocked(); err != nil {
+			c.logger.Warn("Certificate reload failed, keep using previous one", logutil.ErrorAttr(err))
+		} else {
+			c.logger.Info("Certificate reloaded", "cert", c.certFile)
+		}
+	}
+
+	return c.config
+}
+
+func (c *ServerConfig) load() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.loadLocked()
+}
+
+func (c *ServerConfig) loadLocked() error {
+	// stat before reading to not miss change happened during reading
+	stamps, err := statFiles(c.files())
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return fmt.Errorf("load key pair: %w", err)
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.clientCAFile != "" {
+		pool, err := loadCertPool(c.clientCAFile)
+		if err != nil {
+			return fmt.Errorf("load client CA: %w", err)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	c.config = config
+	c.stamps = stamps
+	c.lastCheck = time.Now()
+
+	return nil
+}
+
+// ClientConfig makes client configuration. If caFile is empty, system roots are used to verify server certificate.
+// Provide certFile and keyFile to authenticate client by certificate.
+func ClientConfig(caFile, certFile, keyFile, serverName string, insecureSkipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: insecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("load CA: %w", err)
+		}
+
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load key pair: %w", err)
+		}
+
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", file)
+	}
+
+	return pool, nil
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFiles(files []string) ([]fileStamp, error) {
+	stamps := make([]fileStamp, 0, len(files))
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+
+		stamps = append(stamps, fileStamp{modTime: fi.ModTime(), size: fi.Size()})
+	}
+
+	return stamps, nil
+}
+
+func (s fileStamp) equal(other fileStamp) bool {
+	return s.modTime.Equal(other.modTime) && s.size == other.size
+}
@@ -0,0 +1,151 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func issueCert(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{cn},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	keyDER, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+
+	certFile, keyFile = filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func TestServerConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	ca := issueCert(t, "test ca", nil, true)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCertFile, serverKeyFile := issueCert(t, "server.local", ca, false).write(t, dir, "server")
+	clientCertFile, clientKeyFile := issueCert(t, "client", ca, false).write(t, dir, "client")
+
+	serverConfig, err := NewServerConfig(serverCertFile, serverKeyFile, caFile, nil)
+	require.NoError(t, err)
+	serverConfig.checkInterval = 0
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ln = tls.NewListener(ln, serverConfig.TLSConfig())
+	t.Cleanup(func() { _ = ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_ = conn.(*tls.Conn).Handshake()
+				_, _ = conn.Write([]byte("ok"))
+			}()
+		}
+	}()
+
+	dial := func(t *testing.T, certFile, keyFile string) (*x509.Certificate, error) {
+		t.Helper()
+
+		config, err := ClientConfig(caFile, certFile, keyFile, "server.local", false)
+		require.NoError(t, err)
+
+		conn, err := tls.Dial("tcp", ln.Addr().String(), config)
+		if err != nil {
+			return nil, err
+		}
+		defer conn.Close()
+
+		// TLS 1.3 client reports rejected certificate on first read
+		buf := make([]byte, 2)
+		if _, err = conn.Read(buf); err != nil {
+			return nil, err
+		}
+
+		return conn.ConnectionState().PeerCertificates[0], nil
+	}
+
+	t.Run("mutual", func(t *testing.T) {
+		cert, err := dial(t, clientCertFile, clientKeyFile)
+		require.NoError(t, err)
+		assert.Equal(t, "server.local", cert.Subject.CommonName)
+
+		_, err = dial(t, "", "")
+		assert.Error(t, err, "client without certificate must be rejected")
+	})
+
+	t.Run("reload", func(t *testing.T) {
+		newCert := issueCert(t, "server.local", ca, false)
+		newCert.write(t, dir, "server")
+
+		cert, err := dial(t, clientCertFile, clientKeyFile)
+		require.NoError(t, err)
+		assert.Equal(t, newCert.cert.SerialNumber, cert.SerialNumber)
+
+		// broken file must not break serving
+		require.NoError(t, os.WriteFile(serverCertFile, []byte("garbage"), 0o600))
+
+		cert, err = dial(t, clientCertFile, clientKeyFile)
+		require.NoError(t, err)
+		assert.Equal(t, newCert.cert.SerialNumber, cert.SerialNumber)
+	})
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -18,14 +19,45 @@ import (
 	"github.com/xakep666/ps3netsrv-go/pkg/proto"
 )
 
+// ErrUnsuccessfulResponse returned when server reports failure of the operation.
+// Connection stays usable in this case.
+var ErrUnsuccessfulResponse = errors.New("received unsuccessful response")
+
 type Client struct {
 	conn     net.Conn
 	copier   *ioutil.Copier
 	isClosed *atomic.Bool
 }
 
-func NewClient(ctx context.Context, copier *ioutil.Copier, addr string) (*Client, error) {
-	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+// Option configures connection made by NewClient.
+type Option func(*options)
+
+type options struct {
+	tlsConfig *tls.Config
+}
+
+// WithTLS makes client to connect using TLS with provided configuration.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+func NewClient(ctx context.Context, copier *ioutil.Copier, addr string, opts ...Option) (*Client, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if o.tlsConfig != nil {
+		conn, err = (&tls.Dialer{Config: o.tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", addr)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -67,7 +99,7 @@ func (c *Client) OpenFile(ctx context.Context, path string) (proto.OpenFileResul
 	}
 
 	if resp.FileSize < 0 {
-		return proto.OpenFileResult{}, fmt.Errorf("received unsuccessful response")
+		return proto.OpenFileResult{}, ErrUnsuccessfulResponse
 	}
 
 	return resp, nil
@@ -95,7 +127,7 @@ func (c *Client) StatFile(ctx context.Context, path string) (*proto.StatFileResu
 	}
 
 	if resp.FileSize < 0 {
-		return nil, fmt.Errorf("received unsuccessful response")
+		return nil, ErrUnsuccessfulResponse
 	}
 
 	return &resp, nil
@@ -151,7 +183,7 @@ func (c *Client) ReadFile(ctx context.Context, bytesToRead uint32, offset uint64
 		return fmt.Errorf("read response: %w", err)
 	}
 	if resp.BytesRead <= 0 {
-		return fmt.Errorf("received unsuccessful response")
+		return ErrUnsuccessfulResponse
 	}
 
 	_, err = c.copier.CopyN(target, c.conn, int64(resp.BytesRead))
@@ -214,7 +246,7 @@ func (c *Client) OpenDir(ctx context.Context, path string) error {
 	}
 
 	if resp.Result < 0 {
-		return fmt.Errorf("received unsuccessful response")
+		return ErrUnsuccessfulResponse
 	}
 
 	return nil
@@ -326,7 +358,7 @@ func (c *Client) ReadDir(ctx context.Context) ([]proto.DirEntry, error) {
 	}
 
 	if resp.Size < 0 {
-		return nil, fmt.Errorf("received unsuccessful response")
+		return nil, ErrUnsuccessfulResponse
 	}
 
 	ret := make([]proto.DirEntry, resp.Size)
@@ -361,7 +393,7 @@ func (c *Client) CreateFile(ctx context.Context, path string) error {
 	}
 
 	if resp.Result < 0 {
-		return fmt.Errorf("received unsuccessful response")
+		return ErrUnsuccessfulResponse
 	}
 
 	return nil
@@ -401,7 +433,7 @@ func (c *Client) WriteFile(ctx context.Context, chunkSize uint32, from io.Reader
 		}
 
 		if resp.Result < 0 {
-			return fmt.Errorf("received unsuccessful response")
+			return ErrUnsuccessfulResponse
 		}
 	}
 }
@@ -428,7 +460,7 @@ func (c *Client) DeleteFile(ctx context.Context, path string) error {
 	}
 
 	if resp.Result < 0 {
-		return fmt.Errorf("received unsuccessful response")
+		return ErrUnsuccessfulResponse
 	}
 
 	return nil
@@ -456,7 +488,7 @@ func (c *Client) MkDir(ctx context.Context, path string) error {
 	}
 
 	if resp.Result < 0 {
-		return fmt.Errorf("received unsuccessful response")
+		return ErrUnsuccessfulResponse
 	}
 
 	return nil
@@ -484,7 +516,7 @@ func (c *Client) RmDir(ctx context.Context, path string) error {
 	}
 
 	if resp.Result < 0 {
-		return fmt.Errorf("received unsuccessful response")
+		return ErrUnsuccessfulResponse
 	}
 
 	return nil
@@ -512,7 +544,7 @@ func (c *Client) GetDirSize(ctx context.Context, path string) (int64, error) {
 	}
 
 	if resp.Size < 0 {
-		return resp.Size, fmt.Errorf("received unsuccessful response")
+		return resp.Size, ErrUnsuccessfulResponse
 	}
 
 	return resp.Size, nil
@@ -0,0 +1,158 @@
+// Package dat reads DAT files in Logiqx XML format used by preservation projects like Redump and No-Intro
+// to describe known good dumps.
+package dat
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Header describes DAT file.
+type Header struct {
+	Name        string `xml:"name"`
+	Description string `xml:"description"`
+	Version     string `xml:"version"`
+}
+
+// ROM is a single file of game dump. Hashes are lowercase hex strings, empty if not provided.
+type ROM struct {
+	Name string `xml:"name,attr"`
+	Size int64  `xml:"size,attr"`
+	CRC  string `xml:"crc,attr"`
+	MD5  string `xml:"md5,attr"`
+	SHA1 string `xml:"sha1,attr"`
+}
+
+// Game is a dump of game, it consists of one or more files.
+type Game struct {
+	Name        string `xml:"name,attr"`
+	Description string `xml:"description"`
+	ROMs        []ROM  `xml:"rom"`
+}
+
+// File is a parsed DAT file.
+type File struct {
+	Header Header `xml:"header"`
+	Games  []Game `xml:"game"`
+}
+
+// Match is a ROM found in DAT file.
+type Match struct {
+	Game *Game
+	ROM  *ROM
+}
+
+// Hashes of file being checked. Hashes must be lowercase hex strings.
+type Hashes struct {
+	Size int64
+	CRC  string
+	MD5  string
+	SHA1 string
+}
+
+// Index allows to quickly find ROMs by hashes or name.
+type Index struct {
+	bySHA1 map[string]Match
+	byMD5  map[string]Match
+	byCRC  map[string][]Match // CRC collisions are possible, so size is checked too
+	byName map[string]Match   // lowercase name without extension
+}
+
+// Parse reads DAT file. Both "game" and "machine" elements are accepted as games.
+func Parse(r io.Reader) (*File, error) {
+	var raw struct {
+		File
+		Machines []Game `xml:"machine"`
+	}
+
+	if err := xml.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decode dat: %w", err)
+	}
+
+	f := raw.File
+	f.Games = append(f.Games, raw.Machines...)
+	for i := range f.Games {
+		for j := range f.Games[i].ROMs {
+			rom := &f.Games[i].ROMs[j]
+			rom.CRC = strings.ToLower(rom.CRC)
+			rom.MD5 = strings.ToLower(rom.MD5)
+			rom.SHA1 = strings.ToLower(rom.SHA1)
+		}
+	}
+
+	return &f, nil
+}
+
+// Index makes index of all ROMs in file.
+func (f *File) Index() *Index {
+	idx := &Index{
+		bySHA1: make(map[string]Match),
+		byMD5:  make(map[string]Match),
+		byCRC:  make(map[string][]Match),
+		byName: make(map[string]Match),
+	}
+
+	for i := range f.Games {
+		game := &f.Games[i]
+		for j := range game.ROMs {
+			m := Match{Game: game, ROM: &game.ROMs[j]}
+
+			if m.ROM.SHA1 != "" {
+				idx.bySHA1[m.ROM.SHA1] = m
+			}
+			if m.ROM.MD5 != "" {
+				idx.byMD5[m.ROM.MD5] = m
+			}
+			if m.ROM.CRC != "" {
+				idx.byCRC[m.ROM.CRC] = append(idx.byCRC[m.ROM.CRC], m)
+			}
+			idx.byName[nameKey(m.ROM.Name)] = m
+		}
+	}
+
+	return idx
+}
+
+func nameKey(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	return strings.ToLower(strings.TrimSuffix(name, path.Ext(name)))
+}
+
+// Lookup finds ROM by hashes. The strongest hash present in both DAT and h is used.
+// All other present hashes and size must match too.
+func (idx *Index) Lookup(h Hashes) (Match, bool) {
+	var candidates []Match
+	if m, ok := idx.bySHA1[h.SHA1]; ok && h.SHA1 != "" {
+		candidates = append(candidates, m)
+	}
+	if m, ok := idx.byMD5[h.MD5]; ok && h.MD5 != "" {
+		candidates = append(candidates, m)
+	}
+	if h.CRC != "" {
+		candidates = append(candidates, idx.byCRC[h.CRC]...)
+	}
+
+	for _, m := range candidates {
+		if m.ROM.matches(h) {
+			return m, true
+		}
+	}
+
+	return Match{}, false
+}
+
+// LookupName finds ROM by file name ignoring extension and case, i.e. to report mismatched dump.
+func (idx *Index) LookupName(name string) (Match, bool) {
+	m, ok := idx.byName[nameKey(name)]
+	return m, ok
+}
+
+func (r *ROM) matches(h Hashes) bool {
+	eq := func(a, b string) bool { return a == "" || b == "" || a == b }
+
+	return (r.Size == 0 || h.Size == 0 || r.Size == h.Size) &&
+		eq(r.CRC, h.CRC) && eq(r.MD5, h.MD5) && eq(r.SHA1, h.SHA1)
+}
@@ -0,0 +1,57 @@
+package dat_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/dat"
+)
+
+const testDAT = `<?xml version="1.0"?>
+<!DOCTYPE datafile PUBLIC "-//Logiqx//DTD ROM Management Datafile//EN" "http://www.logiqx.com/Dats/datafile.dtd">
+<datafile>
+	<header>
+		<name>Sony - PlayStation 3</name>
+		<description>Sony - PlayStation 3 - Discs (100) (2024-01-01 00-00-00)</description>
+		<version>2024-01-01 00-00-00</version>
+	</header>
+	<game name="Game A (Europe)">
+		<description>Game A (Europe)</description>
+		<rom name="Game A (Europe).iso" size="4" crc="D87F7E0C" md5="098f6bcd4621d373cade4e832627b4f6" sha1="a94a8fe5ccb19ba61c4c0873d391e987982fbbd3"/>
+	</game>
+	<machine name="Game B (USA)">
+		<rom name="Game B (USA).iso" size="3" crc="8c736521"/>
+	</machine>
+</datafile>`
+
+func TestIndex(t *testing.T) {
+	f, err := dat.Parse(strings.NewReader(testDAT))
+	require.NoError(t, err)
+	assert.Equal(t, "Sony - PlayStation 3", f.Header.Name)
+	require.Len(t, f.Games, 2)
+
+	idx := f.Index()
+
+	m, ok := idx.Lookup(dat.Hashes{
+		Size: 4,
+		CRC:  "d87f7e0c",
+		MD5:  "098f6bcd4621d373cade4e832627b4f6",
+		SHA1: "a94a8fe5ccb19ba61c4c0873d391e987982fbbd3",
+	})
+	require.True(t, ok)
+	assert.Equal(t, "Game A (Europe)", m.Game.Name)
+
+	m, ok = idx.Lookup(dat.Hashes{Size: 3, CRC: "8c736521", SHA1: "0000000000000000000000000000000000000000"})
+	require.True(t, ok, "game without sha1 in dat must be found by crc")
+	assert.Equal(t, "Game B (USA)", m.Game.Name)
+
+	_, ok = idx.Lookup(dat.Hashes{Size: 5, CRC: "8c736521"})
+	assert.False(t, ok, "size must match")
+
+	m, ok = idx.LookupName("Game A (Europe).chd")
+	require.True(t, ok)
+	assert.Equal(t, "Game A (Europe)", m.Game.Name)
+}
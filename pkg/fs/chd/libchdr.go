@@ -20,6 +20,8 @@ const (
 	fileModeRW   = 2
 )
 
+const errMetadataNotFound errorCode = 19
+
 type LibCHDR struct {
 	log       *slog.Logger
 	callbacks *fileCallbacks
@@ -118,20 +120,18 @@ func (l *LibCHDR) NewFile(f handler.File) (*File, error) {
 }
 
 func (l *LibCHDR) readMeatadata(handle fileHandle) ([]CDMetadata, error) {
-	const metadataNotFound errorCode = 19
-
 	var ret []CDMetadata
 	rawTag := make([]byte, 512)
 	var rawTagLen uint32
 	for idx := uint32(0); ; idx++ {
 		errCode := l.getMetadata(handle, cdMetadataOldTag, idx, &rawTag[0], uint32(len(rawTag)), &rawTagLen, nil, nil)
-		if errCode == metadataNotFound {
+		if errCode == errMetadataNotFound {
 			errCode = l.getMetadata(handle, cdMetadataTag, idx, &rawTag[0], uint32(len(rawTag)), &rawTagLen, nil, nil)
 		}
-		if errCode == metadataNotFound {
+		if errCode == errMetadataNotFound {
 			errCode = l.getMetadata(handle, cdMetadataTag2, idx, &rawTag[0], uint32(len(rawTag)), &rawTagLen, nil, nil)
 		}
-		if errCode == metadataNotFound {
+		if errCode == errMetadataNotFound {
 			break
 		}
 		if err := l.makeError(errCode); err != nil {
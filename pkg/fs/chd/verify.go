@@ -0,0 +1,175 @@
+package chd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+)
+
+const (
+	metadataWildcardTag  = 0
+	metadataFlagChecksum = 0x01
+)
+
+// HunkError describes a hunk failed to decompress.
+type HunkError struct {
+	Hunk int
+	Err  error
+}
+
+func (e *HunkError) Error() string {
+	return fmt.Sprintf("hunk %d: %v", e.Hunk, e.Err)
+}
+
+func (e *HunkError) Unwrap() error {
+	return e.Err
+}
+
+// Verification contains checksums computed from fully decompressed image.
+type Verification struct {
+	RawMD5  [md5.Size]byte
+	RawSHA1 [sha1.Size]byte
+	SHA1    [sha1.Size]byte // combined raw+meta SHA1, equals to RawSHA1 for v3 and earlier
+
+	HunkErrors []HunkError
+}
+
+// Check is a comparison of checksum stored in header with computed one.
+type Check struct {
+	Name     string
+	Expected []byte
+	Actual   []byte
+}
+
+func (c *Check) OK() bool {
+	return bytes.Equal(c.Expected, c.Actual)
+}
+
+// Checks returns checksums comparisons according to header version.
+// Checksums absent in header are skipped.
+func (v *Verification) Checks(hdr *FileHeader) []Check {
+	var ret []Check
+	add := func(name string, expected, actual []byte) {
+		if bytes.Count(expected, []byte{0}) == len(expected) {
+			return
+		}
+		ret = append(ret, Check{Name: name, Expected: expected, Actual: actual})
+	}
+
+	switch {
+	case hdr.Version <= 2:
+		add("MD5", hdr.MD5[:], v.RawMD5[:])
+	case hdr.Version == 3:
+		add("MD5", hdr.MD5[:], v.RawMD5[:])
+		add("SHA1", hdr.SHA1[:], v.RawSHA1[:])
+	default:
+		add("Data SHA1", hdr.RawSHA1[:], v.RawSHA1[:])
+		add("SHA1", hdr.SHA1[:], v.SHA1[:])
+	}
+
+	return ret
+}
+
+// Verify decompresses all hunks and computes raw data and combined raw+meta checksums.
+// Hunks failed to decompress are reported in HunkErrors and hashed as zeroes.
+// Progress is called with amount of decompressed bytes after each hunk.
+func (f *File) Verify(progress func(n int)) (*Verification, error) {
+	if err := f.init(); err != nil {
+		return nil, err
+	}
+
+	var ret Verification
+	md5Hash, sha1Hash := md5.New(), sha1.New()
+	w := io.MultiWriter(md5Hash, sha1Hash)
+
+	buf := make([]byte, f.Header.HunkBytes)
+	remaining := f.Header.LogicalBytes
+	for hunkNum := 0; hunkNum < int(f.Header.TotalHunks) && remaining > 0; hunkNum++ {
+		if err := f.lib.makeError(f.lib.read(f.handle, uint32(hunkNum), &buf[0])); err != nil {
+			ret.HunkErrors = append(ret.HunkErrors, HunkError{Hunk: hunkNum, Err: err})
+			clear(buf)
+		}
+
+		n := min(uint64(len(buf)), remaining)
+		w.Write(buf[:n]) // hash writes never return errors
+		remaining -= n
+
+		if progress != nil {
+			progress(int(n))
+		}
+	}
+
+	md5Hash.Sum(ret.RawMD5[:0])
+	sha1Hash.Sum(ret.RawSHA1[:0])
+
+	if f.Header.Version < 4 {
+		ret.SHA1 = ret.RawSHA1
+		return &ret, nil
+	}
+
+	overall, err := f.overallSHA1(ret.RawSHA1)
+	if err != nil {
+		return nil, fmt.Errorf("chd: metadata hash: %w", err)
+	}
+	ret.SHA1 = overall
+
+	return &ret, nil
+}
+
+// overallSHA1 computes combined raw+meta SHA1 like MAME does: raw SHA1 followed by sorted list of
+// tag and SHA1 of each metadata entry marked with checksum flag.
+func (f *File) overallSHA1(rawSHA1 [sha1.Size]byte) ([sha1.Size]byte, error) {
+	type metadataHash [4 + sha1.Size]byte
+
+	var hashes []metadataHash
+	metaHash := sha1.New()
+	buf := make([]byte, 512)
+	for idx := uint32(0); ; idx++ {
+		var (
+			length, tag uint32
+			flags       byte
+		)
+		getMetadata := func() errorCode {
+			return f.lib.getMetadata(f.handle, metadataWildcardTag, idx, &buf[0], uint32(len(buf)), &length, &tag, &flags)
+		}
+
+		errCode := getMetadata()
+		if errCode == errMetadataNotFound {
+			break
+		}
+		if errCode == 0 && int(length) > len(buf) {
+			buf = make([]byte, length)
+			errCode = getMetadata()
+		}
+		if err := f.lib.makeError(errCode); err != nil {
+			return [sha1.Size]byte{}, fmt.Errorf("idx %d: %w", idx, err)
+		}
+
+		if flags&metadataFlagChecksum == 0 {
+			continue
+		}
+
+		var entry metadataHash
+		binary.BigEndian.PutUint32(entry[:4], tag)
+		metaHash.Reset()
+		metaHash.Write(buf[:length])
+		metaHash.Sum(entry[4:4])
+		hashes = append(hashes, entry)
+	}
+
+	slices.SortFunc(hashes, func(a, b metadataHash) int {
+		return bytes.Compare(a[:], b[:])
+	})
+
+	overall := sha1.New()
+	overall.Write(rawSHA1[:])
+	for _, entry := range hashes {
+		overall.Write(entry[:])
+	}
+
+	return [sha1.Size]byte(overall.Sum(nil)), nil
+}
@@ -0,0 +1,153 @@
+package chd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"slices"
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerification_Checks(t *testing.T) {
+	v := &Verification{
+		RawMD5:  md5.Sum([]byte("raw")),
+		RawSHA1: sha1.Sum([]byte("raw")),
+		SHA1:    sha1.Sum([]byte("raw+meta")),
+	}
+
+	checkNames := func(checks []Check) []string {
+		var ret []string
+		for _, c := range checks {
+			ret = append(ret, c.Name)
+		}
+		return ret
+	}
+
+	t.Run("version 2", func(t *testing.T) {
+		checks := v.Checks(&FileHeader{Version: 2, MD5: v.RawMD5, SHA1: sha1.Sum([]byte("ignored"))})
+		require.Equal(t, []string{"MD5"}, checkNames(checks))
+		assert.True(t, checks[0].OK())
+	})
+
+	t.Run("version 3", func(t *testing.T) {
+		checks := v.Checks(&FileHeader{Version: 3, MD5: v.RawMD5, SHA1: sha1.Sum([]byte("other"))})
+		require.Equal(t, []string{"MD5", "SHA1"}, checkNames(checks))
+		assert.True(t, checks[0].OK())
+		assert.False(t, checks[1].OK())
+		assert.Equal(t, v.RawSHA1[:], checks[1].Actual, "raw SHA1 is stored in v3 header")
+	})
+
+	t.Run("version 5", func(t *testing.T) {
+		checks := v.Checks(&FileHeader{Version: 5, MD5: md5.Sum([]byte("ignored")), RawSHA1: v.RawSHA1, SHA1: v.SHA1})
+		require.Equal(t, []string{"Data SHA1", "SHA1"}, checkNames(checks))
+		assert.True(t, checks[0].OK())
+		assert.True(t, checks[1].OK())
+	})
+
+	t.Run("absent checksums", func(t *testing.T) {
+		assert.Empty(t, v.Checks(&FileHeader{Version: 2}))
+		assert.Equal(t, []string{"MD5"}, checkNames(v.Checks(&FileHeader{Version: 3, MD5: v.RawMD5})))
+		assert.Equal(t, []string{"SHA1"}, checkNames(v.Checks(&FileHeader{Version: 5, SHA1: v.SHA1})))
+	})
+}
+
+type testMetadata struct {
+	tag   uint32
+	flags byte
+	data  []byte
+}
+
+// fakeMetadataFile makes file with metadata served by fake chd_get_metadata.
+func fakeMetadataFile(entries []testMetadata) *File {
+	getMetadata := func(_ fileHandle, searchTag, searchIndex uint32, output *byte, outputLen uint32, resultLen, resultTag *uint32, resultFlags *byte) errorCode {
+		if searchTag != metadataWildcardTag || int(searchIndex) >= len(entries) {
+			return errMetadataNotFound
+		}
+
+		e := entries[searchIndex]
+		copy(unsafe.Slice(output, outputLen), e.data)
+		*resultLen, *resultTag, *resultFlags = uint32(len(e.data)), e.tag, e.flags
+		return 0
+	}
+
+	return &File{lib: &LibCHDR{getMetadata: getMetadata}, handle: 1}
+}
+
+func TestFile_OverallSHA1(t *testing.T) {
+	rawSHA1 := sha1.Sum([]byte("raw"))
+	entries := []testMetadata{
+		{tag: 0x43485432, flags: metadataFlagChecksum, data: []byte("track 2")},                // CHT2
+		{tag: 0x43485432, flags: metadataFlagChecksum, data: []byte("track 1")},                // CHT2
+		{tag: 0x47444444, flags: 0, data: []byte("not hashed")},                                // GDDD
+		{tag: 0x41424344, flags: metadataFlagChecksum, data: bytes.Repeat([]byte("big"), 300)}, // larger than initial buffer
+	}
+
+	// MAME: raw SHA1 followed by entries sorted by tag and data SHA1, values computed outside of Go
+	actual, err := fakeMetadataFile(entries).overallSHA1(rawSHA1)
+	require.NoError(t, err)
+	assert.Equal(t, "6b2d244a62f4b523e46821d78db011667d50e197", hex.EncodeToString(actual[:]))
+
+	// order of metadata in file doesn't matter
+	reversed := slices.Clone(entries)
+	slices.Reverse(reversed)
+	actualReversed, err := fakeMetadataFile(reversed).overallSHA1(rawSHA1)
+	require.NoError(t, err)
+	assert.Equal(t, actual, actualReversed)
+
+	// without metadata it's a SHA1 of raw SHA1
+	actual, err = fakeMetadataFile(nil).overallSHA1(rawSHA1)
+	require.NoError(t, err)
+	assert.Equal(t, "331dce47ed4a334f9b30bd69eb927be5d56de988", hex.EncodeToString(actual[:]))
+}
+
+func TestFile_Verify(t *testing.T) {
+	const (
+		hunkBytes           = 16
+		corruptedHunk       = 2
+		decompressionError  = errorCode(14) // CHDERR_DECOMPRESSION_ERROR
+		decompressionString = "decompression error"
+	)
+
+	f := fakeMetadataFile([]testMetadata{{tag: 0x43485432, flags: metadataFlagChecksum, data: []byte("track 1")}})
+	f.Header = &FileHeader{Version: 5, HunkBytes: hunkBytes, TotalHunks: 4, LogicalBytes: 3*hunkBytes + 8}
+	// hunk contents are "aaa...", "bbb..." and so on, the last hunk is partially used
+	f.lib.read = func(_ fileHandle, hunkNum uint32, buffer *byte) errorCode {
+		if hunkNum == corruptedHunk {
+			return decompressionError
+		}
+
+		copy(unsafe.Slice(buffer, hunkBytes), bytes.Repeat([]byte{'a' + byte(hunkNum)}, hunkBytes))
+		return 0
+	}
+	f.lib.errorString = func(errorCode) string {
+		return decompressionString
+	}
+
+	// checksum of original data
+	rawSHA1, err := hex.DecodeString("299640310f7db61f29d63f7999841610bc8d370e")
+	require.NoError(t, err)
+	copy(f.Header.RawSHA1[:], rawSHA1)
+
+	var progress int
+	v, err := f.Verify(func(n int) { progress += n })
+	require.NoError(t, err)
+	assert.EqualValues(t, f.Header.LogicalBytes, progress)
+
+	require.Len(t, v.HunkErrors, 1)
+	assert.Equal(t, corruptedHunk, v.HunkErrors[0].Hunk)
+	assert.EqualError(t, &v.HunkErrors[0], "hunk 2: "+decompressionString)
+
+	// corrupted hunk is hashed as zeroes, values computed outside of Go
+	assert.Equal(t, "81159303b92bfead0b4fc8665b74962d", hex.EncodeToString(v.RawMD5[:]))
+	assert.Equal(t, "31509589a020ae625510643a99295141f9f2ad4e", hex.EncodeToString(v.RawSHA1[:]))
+	assert.Equal(t, "2dd47368d7a4eb8a5487bdbc77928501ff300ed4", hex.EncodeToString(v.SHA1[:]))
+
+	checks := v.Checks(f.Header)
+	require.Len(t, checks, 1)
+	assert.False(t, checks[0].OK())
+}
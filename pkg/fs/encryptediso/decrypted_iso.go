@@ -0,0 +1,62 @@
+package encryptediso
+
+import (
+	"crypto/cipher"
+	"fmt"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+)
+
+// DecryptedISO is a reverse of EncryptedISO: it encrypts decrypted image on-the-fly to get original (i.e. Redump) image.
+// Unencrypted regions map must be preserved in the beginning of decrypted image.
+// Write operations are blocked due to complexity of implementation.
+type DecryptedISO struct {
+	privateFile
+
+	encryptedRegions []region
+	enc              *sectorCrypter
+	offset           iso9660.SizeBytes // to track where we are now without calling Seek
+}
+
+// NewDecryptedISO wraps File to DecryptedISO with provided "data1" key.
+func NewDecryptedISO(f handler.File, data1 []byte) (*DecryptedISO, error) {
+	regions, _, err := readRegions(f)
+	if err != nil {
+		return nil, fmt.Errorf("regions map (was it cleared during decryption?): %w", err)
+	}
+
+	enc, err := newSectorCrypter(data1, cipher.NewCBCEncrypter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DecryptedISO{
+		privateFile:      f,
+		encryptedRegions: regions,
+		enc:              enc,
+	}, nil
+}
+
+func (d *DecryptedISO) Read(b []byte) (int, error) {
+	read, err := readSectors(d.privateFile, d.offset, b, func(start iso9660.SizeBytes, data []byte) {
+		d.enc.cryptRegions(d.encryptedRegions, start, data)
+	})
+
+	d.offset += iso9660.SizeBytes(read)
+	return read, err
+}
+
+func (d *DecryptedISO) Seek(offset int64, whence int) (int64, error) {
+	newOffset, err := d.privateFile.Seek(offset, whence)
+	if err != nil {
+		return newOffset, err
+	}
+
+	d.offset = iso9660.SizeBytes(newOffset)
+	return newOffset, nil
+}
+
+func (d *DecryptedISO) Unwrap() handler.File {
+	return d.privateFile
+}
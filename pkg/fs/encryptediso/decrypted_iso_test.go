@@ -0,0 +1,71 @@
+package encryptediso_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+)
+
+func writeTemp(t *testing.T, name string, r io.Reader) *os.File {
+	t.Helper()
+
+	f, err := os.Create(filepath.Join(t.TempDir(), name))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	_, err = io.Copy(f, r)
+	require.NoError(t, err)
+	_, err = f.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	return f
+}
+
+func TestDecryptedISO_RoundTrip(t *testing.T) {
+	const sectorSize = 2048
+
+	image := make([]byte, 8*sectorSize)
+	_, _ = rand.Read(image)
+
+	encryptediso.PutRegionsMap(image, [][2]uint32{{0, 1}, {3, 4}, {6, 8}})
+
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+
+	encrypted := writeTemp(t, "encrypted.iso", bytes.NewReader(image))
+
+	decryptedISO, err := encryptediso.NewEncryptedISO(encrypted, key, false)
+	require.NoError(t, err)
+	decrypted := writeTemp(t, "decrypted.iso", decryptedISO)
+
+	decryptedData := encryptediso.ReadAllSectors(t, decrypted)
+	assert.Equal(t, image[:sectorSize], decryptedData[:sectorSize], "unencrypted region must be kept")
+	assert.NotEqual(t, image[sectorSize:3*sectorSize], decryptedData[sectorSize:3*sectorSize], "encrypted region must be decrypted")
+
+	_, err = decrypted.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+
+	reencrypted, err := encryptediso.NewDecryptedISO(decrypted, key)
+	require.NoError(t, err)
+
+	assert.Equal(t, image, encryptediso.ReadAllSectors(t, reencrypted))
+
+	t.Run("cleared regions map", func(t *testing.T) {
+		_, err := encrypted.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+
+		clearedISO, err := encryptediso.NewEncryptedISO(encrypted, key, true)
+		require.NoError(t, err)
+
+		_, err = encryptediso.NewDecryptedISO(writeTemp(t, "cleared.iso", clearedISO), key)
+		assert.Error(t, err)
+	})
+}
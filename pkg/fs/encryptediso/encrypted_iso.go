@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
 	"github.com/xakep666/ps3netsrv-go/internal/handler"
 	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
 )
@@ -30,11 +31,6 @@ var (
 	ivData1  = [encryptionKeySize]byte{0x69, 0x47, 0x47, 0x72, 0xaf, 0x6f, 0xda, 0xb3, 0x42, 0x74, 0x3a, 0xef, 0xaa, 0x18, 0x62, 0x87}
 )
 
-type cbcMode interface {
-	cipher.BlockMode
-	SetIV(iv []byte)
-}
-
 type region struct {
 	start, end iso9660.SizeSectors
 }
@@ -48,6 +44,17 @@ type unencryptedRegion struct {
 	Start, End uint32
 }
 
+// PutRegionsMap writes map of unencrypted regions to the beginning of decrypted image as it's placed in Redump images.
+// Regions are given as start and end (exclusive) sectors. Image must not be shorter than map.
+func PutRegionsMap(image []byte, unencrypted [][2]uint32) {
+	regionsMap, _ := binary.Append(nil, binary.BigEndian, unencryptedRegionsHeader{Count: uint32(len(unencrypted))})
+	for _, r := range unencrypted {
+		regionsMap, _ = binary.Append(regionsMap, binary.BigEndian, unencryptedRegion{Start: r[0], End: r[1]})
+	}
+
+	copy(image, regionsMap)
+}
+
 // EncryptedISO is a wrapper to decrypt encrypted images on-the-fly.
 // Redump (and 3k3y dump) is not completely encrypted.
 // It's consist from "regions" (one or more sectors). Only odd regions are encrypted.
@@ -60,54 +67,77 @@ type EncryptedISO struct {
 	clearRegions      bool
 	regionsHeaderSize iso9660.SizeBytes
 	encryptedRegions  []region
-	cbcDec            cbcMode
-	iv                []byte
+	dec               *sectorCrypter
+	cache             blockcache.Cache // optional cache of decrypted sectors
+	cacheKey          string
 	offset            iso9660.SizeBytes // to track where we are now without calling Seek
 }
 
 // NewEncryptedISO wraps File to EncryptedISO with provided "data1" key.
 // "clearRegions" defines if regions header should be zeroed during reads, some software can't handle non-clear header.
 func NewEncryptedISO(f handler.File, data1 []byte, clearRegions bool) (*EncryptedISO, error) {
+	regions, regionsHeaderSize, err := readRegions(f)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := newSectorCrypter(data1, cipher.NewCBCDecrypter)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedISO{
+		clearRegions:      clearRegions,
+		regionsHeaderSize: regionsHeaderSize,
+		privateFile:       f,
+		encryptedRegions:  regions,
+		dec:               dec,
+	}, nil
+}
+
+// readRegions reads unencrypted regions map from the beginning of image and returns encrypted regions.
+func readRegions(f handler.File) ([]region, iso9660.SizeBytes, error) {
 	// force seek to start for convenience
 	_, err := f.Seek(0, io.SeekStart)
 	if err != nil {
-		return nil, fmt.Errorf("seek start failed: %w", err)
+		return nil, 0, fmt.Errorf("seek start failed: %w", err)
 	}
 
 	var hdr unencryptedRegionsHeader
 	err = binary.Read(f, binary.BigEndian, &hdr)
 	if err != nil {
-		return nil, fmt.Errorf("read unencrypted regions count failed: %w", err)
+		return nil, 0, fmt.Errorf("read unencrypted regions count failed: %w", err)
+	}
+
+	if hdr.Count < 2 { // minimum 1 encrypted region
+		return nil, 0, fmt.Errorf("unexpected unencrypted regions count (%d)", hdr.Count)
 	}
 
 	unencryptedRegions := make([]unencryptedRegion, hdr.Count)
 	err = binary.Read(f, binary.BigEndian, unencryptedRegions)
 	if err != nil {
-		return nil, fmt.Errorf("read region map: %w", err)
+		return nil, 0, fmt.Errorf("read region map: %w", err)
 	}
 
 	_, err = f.Seek(0, io.SeekStart)
 	if err != nil {
-		return nil, fmt.Errorf("seek start failed: %w", err)
+		return nil, 0, fmt.Errorf("seek start failed: %w", err)
 	}
 
-	if hdr.Count < 2 { // minimum 1 encrypted region
-		return nil, fmt.Errorf("unexpected unencrypted regions count (%d)", hdr.Count)
-	}
 	if unencryptedRegions[0].Start != 0 {
-		return nil, fmt.Errorf("region 0 start is not zero (%#x)", unencryptedRegions[0].Start)
+		return nil, 0, fmt.Errorf("region 0 start is not zero (%#x)", unencryptedRegions[0].Start)
 	}
 
 	var prevRegionEnd uint32
-	encryptedRegions := make([]region, hdr.Count-1)
+	encryptedRegions := make([]region, 0, hdr.Count-1)
 	for i, unencryptedRegion := range unencryptedRegions {
 		// some sanity checks: region "borders" must increase monotonically
 		if unencryptedRegion.End <= unencryptedRegion.Start {
-			return nil, fmt.Errorf("region %d: end (%#x) less than start (%#x)",
+			return nil, 0, fmt.Errorf("region %d: end (%#x) less than start (%#x)",
 				i, unencryptedRegion.End, unencryptedRegion.Start)
 		}
 		if unencryptedRegion.Start < prevRegionEnd {
-			return nil, fmt.Errorf("region %d: start (%#x) less than previous region end (%#x)",
+			return nil, 0, fmt.Errorf("region %d: start (%#x) less than previous region end (%#x)",
 				i, unencryptedRegion.End, prevRegionEnd)
 		}
 		prevRegionEnd = unencryptedRegion.End
@@ -123,39 +153,17 @@ func NewEncryptedISO(f handler.File, data1 []byte, clearRegions bool) (*Encrypte
 		})
 	}
 
-	var isoKey [encryptionKeySize]byte
-	if err = deriveISOKey(isoKey[:], data1); err != nil {
-		return nil, fmt.Errorf("derive iso key failed: %w", err)
-	}
-
-	cip, err := aes.NewCipher(isoKey[:])
-	if err != nil {
-		return nil, err
-	}
-
-	var iv [encryptionKeySize]byte
-	return &EncryptedISO{
-		clearRegions:      clearRegions,
-		regionsHeaderSize: iso9660.SizeBytes(binary.Size(hdr) + binary.Size(unencryptedRegions)),
-		privateFile:       f,
-		encryptedRegions:  encryptedRegions,
-		cbcDec:            cipher.NewCBCDecrypter(cip, iv[:]).(cbcMode),
-		iv:                iv[:],
-	}, nil
+	return encryptedRegions, iso9660.SizeBytes(binary.Size(hdr) + binary.Size(unencryptedRegions)), nil
 }
 
 func (e *EncryptedISO) Read(b []byte) (int, error) {
-	readStart := e.offset
-
-	read, err := e.privateFile.Read(b)
-	if err != nil || read == 0 {
-		return read, err
-	}
+	read, err := readSectors(e.privateFile, e.offset, b, func(start iso9660.SizeBytes, data []byte) {
+		e.clearRegionsData(start, data)
+		e.decryptData(start, data)
+	})
 
 	e.offset += iso9660.SizeBytes(read)
-	e.clearRegionsData(readStart, b[:read])
-	e.decryptData(readStart, b[:read])
-	return read, nil
+	return read, err
 }
 
 func (e *EncryptedISO) Seek(offset int64, whence int) (int64, error) {
@@ -178,26 +186,30 @@ func (e *EncryptedISO) clearRegionsData(start iso9660.SizeBytes, data []byte) {
 	}
 }
 
+// SetSectorCache enables caching of decrypted sectors, so repeated reads of the same data don't waste CPU.
+// Key must identify both image content and disc key.
+func (e *EncryptedISO) SetSectorCache(cache blockcache.Cache, key string) {
+	e.cache, e.cacheKey = cache, key
+}
+
 func (e *EncryptedISO) decryptData(start iso9660.SizeBytes, data []byte) {
-	end := start + iso9660.SizeBytes(len(data))
-	for _, region := range e.encryptedRegions {
-		if region.end <= start.Sectors() || region.start > end.Sectors() { // not covered
-			continue
-		}
+	spans := regionSpans(e.encryptedRegions, start, data)
+	if e.cache == nil {
+		e.dec.crypt(spans)
+		return
+	}
 
-		startSector := max(region.start, start.FloorSectors())
-		endSector := min(region.end, end.Sectors())
-		for i := startSector; i < endSector; i++ {
-			encryptedSpan := data[i.Bytes()-start : i.Next().Bytes()-start]
-			e.setIVForSector(i).CryptBlocks(encryptedSpan, encryptedSpan)
+	missed := spans[:0]
+	for _, span := range spans {
+		if n, ok := e.cache.Get(e.cacheKey, int64(span.sector), span.data); !ok || n != len(span.data) {
+			missed = append(missed, span)
 		}
 	}
-}
 
-func (e *EncryptedISO) setIVForSector(sector iso9660.SizeSectors) cipher.BlockMode {
-	binary.BigEndian.PutUint32(e.iv[len(e.iv)-4:], uint32(sector))
-	e.cbcDec.SetIV(e.iv)
-	return e.cbcDec
+	e.dec.crypt(missed)
+	for _, span := range missed {
+		e.cache.Put(e.cacheKey, int64(span.sector), span.data)
+	}
 }
 
 func (e *EncryptedISO) Unwrap() handler.File {
@@ -220,3 +232,23 @@ func ReadKeyFile(f io.Reader) ([]byte, error) {
 	_, err := io.ReadFull(hex.NewDecoder(f), key[:])
 	return key[:], err
 }
+
+// Region is a range of sectors [Start, End).
+type Region struct {
+	Start, End iso9660.SizeSectors
+}
+
+// EncryptedRegions reads unencrypted regions map from the beginning of image and returns encrypted regions.
+func EncryptedRegions(f handler.File) ([]Region, error) {
+	regions, _, err := readRegions(f)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := make([]Region, len(regions))
+	for i, r := range regions {
+		ret[i] = Region{Start: r.start, End: r.end}
+	}
+
+	return ret, nil
+}
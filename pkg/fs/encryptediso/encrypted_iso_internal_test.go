@@ -0,0 +1,171 @@
+package encryptediso
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+)
+
+const readSize = 64 * 1024 // typical read size of console
+
+// makeEncryptedImage writes image with single small unencrypted region at the beginning and at the end.
+func makeEncryptedImage(tb testing.TB, sectors uint32) *os.File {
+	tb.Helper()
+
+	image := make([]byte, iso9660.SizeSectors(sectors).Bytes())
+	_, _ = rand.Read(image)
+
+	PutRegionsMap(image, [][2]uint32{{0, 1}, {sectors - 1, sectors}})
+
+	f, err := os.Create(filepath.Join(tb.TempDir(), "image.iso"))
+	require.NoError(tb, err)
+	tb.Cleanup(func() { _ = f.Close() })
+
+	_, err = f.Write(image)
+	require.NoError(tb, err)
+
+	return f
+}
+
+func newTestEncryptedISO(tb testing.TB, f *os.File, key []byte, workers int) *EncryptedISO {
+	tb.Helper()
+
+	_, err := f.Seek(0, io.SeekStart)
+	require.NoError(tb, err)
+
+	e, err := NewEncryptedISO(f, key, false)
+	require.NoError(tb, err)
+	e.dec.workers = workers
+
+	return e
+}
+
+// readAllSectors reads data by sector-aligned chunks as wrappers expect.
+func readAllSectors(tb testing.TB, r io.Reader) []byte {
+	tb.Helper()
+
+	var buf bytes.Buffer
+	_, err := io.CopyBuffer(struct{ io.Writer }{&buf}, struct{ io.Reader }{r}, make([]byte, readSize))
+	require.NoError(tb, err)
+
+	return buf.Bytes()
+}
+
+func TestEncryptedISO_ParallelAndCached(t *testing.T) {
+	f := makeEncryptedImage(t, 256)
+	key := make([]byte, encryptionKeySize)
+	_, _ = rand.Read(key)
+
+	expected := readAllSectors(t, newTestEncryptedISO(t, f, key, 1))
+
+	assert.Equal(t, expected, readAllSectors(t, newTestEncryptedISO(t, f, key, 4)), "parallel decryption")
+
+	cache := blockcache.NewMemory(1 << 20)
+	for range 2 { // cold and warm cache
+		e := newTestEncryptedISO(t, f, key, 4)
+		e.SetSectorCache(cache, "image")
+		assert.Equal(t, expected, readAllSectors(t, e), "cached decryption")
+	}
+}
+
+func TestUnalignedReads(t *testing.T) {
+	f := makeEncryptedImage(t, 16)
+	key := make([]byte, encryptionKeySize)
+	_, _ = rand.Read(key)
+
+	encrypted, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+
+	decrypted := readAllSectors(t, newTestEncryptedISO(t, f, key, 1))
+	decryptedFile, err := os.Create(filepath.Join(t.TempDir(), "decrypted.iso"))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = decryptedFile.Close() })
+	_, err = decryptedFile.Write(decrypted)
+	require.NoError(t, err)
+
+	reencrypted, err := NewDecryptedISO(decryptedFile, key)
+	require.NoError(t, err)
+
+	const sector = int64(iso9660.SectorSize)
+
+	for _, tc := range []struct {
+		offset, length int64
+	}{
+		{offset: 2 * sector, length: 20},
+		{offset: 2*sector + 100, length: 20},
+		{offset: 3*sector - 10, length: 20},
+		{offset: 511, length: 3 * sector},
+		{offset: 15*sector + 1000, length: sector}, // crosses end of image
+	} {
+		end := min(tc.offset+tc.length, int64(len(decrypted)))
+
+		for _, r := range []struct {
+			name     string
+			f        io.ReadSeeker
+			expected []byte
+		}{
+			{name: "encrypted", f: newTestEncryptedISO(t, f, key, 1), expected: decrypted[tc.offset:end]},
+			{name: "decrypted", f: reencrypted, expected: encrypted[tc.offset:end]},
+		} {
+			_, err := r.f.Seek(tc.offset, io.SeekStart)
+			require.NoError(t, err)
+
+			buf := make([]byte, tc.length)
+			n, err := io.ReadFull(r.f, buf)
+			if end-tc.offset < tc.length {
+				require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, r.expected, buf[:n], "%s: offset %d, length %d", r.name, tc.offset, tc.length)
+
+			pos, err := r.f.Seek(0, io.SeekCurrent)
+			require.NoError(t, err)
+			assert.Equal(t, end, pos, "%s: position after read", r.name)
+		}
+	}
+}
+
+func BenchmarkEncryptedISO_Read(b *testing.B) {
+	const sectors = 8192 // 16 MiB
+
+	f := makeEncryptedImage(b, sectors)
+	key := make([]byte, encryptionKeySize)
+	_, _ = rand.Read(key)
+
+	run := func(b *testing.B, e *EncryptedISO) {
+		buf := make([]byte, readSize)
+		b.SetBytes(readSize)
+		b.ResetTimer()
+		for b.Loop() {
+			if _, err := io.ReadFull(e, buf); err != nil {
+				_, _ = e.Seek(0, io.SeekStart)
+			}
+		}
+	}
+
+	b.Run("sequential", func(b *testing.B) {
+		run(b, newTestEncryptedISO(b, f, key, 1))
+	})
+	b.Run("parallel", func(b *testing.B) {
+		run(b, newTestEncryptedISO(b, f, key, runtime.GOMAXPROCS(0)))
+	})
+	b.Run("cached", func(b *testing.B) {
+		e := newTestEncryptedISO(b, f, key, runtime.GOMAXPROCS(0))
+		e.SetSectorCache(blockcache.NewMemory(2*int64(iso9660.SizeSectors(sectors).Bytes())), "image")
+		readAllSectors(b, e) // warm up
+		_, _ = e.Seek(0, io.SeekStart)
+
+		run(b, e)
+	})
+}
@@ -0,0 +1,3 @@
+package encryptediso
+
+var ReadAllSectors = readAllSectors
@@ -0,0 +1,194 @@
+package encryptediso
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+)
+
+var (
+	// ErrInvalidKey occurs when files in encrypted regions are not readable after decryption.
+	ErrInvalidKey = errors.New("disc key doesn't match image")
+
+	// ErrKeyUnverifiable occurs when image has no known files in encrypted regions to check key.
+	ErrKeyUnverifiable = errors.New("disc key can't be verified")
+)
+
+// fileMagics contains expected beginnings of files by upper-cased name or extension.
+var fileMagics = map[string][]byte{
+	"PARAM.SFO": []byte("\x00PSF"),
+	"EBOOT.BIN": []byte("SCE\x00"),
+	".SELF":     []byte("SCE\x00"),
+	".SPRX":     []byte("SCE\x00"),
+	".PNG":      []byte("\x89PNG"),
+	".SDAT":     []byte("NPD\x00"),
+	".EDAT":     []byte("NPD\x00"),
+}
+
+const (
+	keyCheckMaxFiles = 3
+	keyCheckMaxDirs  = 256
+)
+
+// CheckKey checks that image is decrypted correctly by reading beginnings of known files
+// (i.e. PARAM.SFO, EBOOT.BIN) located in encrypted regions. Filesystem structures are never encrypted,
+// so it's always possible to find such files.
+func (e *EncryptedISO) CheckKey() error {
+	defer e.Seek(0, io.SeekStart)
+
+	return checkDecryption(e, e.encryptedRegions)
+}
+
+// KeyChecks caches results of CheckKey by image identity, so image isn't checked on every open.
+// Only definite results (success, ErrInvalidKey and ErrKeyUnverifiable) are cached.
+// Only latest result is kept for each image name, so cache doesn't grow when images or keys are changed.
+type KeyChecks struct {
+	mu      sync.Mutex
+	results map[string]keyCheckResult // by image name
+}
+
+type keyCheckResult struct {
+	id  string
+	err error
+}
+
+func NewKeyChecks() *KeyChecks {
+	return &KeyChecks{results: make(map[string]keyCheckResult)}
+}
+
+// Check returns cached result of key check for image identified by id or checks key.
+// Id must identify both image content and disc key.
+func (c *KeyChecks) Check(name, id string, e *EncryptedISO) error {
+	c.mu.Lock()
+	result, ok := c.results[name]
+	c.mu.Unlock()
+	if ok && result.id == id {
+		return result.err
+	}
+
+	err := e.CheckKey()
+	if err == nil || errors.Is(err, ErrInvalidKey) || errors.Is(err, ErrKeyUnverifiable) {
+		c.mu.Lock()
+		c.results[name] = keyCheckResult{id: id, err: err}
+		c.mu.Unlock()
+	}
+
+	return err
+}
+
+// IsEncrypted tells if image is encrypted: it contains regions map and files in encrypted regions are not readable as is.
+func IsEncrypted(f handler.File) bool {
+	regions, _, err := readRegions(f)
+	if err != nil {
+		return false
+	}
+
+	defer f.Seek(0, io.SeekStart)
+
+	// image decrypted with kept regions map is readable as is
+	return checkDecryption(f, regions) != nil
+}
+
+// checkDecryption checks that files placed in encrypted regions are readable from r.
+func checkDecryption(r io.ReadSeeker, regions []region) error {
+	img, err := iso9660.OpenImage(sectorReaderAt{r})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrKeyUnverifiable, err)
+	}
+
+	var checked, mismatched int
+	queue := []iso9660.DirectoryEntry{img.Root()}
+	for dirs := 0; len(queue) > 0 && dirs < keyCheckMaxDirs && checked < keyCheckMaxFiles; dirs++ {
+		entries, err := img.ReadDir(queue[0])
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrKeyUnverifiable, err)
+		}
+		queue = queue[1:]
+
+		for _, e := range entries {
+			if e.FileFlags&iso9660.DirFlagDir != 0 {
+				queue = append(queue, e)
+				continue
+			}
+
+			name := strings.ToUpper(img.Name(e))
+			magic, ok := fileMagics[name]
+			if !ok {
+				magic, ok = fileMagics[path.Ext(name)]
+			}
+			if !ok || e.ExtentLength < iso9660.SizeBytes(len(magic)) || !inRegions(regions, e.ExtentLocation) {
+				continue
+			}
+
+			buf := make([]byte, iso9660.SectorSize)
+			if _, err := (sectorReaderAt{r}).ReadAt(buf, int64(e.ExtentLocation.Bytes())); err != nil {
+				return fmt.Errorf("read %s: %w", name, err)
+			}
+
+			// single match is enough, probability to get magic from garbage is negligible
+			if bytes.HasPrefix(buf, magic) {
+				return nil
+			}
+
+			mismatched++
+			if checked++; checked >= keyCheckMaxFiles {
+				break
+			}
+		}
+	}
+
+	if mismatched > 0 {
+		return ErrInvalidKey
+	}
+
+	return ErrKeyUnverifiable
+}
+
+func inRegions(regions []region, sector iso9660.SizeSectors) bool {
+	for _, r := range regions {
+		if sector >= r.start && sector < r.end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sectorReaderAt implements io.ReaderAt by reading whole sectors because decryption works per-sector.
+type sectorReaderAt struct {
+	r io.ReadSeeker
+}
+
+func (s sectorReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	start := iso9660.SizeBytes(off).FloorSectors().Bytes()
+	end := iso9660.SizeBytes(off + int64(len(p))).AlignToSectors()
+
+	if _, err := s.r.Seek(int64(start), io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, end-start)
+	n, err := io.ReadFull(s.r, buf)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = io.EOF
+	}
+
+	skip := int(iso9660.SizeBytes(off) - start)
+	if n <= skip {
+		return 0, err
+	}
+
+	copied := copy(p, buf[skip:n])
+	if copied == len(p) {
+		err = nil
+	}
+
+	return copied, err
+}
@@ -0,0 +1,143 @@
+package encryptediso_test
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+	"github.com/xakep666/ps3netsrv-go/internal/osutil/filesystem"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/viso"
+)
+
+// makeDisc makes decrypted disc image with regions map: header is unencrypted, files are encrypted.
+func makeDisc(t *testing.T) []byte {
+	t.Helper()
+
+	root, err := os.OpenRoot(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = root.Close() })
+
+	eboot := append([]byte("SCE\x00"), make([]byte, 5000)...)
+	_, _ = rand.Read(eboot[4:])
+
+	for name, content := range map[string][]byte{
+		"PS3_GAME/PARAM.SFO":        []byte("\x00PSF\x01\x01\x00\x00"),
+		"PS3_GAME/USRDIR/EBOOT.BIN": eboot,
+	} {
+		require.NoError(t, root.MkdirAll(filepath.Join("game", filepath.Dir(name)), os.ModePerm))
+		require.NoError(t, root.WriteFile(filepath.Join("game", name), content, os.ModePerm))
+	}
+
+	fsys := pkgfs.NewFS(filesystem.NewStrictSystemRoot(root), nil, nil)
+	generated, err := viso.NewVirtualISO(t.Context(), fsys, "game", false)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = generated.Close() })
+
+	fi, err := generated.Stat()
+	require.NoError(t, err)
+
+	disc := make([]byte, fi.Size())
+	_, err = io.ReadFull(generated, disc)
+	require.NoError(t, err)
+
+	img, err := iso9660.OpenImage(bytes.NewReader(disc))
+	require.NoError(t, err)
+
+	gameDir, err := img.ReadDir(img.Root())
+	require.NoError(t, err)
+	require.Len(t, gameDir, 1)
+	gameFiles, err := img.ReadDir(gameDir[0])
+	require.NoError(t, err)
+
+	var firstFile iso9660.SizeSectors
+	for _, e := range gameFiles {
+		if e.FileFlags&iso9660.DirFlagDir == 0 {
+			firstFile = e.ExtentLocation
+		}
+	}
+	require.NotZero(t, firstFile)
+
+	// unencrypted regions: header and last sector
+	lastSector := uint32(iso9660.SizeBytes(len(disc)).Sectors())
+	encryptediso.PutRegionsMap(disc, [][2]uint32{{0, uint32(firstFile)}, {lastSector - 1, lastSector}})
+
+	return disc
+}
+
+func TestEncryptedISO_CheckKey(t *testing.T) {
+	disc := makeDisc(t)
+
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+
+	decrypted := writeTemp(t, "decrypted.iso", bytes.NewReader(disc))
+	encryptedISO, err := encryptediso.NewDecryptedISO(decrypted, key)
+	require.NoError(t, err)
+	encrypted := writeTemp(t, "encrypted.iso", encryptedISO)
+
+	_, err = decrypted.Seek(0, io.SeekStart)
+	require.NoError(t, err)
+	assert.False(t, encryptediso.IsEncrypted(decrypted))
+	assert.True(t, encryptediso.IsEncrypted(encrypted))
+
+	t.Run("valid key", func(t *testing.T) {
+		f, err := encryptediso.NewEncryptedISO(encrypted, key, false)
+		require.NoError(t, err)
+
+		assert.NoError(t, f.CheckKey())
+
+		assert.Equal(t, disc, encryptediso.ReadAllSectors(t, f), "position must be reset after check")
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		wrongKey := make([]byte, 16)
+		_, _ = rand.Read(wrongKey)
+
+		f, err := encryptediso.NewEncryptedISO(encrypted, wrongKey, false)
+		require.NoError(t, err)
+
+		assert.ErrorIs(t, f.CheckKey(), encryptediso.ErrInvalidKey)
+	})
+}
+
+func TestKeyChecks(t *testing.T) {
+	disc := makeDisc(t)
+
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+
+	decrypted := writeTemp(t, "decrypted.iso", bytes.NewReader(disc))
+	encryptedISO, err := encryptediso.NewDecryptedISO(decrypted, key)
+	require.NoError(t, err)
+	encrypted := writeTemp(t, "encrypted.iso", encryptedISO)
+
+	wrongKey := make([]byte, 16)
+	_, _ = rand.Read(wrongKey)
+
+	checks := encryptediso.NewKeyChecks()
+	check := func(name, id string, key []byte) error {
+		f, err := encryptediso.NewEncryptedISO(encrypted, key, false)
+		require.NoError(t, err)
+		return checks.Check(name, id, f)
+	}
+
+	assert.NoError(t, check("a.iso", "valid", key))
+	assert.ErrorIs(t, check("b.iso", "invalid", wrongKey), encryptediso.ErrInvalidKey)
+
+	// results are taken from cache by id
+	assert.NoError(t, check("a.iso", "valid", wrongKey))
+	assert.ErrorIs(t, check("b.iso", "invalid", key), encryptediso.ErrInvalidKey)
+
+	// changed image is checked again and replaces previous result
+	assert.ErrorIs(t, check("a.iso", "changed", wrongKey), encryptediso.ErrInvalidKey)
+	assert.ErrorIs(t, check("a.iso", "valid", wrongKey), encryptediso.ErrInvalidKey)
+}
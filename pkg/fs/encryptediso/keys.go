@@ -0,0 +1,214 @@
+package encryptediso
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// KeySource provides disc keys for encrypted images.
+type KeySource interface {
+	// Key returns disc key by image name (file name without extension) or title ID (i.e. BLES00000).
+	// fs.ErrNotExist returned if source doesn't contain key.
+	Key(name string) ([]byte, error)
+}
+
+// OpenKeySource opens key source by path. Type of source detected by path:
+// * directory - contains .dkey files named like images or title IDs
+// * .zip - archive of .dkey files named like images or title IDs
+// * .csv - rows with image name or title ID in first column and hex-encoded key in second one
+// * .json - object with image names or title IDs as keys and hex-encoded keys as values
+func OpenKeySource(p string) (KeySource, error) {
+	fi, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.IsDir() {
+		return DirKeySource(p), nil
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(p)); ext {
+	case ".zip":
+		return readZipKeySource(p)
+	case ".csv", ".json":
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		if ext == ".csv" {
+			return ReadCSVKeySource(f)
+		}
+		return ReadJSONKeySource(f)
+	default:
+		return nil, fmt.Errorf("unsupported key source %s: directory, .zip, .csv or .json expected", p)
+	}
+}
+
+// DirKeySource looks for keys in directory with .dkey files.
+type DirKeySource string
+
+func (d DirKeySource) Key(name string) ([]byte, error) {
+	f, err := os.Open(filepath.Join(string(d), filepath.Base(name)+dkeyExt))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadKeyFile(f)
+}
+
+// MapKeySource is an in-memory key database. Names are case-insensitive.
+type MapKeySource map[string][]byte
+
+func (m MapKeySource) Key(name string) ([]byte, error) {
+	if key, ok := m[strings.ToUpper(name)]; ok {
+		return key, nil
+	}
+
+	return nil, fs.ErrNotExist
+}
+
+func (m MapKeySource) add(name, hexKey string) error {
+	key, err := ReadKeyFile(strings.NewReader(strings.TrimSpace(hexKey)))
+	if err != nil {
+		return fmt.Errorf("key for %s: %w", name, err)
+	}
+
+	m[strings.ToUpper(strings.TrimSpace(name))] = key
+	return nil
+}
+
+// ReadCSVKeySource reads keys from CSV with image name or title ID in first column and key in second one.
+// Rows with invalid key (i.e. header) are skipped.
+func ReadCSVKeySource(r io.Reader) (MapKeySource, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	ret := make(MapKeySource)
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return ret, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv: %w", err)
+		}
+
+		if len(record) < 2 {
+			continue
+		}
+
+		_ = ret.add(record[0], record[1])
+	}
+}
+
+// ReadJSONKeySource reads keys from JSON object with image names or title IDs as keys.
+func ReadJSONKeySource(r io.Reader) (MapKeySource, error) {
+	var entries map[string]string
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	ret := make(MapKeySource, len(entries))
+	for name, key := range entries {
+		if err := ret.add(name, key); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// readZipKeySource loads all .dkey files from archive. They're small so whole archive is kept in memory.
+func readZipKeySource(p string) (MapKeySource, error) {
+	zr, err := zip.OpenReader(p)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	ret := make(MapKeySource)
+	for _, zf := range zr.File {
+		name := path.Base(zf.Name)
+		if zf.FileInfo().IsDir() || !strings.EqualFold(path.Ext(name), dkeyExt) {
+			continue
+		}
+
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+
+		// limit to protect from garbage
+		content, err := io.ReadAll(io.LimitReader(rc, int64(4*hex.EncodedLen(encryptionKeySize))))
+		_ = rc.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+
+		if err := ret.add(strings.TrimSuffix(name, path.Ext(name)), string(bytes.TrimSpace(content))); err != nil {
+			return nil, fmt.Errorf("%s: %w", zf.Name, err)
+		}
+	}
+
+	return ret, nil
+}
+
+// KeyDB looks up keys in multiple sources in provided order and caches found ones.
+type KeyDB struct {
+	sources []KeySource
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+func NewKeyDB(sources ...KeySource) *KeyDB {
+	return &KeyDB{
+		sources: sources,
+		cache:   make(map[string][]byte),
+	}
+}
+
+func (db *KeyDB) Key(name string) ([]byte, error) {
+	cacheKey := strings.ToUpper(name)
+
+	db.mu.Lock()
+	key, ok := db.cache[cacheKey]
+	db.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	for _, src := range db.sources {
+		key, err := src.Key(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		db.mu.Lock()
+		db.cache[cacheKey] = key
+		db.mu.Unlock()
+
+		return key, nil
+	}
+
+	return nil, fs.ErrNotExist
+}
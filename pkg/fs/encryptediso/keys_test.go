@@ -0,0 +1,103 @@
+package encryptediso_test
+
+import (
+	"archive/zip"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+)
+
+func TestKeySources(t *testing.T) {
+	const (
+		key1 = "00112233445566778899aabbccddeeff"
+		key2 = "ffeeddccbbaa99887766554433221100"
+	)
+
+	decoded := func(s string) []byte {
+		ret, err := hex.DecodeString(s)
+		require.NoError(t, err)
+		return ret
+	}
+
+	dir := t.TempDir()
+
+	keysDir := filepath.Join(dir, "keys")
+	require.NoError(t, os.Mkdir(keysDir, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(keysDir, "Game (USA).dkey"), []byte(key1), os.ModePerm))
+
+	zipPath := filepath.Join(dir, "keys.zip")
+	zf, err := os.Create(zipPath)
+	require.NoError(t, err)
+	zw := zip.NewWriter(zf)
+	w, err := zw.Create("keys/Game (USA).dkey")
+	require.NoError(t, err)
+	_, err = w.Write([]byte(key1 + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, zf.Close())
+
+	csvPath := filepath.Join(dir, "keys.csv")
+	require.NoError(t, os.WriteFile(csvPath, []byte("serial,key\nBLUS12345,"+strings.ToUpper(key2)+"\n"), os.ModePerm))
+
+	jsonPath := filepath.Join(dir, "keys.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"bles54321": "`+key2+`"}`), os.ModePerm))
+
+	for _, tc := range []struct {
+		path     string
+		name     string
+		expected []byte
+	}{
+		{path: keysDir, name: "Game (USA)", expected: decoded(key1)},
+		{path: zipPath, name: "game (usa)", expected: decoded(key1)},
+		{path: csvPath, name: "BLUS12345", expected: decoded(key2)},
+		{path: jsonPath, name: "BLES54321", expected: decoded(key2)},
+	} {
+		t.Run(filepath.Base(tc.path), func(t *testing.T) {
+			src, err := encryptediso.OpenKeySource(tc.path)
+			require.NoError(t, err)
+
+			key, err := src.Key(tc.name)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, key)
+
+			_, err = src.Key("unknown")
+			assert.ErrorIs(t, err, fs.ErrNotExist)
+		})
+	}
+
+	t.Run("db", func(t *testing.T) {
+		var sources []encryptediso.KeySource
+		for _, p := range []string{keysDir, csvPath} {
+			src, err := encryptediso.OpenKeySource(p)
+			require.NoError(t, err)
+			sources = append(sources, src)
+		}
+
+		db := encryptediso.NewKeyDB(sources...)
+
+		key, err := db.Key("Game (USA)")
+		require.NoError(t, err)
+		assert.Equal(t, decoded(key1), key)
+
+		key, err = db.Key("BLUS12345")
+		require.NoError(t, err)
+		assert.Equal(t, decoded(key2), key)
+
+		// served from cache
+		require.NoError(t, os.Remove(filepath.Join(keysDir, "Game (USA).dkey")))
+		key, err = db.Key("Game (USA)")
+		require.NoError(t, err)
+		assert.Equal(t, decoded(key1), key)
+
+		_, err = db.Key("unknown")
+		assert.ErrorIs(t, err, fs.ErrNotExist)
+	})
+}
@@ -0,0 +1,161 @@
+package encryptediso
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+)
+
+const (
+	// parallelMinSectors is a minimal amount of sectors processed in parallel.
+	// Smaller reads are processed on caller goroutine because goroutines start costs more.
+	parallelMinSectors = 8
+)
+
+type cbcMode interface {
+	cipher.BlockMode
+	SetIV(iv []byte)
+}
+
+// sectorSpan is a sector data to encrypt or decrypt.
+type sectorSpan struct {
+	sector iso9660.SizeSectors
+	data   []byte
+}
+
+// sectorCrypter encrypts or decrypts (depending on mode) sectors. Each sector is processed separately
+// with sector number as IV, so sectors are independent and may be processed in parallel.
+type sectorCrypter struct {
+	block   cipher.Block // aes block is stateless, so it's safe for concurrent use
+	newMode func(b cipher.Block, iv []byte) cipher.BlockMode
+	workers int
+}
+
+// newSectorCrypter creates CBC encrypter or decrypter with key derived from "data1" key.
+func newSectorCrypter(data1 []byte, newMode func(b cipher.Block, iv []byte) cipher.BlockMode) (*sectorCrypter, error) {
+	var isoKey [encryptionKeySize]byte
+	if err := deriveISOKey(isoKey[:], data1); err != nil {
+		return nil, fmt.Errorf("derive iso key failed: %w", err)
+	}
+
+	cip, err := aes.NewCipher(isoKey[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &sectorCrypter{
+		block:   cip,
+		newMode: newMode,
+		workers: runtime.GOMAXPROCS(0),
+	}, nil
+}
+
+// regionSpans returns whole sectors of data (read from start) covered by encrypted regions.
+// Partially covered sectors can't be processed, callers must read whole sectors (see readSectors).
+func regionSpans(regions []region, start iso9660.SizeBytes, data []byte) []sectorSpan {
+	var ret []sectorSpan
+
+	end := start + iso9660.SizeBytes(len(data))
+	for _, region := range regions {
+		startSector := max(region.start, start.Sectors())
+		endSector := min(region.end, end.FloorSectors())
+		for i := startSector; i < endSector; i++ {
+			ret = append(ret, sectorSpan{sector: i, data: data[i.Bytes()-start : i.Next().Bytes()-start]})
+		}
+	}
+
+	return ret
+}
+
+// cryptRegions encrypts or decrypts parts of data covered by encrypted regions.
+func (c *sectorCrypter) cryptRegions(regions []region, start iso9660.SizeBytes, data []byte) {
+	c.crypt(regionSpans(regions, start, data))
+}
+
+// crypt processes sectors in place. Large amount of sectors is split between workers.
+func (c *sectorCrypter) crypt(spans []sectorSpan) {
+	if len(spans) < parallelMinSectors || c.workers <= 1 {
+		c.cryptSequential(spans)
+		return
+	}
+
+	chunkSize := max((len(spans)+c.workers-1)/c.workers, parallelMinSectors/2)
+
+	var wg sync.WaitGroup
+	for chunk := range slices.Chunk(spans, chunkSize) {
+		wg.Go(func() {
+			c.cryptSequential(chunk)
+		})
+	}
+	wg.Wait()
+}
+
+func (c *sectorCrypter) cryptSequential(spans []sectorSpan) {
+	var iv [encryptionKeySize]byte
+	mode := c.newMode(c.block, iv[:]).(cbcMode)
+
+	for _, span := range spans {
+		setIVForSector(iv[:], span.sector)
+		mode.SetIV(iv[:])
+		mode.CryptBlocks(span.data, span.data)
+	}
+}
+
+// setIVForSector makes IV for sector: it's a big-endian sector number.
+func setIVForSector(iv []byte, sector iso9660.SizeSectors) {
+	clear(iv)
+	binary.BigEndian.PutUint32(iv[len(iv)-4:], uint32(sector))
+}
+
+// readSectors reads data at offset start of f (f must be positioned there) to b and processes it in place.
+// Sectors are encrypted independently, so unaligned reads are extended to sector borders
+// using temporary buffer and only requested part is copied to b. After return f is positioned right after returned data.
+func readSectors(f io.ReadSeeker, start iso9660.SizeBytes, b []byte, process func(start iso9660.SizeBytes, data []byte)) (int, error) {
+	alignedStart := start.FloorSectors().Bytes()
+	alignedEnd := (start + iso9660.SizeBytes(len(b))).AlignToSectors()
+	if alignedStart == start && alignedEnd == start+iso9660.SizeBytes(len(b)) {
+		// full sectors requested, read and process in place
+		n, err := io.ReadFull(f, b)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = nil // short image, next read returns EOF
+		}
+
+		process(start, b[:n])
+		return n, err
+	}
+
+	if _, err := f.Seek(int64(alignedStart), io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, alignedEnd-alignedStart)
+	n, err := io.ReadFull(f, buf)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+
+	skip := int(start - alignedStart)
+	copied := 0
+	if n > skip {
+		process(alignedStart, buf[:n])
+		copied = copy(b, buf[skip:n])
+	}
+
+	if _, seekErr := f.Seek(int64(start)+int64(copied), io.SeekStart); seekErr != nil && err == nil {
+		err = seekErr
+	}
+
+	if copied == 0 && err == nil {
+		err = io.EOF
+	}
+
+	return copied, err
+}
@@ -2,63 +2,159 @@ package encryptediso
 
 import (
 	"context"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
 	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
 	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
 )
 
-type FileWrapper struct{}
+type FileWrapper struct {
+	// Keys is an optional database used if key file not found near image.
+	// Key is looked up by image name first and then by title ID read from image.
+	Keys KeySource
+
+	// RawOnInvalidKey makes wrapper serve image as is if key doesn't match it. Open is refused otherwise.
+	RawOnInvalidKey bool
+
+	// SectorCache is an optional cache of decrypted sectors shared between opened images.
+	SectorCache blockcache.Cache
+
+	// KeyChecks is an optional cache of key check results, without it key is checked on every open.
+	KeyChecks *KeyChecks
+}
 
 type keyedFile interface {
 	handler.File
 	EncryptionKey() []byte
 }
 
-func (FileWrapper) WrapFile(ctx context.Context, fsys *pkgfs.FS, f handler.File) (handler.File, error) {
-	if kf, ok := handler.FileAsType[keyedFile](f); ok {
-		slog.Debug("received encrypted key-contained iso", slog.String("name", f.Name()))
-		return NewEncryptedISO(f, kf.EncryptionKey(), false)
-	}
-
-	key, err := tryGetRedumpKey(fsys.SystemRoot(), f.Name())
+func (w FileWrapper) WrapFile(ctx context.Context, fsys *pkgfs.FS, f handler.File) (handler.File, error) {
+	key, err := w.FindKey(ctx, fsys, f)
 	switch {
 	case errors.Is(err, nil):
-		slog.DebugContext(ctx, "found key file for encrypted iso", slog.String("name", f.Name()))
-		return NewEncryptedISO(f, key, false)
 	case errors.Is(err, fs.ErrNotExist):
 		return f, nil
 	default:
 		return nil, fmt.Errorf("read key: %w", err)
 	}
+
+	encrypted, err := NewEncryptedISO(f, key, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var id string // identifies image content and key
+	if w.SectorCache != nil || w.KeyChecks != nil {
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+
+		id = blockcache.Key(
+			f.Name(), strconv.FormatInt(fi.Size(), 10), strconv.FormatInt(fi.ModTime().UnixNano(), 10), hex.EncodeToString(key),
+		)
+	}
+
+	if w.SectorCache != nil {
+		encrypted.SetSectorCache(w.SectorCache, id)
+	}
+
+	if w.KeyChecks != nil {
+		err = w.KeyChecks.Check(f.Name(), id, encrypted)
+	} else {
+		err = encrypted.CheckKey()
+	}
+	switch {
+	case errors.Is(err, nil):
+		return encrypted, nil
+	case errors.Is(err, ErrKeyUnverifiable):
+		slog.DebugContext(ctx, "Disc key can't be verified", slog.String("name", f.Name()), logutil.ErrorAttr(err))
+		return encrypted, nil
+	case errors.Is(err, ErrInvalidKey) && w.RawOnInvalidKey:
+		slog.ErrorContext(ctx, "Disc key doesn't match image, serving it without decryption", slog.String("name", f.Name()))
+		return f, nil
+	case errors.Is(err, ErrInvalidKey):
+		slog.ErrorContext(ctx, "Disc key doesn't match image, refusing to serve it", slog.String("name", f.Name()))
+		return nil, err
+	default:
+		return nil, fmt.Errorf("check key: %w", err)
+	}
+}
+
+// FindKey looks for disc key of image: embedded one (3k3y), key file near image or key in database.
+// fs.ErrNotExist returned if key not found.
+func (w FileWrapper) FindKey(ctx context.Context, fsys *pkgfs.FS, f handler.File) ([]byte, error) {
+	if kf, ok := handler.FileAsType[keyedFile](f); ok {
+		slog.DebugContext(ctx, "received encrypted key-contained iso", slog.String("name", f.Name()))
+		return kf.EncryptionKey(), nil
+	}
+
+	key, err := tryGetRedumpKey(fsys.SystemRoot(), f.Name())
+	if errors.Is(err, fs.ErrNotExist) && w.Keys != nil && MayBeEncrypted(f.Name()) {
+		key, err = w.lookupKey(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	slog.DebugContext(ctx, "found key file for encrypted iso", slog.String("name", f.Name()))
+	return key, nil
 }
 
 func (FileWrapper) Name() string {
 	return "redump_encrypted_iso"
 }
 
-// tryGetRedumpKey attempts to find encryption key for .iso image.
-func tryGetRedumpKey(fsys pkgfs.SystemRoot, requestedPath string) ([]byte, error) {
-	// encryption makes sense only for .iso or .ISO file inside ps3ISO or PS3ISO directory
-	ext := filepath.Ext(requestedPath)
-	if strings.EqualFold(ext, isoExt) {
+// lookupKey searches key database by image name and then by title ID.
+func (w FileWrapper) lookupKey(f handler.File) ([]byte, error) {
+	name := filepath.Base(f.Name())
+	key, err := w.Keys.Key(strings.TrimSuffix(name, filepath.Ext(name)))
+	if !errors.Is(err, fs.ErrNotExist) {
+		return key, err
+	}
+
+	// disc info sector is never encrypted
+	titleID := iso9660.TitleID(f)
+	if titleID == "" {
 		return nil, fs.ErrNotExist
 	}
 
-	pathElems := strings.Split(requestedPath, string(filepath.Separator))
-	ps3IsoIdx := slices.IndexFunc(pathElems, func(s string) bool {
+	return w.Keys.Key(titleID)
+}
+
+// MayBeEncrypted tells if file may be encrypted image.
+// Encryption makes sense only for .iso or .ISO file inside ps3ISO or PS3ISO directory.
+func MayBeEncrypted(requestedPath string) bool {
+	return strings.EqualFold(filepath.Ext(requestedPath), isoExt) && ps3isoDirIndex(requestedPath) >= 0
+}
+
+func ps3isoDirIndex(requestedPath string) int {
+	return slices.IndexFunc(strings.Split(requestedPath, string(filepath.Separator)), func(s string) bool {
 		return strings.EqualFold(s, ps3isoDir)
 	})
-	if ps3IsoIdx < 0 {
+}
+
+// tryGetRedumpKey attempts to find encryption key for .iso image.
+func tryGetRedumpKey(fsys pkgfs.SystemRoot, requestedPath string) ([]byte, error) {
+	if !MayBeEncrypted(requestedPath) {
 		return nil, fs.ErrNotExist
 	}
 
+	ext := filepath.Ext(requestedPath)
+	pathElems := strings.Split(requestedPath, string(filepath.Separator))
+	ps3IsoIdx := ps3isoDirIndex(requestedPath)
+
 	// try .dkey file first
 	keyFile, err := fsys.Open(strings.TrimSuffix(requestedPath, ext) + dkeyExt)
 	if err == nil {
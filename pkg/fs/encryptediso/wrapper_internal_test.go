@@ -0,0 +1,77 @@
+package encryptediso
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/osutil/filesystem"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+)
+
+func TestFileWrapper_FindKey(t *testing.T) {
+	keyNear := bytes.Repeat([]byte{0x11}, 16)
+	keyRedkey := bytes.Repeat([]byte{0x22}, 16)
+	keyDB := bytes.Repeat([]byte{0x33}, 16)
+
+	dir := t.TempDir()
+	for name, content := range map[string][]byte{
+		"PS3ISO/near.iso":    nil,
+		"PS3ISO/near.dkey":   []byte(hex.EncodeToString(keyNear)),
+		"PS3ISO/redkey.iso":  nil,
+		"REDKEY/redkey.dkey": []byte(hex.EncodeToString(keyRedkey)),
+		"PS3ISO/db.iso":      nil,
+		"GAMES/other.iso":    nil,
+		"GAMES/other.dkey":   []byte(hex.EncodeToString(keyNear)),
+		"PS3ISO/image.bin":   nil,
+		"PS3ISO/image.dkey":  []byte(hex.EncodeToString(keyNear)),
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), os.ModePerm))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), content, os.ModePerm))
+	}
+
+	root, err := os.OpenRoot(dir)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = root.Close() })
+
+	w := FileWrapper{Keys: MapKeySource{"DB": keyDB}}
+
+	for rootName, systemRoot := range map[string]pkgfs.SystemRoot{
+		"relaxed": pkgfs.NewRelaxedSystemRoot(dir),
+		"strict":  filesystem.NewStrictSystemRoot(root),
+	} {
+		fsys := pkgfs.NewFS(systemRoot, nil, nil)
+
+		for _, tc := range []struct {
+			path string
+			key  []byte
+		}{
+			{path: "PS3ISO/near.iso", key: keyNear},
+			{path: "PS3ISO/redkey.iso", key: keyRedkey},
+			{path: "PS3ISO/db.iso", key: keyDB},
+			{path: "GAMES/other.iso"},
+			{path: "PS3ISO/image.bin"},
+		} {
+			t.Run(rootName+" "+tc.path, func(t *testing.T) {
+				f, err := fsys.Open(t.Context(), filepath.FromSlash(tc.path))
+				require.NoError(t, err)
+				t.Cleanup(func() { _ = f.Close() })
+
+				key, err := w.FindKey(t.Context(), fsys, f)
+				if tc.key == nil {
+					assert.ErrorIs(t, err, fs.ErrNotExist)
+					return
+				}
+
+				require.NoError(t, err)
+				assert.Equal(t, tc.key, key)
+			})
+		}
+	}
+}
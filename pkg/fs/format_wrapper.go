@@ -0,0 +1,20 @@
+package fs
+
+import (
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+)
+
+// formatWrapper remembers openers and wrappers applied to file.
+type formatWrapper struct {
+	handler.File
+
+	format []string
+}
+
+func (fw *formatWrapper) Format() []string {
+	return fw.format
+}
+
+func (fw *formatWrapper) Unwrap() handler.File {
+	return fw.File
+}
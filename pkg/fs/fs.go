@@ -13,10 +13,11 @@ import (
 	"github.com/xakep666/ps3netsrv-go/internal/handler"
 )
 
-// SystemRoot needed to abstract *os.Root and it's relaxed implementation that allows outside symlinks.
+// SystemRoot needed to abstract *os.Root, it's relaxed implementation that allows outside symlinks
+// and non-local storages (i.e. upstream server).
 type SystemRoot interface {
-	Open(path string) (*os.File, error)
-	Create(path string) (*os.File, error)
+	Open(path string) (handler.File, error)
+	Create(path string) (handler.WritableFile, error)
 	Stat(path string) (fs.FileInfo, error)
 	Remove(path string) error
 	Mkdir(path string, mode os.FileMode) error
@@ -57,6 +58,7 @@ func (fsys *FS) Open(ctx context.Context, path string) (handler.File, error) {
 	log := slog.With(slog.String("path_request", path), slog.String("fs_op", "open"))
 
 	var file handler.File
+	var format []string // applied openers and wrappers
 	var err error
 openerLoop:
 	for _, opener := range fsys.openers {
@@ -65,6 +67,7 @@ openerLoop:
 		switch {
 		case errors.Is(err, nil):
 			log.DebugContext(ctx, "Opener succeeded", slog.String("opener", opener.Name()))
+			format = append(format, opener.Name())
 			break openerLoop
 		case errors.Is(err, ErrTryNext):
 			continue
@@ -80,6 +83,8 @@ openerLoop:
 		if err != nil {
 			return nil, err
 		}
+
+		file = &namedWrapper{File: file, name: path}
 	}
 
 	// special wrapper for directories to process ReadDir with opener's Stat
@@ -101,10 +106,18 @@ openerLoop:
 
 	for _, wrapper := range fsys.wrappers {
 		log.Debug("Applying wrapper", slog.String("wrapper", wrapper.Name()))
-		file, err = wrapper.WrapFile(ctx, fsys, file)
+		wrapped, err := wrapper.WrapFile(ctx, fsys, file)
 		if err != nil {
 			return nil, fmt.Errorf("wrapper %s: %w", wrapper.Name(), err)
 		}
+		if wrapped != file {
+			format = append(format, wrapper.Name())
+		}
+		file = wrapped
+	}
+
+	if len(format) > 0 && !stat.IsDir() {
+		file = &formatWrapper{File: file, format: format}
 	}
 
 	return file, nil
@@ -0,0 +1,67 @@
+package httproot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	"github.com/xakep666/ps3netsrv-go/internal/remotefs"
+)
+
+// file reads data using Range requests through block cache.
+type file struct {
+	*blockcache.Reader
+
+	root *SystemRoot
+	name string
+	url  string
+	info *remotefs.FileInfo
+}
+
+func (f *file) fetch(p []byte, off int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := f.root.do(ctx, http.MethodGet, f.url, http.Header{
+		"Range": {fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1)},
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		// pass
+	case http.StatusOK:
+		// range ignored by server, we can only handle reads from beginning
+		if off != 0 {
+			return fmt.Errorf("server doesn't support range requests")
+		}
+	default:
+		return statusError(resp)
+	}
+
+	_, err = io.ReadFull(resp.Body, p)
+	return err
+}
+
+func (f *file) ReadDir(int) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+func (f *file) Close() error {
+	return nil
+}
@@ -0,0 +1,222 @@
+package httproot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/xakep666/ps3netsrv-go/internal/remotefs"
+)
+
+// maxListingSize limits size of directory listing response.
+const maxListingSize = 16 << 20
+
+// jsonEntry is an entry of nginx-style JSON directory index.
+type jsonEntry struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	MTime string `json:"mtime"`
+	Size  int64  `json:"size"`
+}
+
+func (r *SystemRoot) list(ctx context.Context, name string) ([]fs.DirEntry, error) {
+	dirURL := r.fileURL(name, true)
+
+	resp, err := r.do(ctx, http.MethodGet, dirURL, http.Header{
+		"Accept": {"application/json, text/html;q=0.9"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	body := io.LimitReader(resp.Body, maxListingSize)
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		return parseJSONListing(body)
+	case "text/html", "":
+		links, err := parseHTMLListing(body, resp.Request.URL)
+		if err != nil {
+			return nil, err
+		}
+
+		entries := make([]fs.DirEntry, 0, len(links))
+		for _, link := range links {
+			entries = append(entries, &lazyEntry{
+				root:  r,
+				name:  filepath.Join(name, link.name),
+				base:  link.name,
+				isDir: link.isDir,
+			})
+		}
+
+		return entries, nil
+	default:
+		return nil, fmt.Errorf("unsupported listing content type %q", mediaType)
+	}
+}
+
+func parseJSONListing(body io.Reader) ([]fs.DirEntry, error) {
+	var items []jsonEntry
+	if err := json.NewDecoder(body).Decode(&items); err != nil {
+		return nil, fmt.Errorf("decode json listing: %w", err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(items))
+	for _, item := range items {
+		if !validEntryName(item.Name) {
+			continue
+		}
+
+		var modTime time.Time
+		if item.MTime != "" {
+			modTime, _ = http.ParseTime(item.MTime)
+		}
+
+		info := &remotefs.FileInfo{
+			FileName:  item.Name,
+			Directory: item.Type == "directory",
+			Modified:  modTime,
+		}
+		if !info.Directory {
+			info.FileSize = item.Size
+		}
+
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+
+	return entries, nil
+}
+
+type htmlLink struct {
+	name  string
+	isDir bool
+}
+
+// parseHTMLListing extracts links to direct children of dirURL from autoindex-like page.
+func parseHTMLListing(body io.Reader, dirURL *url.URL) ([]htmlLink, error) {
+	var (
+		links []htmlLink
+		seen  = make(map[string]struct{})
+	)
+
+	tokenizer := html.NewTokenizer(body)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			if err := tokenizer.Err(); err != io.EOF {
+				return nil, fmt.Errorf("parse html listing: %w", err)
+			}
+			return links, nil
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tagName, hasAttr := tokenizer.TagName()
+			if string(tagName) != "a" || !hasAttr {
+				continue
+			}
+
+			for {
+				key, val, more := tokenizer.TagAttr()
+				if string(key) == "href" {
+					if link, ok := childLink(dirURL, string(val)); ok {
+						if _, dup := seen[link.name]; !dup {
+							seen[link.name] = struct{}{}
+							links = append(links, link)
+						}
+					}
+				}
+				if !more {
+					break
+				}
+			}
+		}
+	}
+}
+
+func childLink(dirURL *url.URL, href string) (htmlLink, bool) {
+	ref, err := url.Parse(href)
+	if err != nil || ref.RawQuery != "" || ref.Fragment != "" {
+		return htmlLink{}, false
+	}
+
+	target := dirURL.ResolveReference(ref)
+	if target.Scheme != dirURL.Scheme || target.Host != dirURL.Host {
+		return htmlLink{}, false
+	}
+
+	dirPath := dirURL.Path
+	if !strings.HasSuffix(dirPath, "/") {
+		dirPath += "/"
+	}
+
+	rest, ok := strings.CutPrefix(target.Path, dirPath)
+	if !ok {
+		return htmlLink{}, false
+	}
+
+	rest, isDir := strings.CutSuffix(rest, "/")
+	if !validEntryName(rest) {
+		return htmlLink{}, false
+	}
+
+	return htmlLink{name: rest, isDir: isDir}, true
+}
+
+func validEntryName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.Contains(name, "/")
+}
+
+// lazyEntry requests file information from server on demand because html listing doesn't contain it reliably.
+type lazyEntry struct {
+	root  *SystemRoot
+	name  string
+	base  string
+	isDir bool
+	info  fs.FileInfo
+}
+
+func (e *lazyEntry) Name() string { return e.base }
+
+func (e *lazyEntry) IsDir() bool { return e.isDir }
+
+func (e *lazyEntry) Type() fs.FileMode {
+	if e.isDir {
+		return fs.ModeDir
+	}
+	return 0
+}
+
+func (e *lazyEntry) Info() (fs.FileInfo, error) {
+	if e.info != nil {
+		return e.info, nil
+	}
+
+	if e.isDir {
+		// directory info is not useful and may be expensive to get
+		e.info = &remotefs.FileInfo{FileName: e.base, Directory: true}
+		return e.info, nil
+	}
+
+	info, err := e.root.Stat(e.name)
+	if err != nil {
+		return nil, err
+	}
+
+	e.info = info
+	return info, nil
+}
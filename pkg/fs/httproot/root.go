@@ -0,0 +1,194 @@
+// Package httproot implements read-only [pkgfs.SystemRoot] that serves files from HTTP(S) server.
+// Server must support HEAD and Range requests. Directory listings are parsed from
+// JSON index (i.e. nginx "autoindex_format json") or from autoindex HTML page.
+package httproot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/remotefs"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+)
+
+// requestTimeout limits a single request to server.
+const requestTimeout = time.Minute
+
+var errReadOnly = errors.New("http root is read-only")
+
+// SystemRoot serves files located under base URL.
+type SystemRoot struct {
+	base      *url.URL
+	client    *http.Client
+	cache     blockcache.Cache
+	blockSize int64
+}
+
+var _ pkgfs.SystemRoot = (*SystemRoot)(nil)
+
+// NewSystemRoot creates SystemRoot for provided base URL. Cache may be nil to disable caching.
+// Credentials for basic authentication may be provided in URL.
+func NewSystemRoot(baseURL string, client *http.Client, cache blockcache.Cache, blockSize int64) (*SystemRoot, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse base url: %w", err)
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme %q", base.Scheme)
+	}
+
+	base.Path = strings.TrimSuffix(base.Path, "/")
+
+	return &SystemRoot{
+		base:      base,
+		client:    client,
+		cache:     cache,
+		blockSize: blockSize,
+	}, nil
+}
+
+// IsURL tells if provided root is an URL supported by SystemRoot.
+func IsURL(root string) bool {
+	return strings.HasPrefix(root, "http://") || strings.HasPrefix(root, "https://")
+}
+
+func (r *SystemRoot) fileURL(name string, dir bool) string {
+	elems := strings.Split(filepath.ToSlash(name), "/")
+	u := r.base.JoinPath(elems...)
+	if dir && !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	return u.String()
+}
+
+func (r *SystemRoot) do(ctx context.Context, method, url string, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	return r.client.Do(req)
+}
+
+func statusError(resp *http.Response) error {
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return fs.ErrNotExist
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return fs.ErrPermission
+	default:
+		return fmt.Errorf("unexpected response status: %s", resp.Status)
+	}
+}
+
+func (r *SystemRoot) Stat(name string) (fs.FileInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	info, err := r.stat(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return info, nil
+}
+
+func (r *SystemRoot) stat(ctx context.Context, name string) (*remotefs.FileInfo, error) {
+	baseName := path.Base("/" + filepath.ToSlash(name))
+	if name == "" || name == "." {
+		return &remotefs.FileInfo{FileName: baseName, Directory: true}, nil
+	}
+
+	resp, err := r.do(ctx, http.MethodHead, r.fileURL(name, false), nil)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+
+	// servers usually redirect directory requests to path with trailing slash
+	isDir := strings.HasSuffix(resp.Request.URL.Path, "/")
+
+	var modTime time.Time
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		modTime, _ = http.ParseTime(lastModified)
+	}
+
+	info := &remotefs.FileInfo{
+		FileName:  baseName,
+		Directory: isDir,
+		Modified:  modTime,
+	}
+	if !isDir {
+		info.FileSize = resp.ContentLength
+		if info.FileSize < 0 {
+			return nil, fmt.Errorf("server didn't provide content length")
+		}
+	}
+
+	return info, nil
+}
+
+func (r *SystemRoot) Open(name string) (handler.File, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	info, err := r.stat(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if info.IsDir() {
+		return remotefs.NewDir(name, info, func() ([]fs.DirEntry, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+			defer cancel()
+
+			return r.list(ctx, name)
+		}), nil
+	}
+
+	f := &file{
+		root: r,
+		name: name,
+		url:  r.fileURL(name, false),
+		info: info,
+	}
+	f.Reader = blockcache.NewReader(r.cache,
+		blockcache.Key(f.url, strconv.FormatInt(info.FileSize, 10), strconv.FormatInt(info.Modified.Unix(), 10)),
+		r.blockSize, info.FileSize, f.fetch,
+	)
+
+	return f, nil
+}
+
+func (r *SystemRoot) Create(name string) (handler.WritableFile, error) {
+	return nil, &fs.PathError{Op: "create", Path: name, Err: errReadOnly}
+}
+
+func (r *SystemRoot) Remove(name string) error {
+	return &fs.PathError{Op: "remove", Path: name, Err: errReadOnly}
+}
+
+func (r *SystemRoot) Mkdir(name string, _ os.FileMode) error {
+	return &fs.PathError{Op: "mkdir", Path: name, Err: errReadOnly}
+}
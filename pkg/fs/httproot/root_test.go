@@ -0,0 +1,201 @@
+package httproot_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	seekable "github.com/SaveTheRbtz/zstd-seekable-format-go/pkg"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/httproot"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/seekablezstd"
+)
+
+const blockSize = 4096
+
+func prepareRoot(t *testing.T) (string, []byte) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	content := make([]byte, 3*blockSize+123)
+	_, _ = rand.Read(content)
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "PS3ISO"), os.ModePerm))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "PS3ISO", "sub"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "PS3ISO", "game.iso"), content, os.ModePerm))
+
+	return dir, content
+}
+
+// jsonIndex mimics nginx "autoindex_format json" for directories.
+func jsonIndex(dir string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || !strings.HasSuffix(r.URL.Path, "/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		entries, err := os.ReadDir(filepath.Join(dir, filepath.FromSlash(r.URL.Path)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		type item struct {
+			Name  string `json:"name"`
+			Type  string `json:"type"`
+			MTime string `json:"mtime"`
+			Size  int64  `json:"size,omitempty"`
+		}
+
+		var items []item
+		for _, entry := range entries {
+			info, _ := entry.Info()
+			it := item{Name: entry.Name(), Type: "file", MTime: info.ModTime().UTC().Format(http.TimeFormat)}
+			if entry.IsDir() {
+				it.Type = "directory"
+			} else {
+				it.Size = info.Size()
+			}
+			items = append(items, it)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(items)
+	})
+}
+
+func TestSystemRoot(t *testing.T) {
+	dir, content := prepareRoot(t)
+
+	for _, tc := range []struct {
+		name    string
+		handler http.Handler
+	}{
+		{name: "html", handler: http.FileServer(http.Dir(dir))},
+		{name: "json", handler: jsonIndex(dir, http.FileServer(http.Dir(dir)))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var requests atomic.Int64
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				tc.handler.ServeHTTP(w, r)
+			}))
+			t.Cleanup(srv.Close)
+
+			root, err := httproot.NewSystemRoot(srv.URL, srv.Client(), blockcache.NewMemory(1<<20), blockSize)
+			require.NoError(t, err)
+
+			t.Run("stat", func(t *testing.T) {
+				fi, err := root.Stat(filepath.Join("PS3ISO", "game.iso"))
+				require.NoError(t, err)
+				assert.Equal(t, "game.iso", fi.Name())
+				assert.Equal(t, int64(len(content)), fi.Size())
+				assert.False(t, fi.IsDir())
+
+				fi, err = root.Stat("PS3ISO")
+				require.NoError(t, err)
+				assert.True(t, fi.IsDir())
+
+				_, err = root.Stat(filepath.Join("PS3ISO", "missing.iso"))
+				assert.ErrorIs(t, err, os.ErrNotExist)
+			})
+
+			t.Run("readdir", func(t *testing.T) {
+				d, err := root.Open("PS3ISO")
+				require.NoError(t, err)
+				defer d.Close()
+
+				entries, err := d.ReadDir(-1)
+				require.NoError(t, err)
+				require.Len(t, entries, 2)
+
+				sizes := make(map[string]int64)
+				for _, entry := range entries {
+					info, err := entry.Info()
+					require.NoError(t, err)
+					assert.Equal(t, entry.Name() == "sub", entry.IsDir())
+					sizes[entry.Name()] = info.Size()
+				}
+				assert.Equal(t, int64(len(content)), sizes["game.iso"])
+			})
+
+			t.Run("range read", func(t *testing.T) {
+				f, err := root.Open(filepath.Join("PS3ISO", "game.iso"))
+				require.NoError(t, err)
+				defer f.Close()
+
+				_, err = f.Seek(blockSize/2, io.SeekStart)
+				require.NoError(t, err)
+
+				data, err := io.ReadAll(f)
+				require.NoError(t, err)
+				assert.Equal(t, content[blockSize/2:], data)
+
+				// second read must be served from cache
+				before := requests.Load()
+				_, err = f.Seek(0, io.SeekStart)
+				require.NoError(t, err)
+				data, err = io.ReadAll(f)
+				require.NoError(t, err)
+				assert.Equal(t, content, data)
+				assert.Equal(t, before, requests.Load())
+			})
+
+			t.Run("read-only", func(t *testing.T) {
+				_, err := root.Create("file.bin")
+				assert.Error(t, err)
+				assert.Error(t, root.Mkdir("GAMES", os.ModePerm))
+				assert.Error(t, root.Remove(filepath.Join("PS3ISO", "game.iso")))
+			})
+		})
+	}
+}
+
+func TestSystemRootWithOpener(t *testing.T) {
+	dir, content := prepareRoot(t)
+
+	var compressed bytes.Buffer
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	w, err := seekable.NewWriter(&compressed, enc)
+	require.NoError(t, err)
+	for chunk := range slices.Chunk(content, blockSize) {
+		_, err = w.Write(chunk)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "PS3ISO", "packed.zst"), compressed.Bytes(), os.ModePerm))
+
+	srv := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	t.Cleanup(srv.Close)
+
+	root, err := httproot.NewSystemRoot(srv.URL, srv.Client(), nil, blockSize)
+	require.NoError(t, err)
+
+	fsys := pkgfs.NewFS(root, []pkgfs.FileOpener{seekablezstd.Opener{}}, nil)
+
+	f, err := fsys.Open(context.Background(), filepath.Join("PS3ISO", "packed.zst.iso"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
@@ -0,0 +1,19 @@
+package fs
+
+import "github.com/xakep666/ps3netsrv-go/internal/handler"
+
+// namedWrapper makes file opened from system root report requested path as name, not the real one.
+// Wrappers use name to find related files (i.e. disc key) through system root.
+type namedWrapper struct {
+	handler.File
+
+	name string
+}
+
+func (nw *namedWrapper) Name() string {
+	return nw.name
+}
+
+func (nw *namedWrapper) Unwrap() handler.File {
+	return nw.File
+}
@@ -0,0 +1,240 @@
+// Package recent provides virtual directory with recently played games in each category root (i.e. "PS3ISO/RECENT"),
+// so they're easily accessible from console.
+package recent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+)
+
+// Source lists recently played games.
+type Source interface {
+	// Recent returns slash-separated paths relative to root of games played in category, newest first.
+	Recent(category string) []string
+}
+
+// Opener serves virtual directory named Dir in category roots having recently played games.
+// Entries of directory are served from original locations.
+type Opener struct {
+	Source Source
+	Dir    string
+}
+
+// resolve translates requested path to original one. Empty original path means virtual directory itself.
+func (o *Opener) resolve(p string) (games []string, original string, err error) {
+	parts := strings.SplitN(p, string(filepath.Separator), 4)
+	if len(parts) < 2 || parts[1] != o.Dir {
+		return nil, "", pkgfs.ErrTryNext
+	}
+
+	games = o.Source.Recent(parts[0])
+	if len(games) == 0 {
+		return nil, "", pkgfs.ErrTryNext
+	}
+
+	if len(parts) == 2 {
+		return games, "", nil
+	}
+
+	for _, game := range games {
+		if path.Base(game) != parts[2] {
+			continue
+		}
+
+		original = filepath.FromSlash(game)
+		if len(parts) == 4 {
+			original = filepath.Join(original, parts[3])
+		}
+
+		return games, original, nil
+	}
+
+	return nil, "", fmt.Errorf("%q: %w", p, fs.ErrNotExist)
+}
+
+func (o *Opener) Open(ctx context.Context, fsys *pkgfs.FS, p string) (handler.File, error) {
+	games, original, err := o.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if original != "" {
+		return fsys.Open(ctx, original)
+	}
+
+	d := &dir{name: p, modTime: time.Now()}
+	for _, game := range games {
+		st, err := fsys.Stat(ctx, filepath.FromSlash(game))
+		if err != nil {
+			continue // game was removed
+		}
+
+		d.entries = append(d.entries, fs.FileInfoToDirEntry(&renamedInfo{FileInfo: st, name: path.Base(game)}))
+	}
+
+	return d, nil
+}
+
+func (o *Opener) Stat(ctx context.Context, fsys *pkgfs.FS, p string) (fs.FileInfo, error) {
+	_, original, err := o.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+
+	if original == "" {
+		return &dirInfo{name: o.Dir, modTime: time.Now()}, nil
+	}
+
+	st, err := fsys.Stat(ctx, original)
+	if err != nil {
+		return nil, err
+	}
+
+	return &renamedInfo{FileInfo: st, name: filepath.Base(p)}, nil
+}
+
+func (o *Opener) Name() string {
+	return "recent"
+}
+
+// FileWrapper adds virtual directory to listing of category roots having recently played games.
+type FileWrapper struct {
+	Source Source
+	Dir    string
+}
+
+func (w *FileWrapper) WrapFile(ctx context.Context, fsys *pkgfs.FS, f handler.File) (handler.File, error) {
+	name := strings.Trim(f.Name(), string(filepath.Separator))
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return f, nil // not a category root
+	}
+
+	fi, err := f.Stat()
+	if err != nil || !fi.IsDir() {
+		return f, nil
+	}
+
+	if len(w.Source.Recent(name)) == 0 {
+		return f, nil
+	}
+
+	return &categoryDir{
+		File:  f,
+		entry: fs.FileInfoToDirEntry(&dirInfo{name: w.Dir, modTime: time.Now()}),
+	}, nil
+}
+
+func (w *FileWrapper) Name() string {
+	return "recent"
+}
+
+// categoryDir puts virtual directory entry at the beginning of listing.
+type categoryDir struct {
+	handler.File
+
+	entry fs.DirEntry
+	added bool
+}
+
+func (d *categoryDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.added {
+		return d.File.ReadDir(n)
+	}
+
+	d.added = true
+	if n == 1 {
+		return []fs.DirEntry{d.entry}, nil
+	}
+
+	if n > 0 {
+		n--
+	}
+
+	entries, err := d.File.ReadDir(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil
+	}
+	if err != nil {
+		return entries, err
+	}
+
+	return append([]fs.DirEntry{d.entry}, entries...), nil
+}
+
+func (d *categoryDir) Unwrap() handler.File {
+	return d.File
+}
+
+// dir is a virtual directory with entries listed at open.
+type dir struct {
+	name    string
+	modTime time.Time
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	return &dirInfo{name: filepath.Base(d.name), modTime: d.modTime}, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.ErrUnsupported}
+}
+
+func (d *dir) Seek(int64, int) (int64, error) {
+	return 0, nil
+}
+
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	entries := d.entries[d.offset:]
+	if n > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+
+		entries = entries[:min(n, len(entries))]
+	}
+
+	d.offset += len(entries)
+	return entries, nil
+}
+
+func (d *dir) Close() error {
+	return nil
+}
+
+func (d *dir) Name() string {
+	return d.name
+}
+
+type dirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+func (i *dirInfo) Name() string       { return i.name }
+func (i *dirInfo) Size() int64        { return 0 }
+func (i *dirInfo) Mode() fs.FileMode  { return fs.ModeDir | 0o555 }
+func (i *dirInfo) ModTime() time.Time { return i.modTime }
+func (i *dirInfo) IsDir() bool        { return true }
+func (i *dirInfo) Sys() any           { return nil }
+
+type renamedInfo struct {
+	fs.FileInfo
+
+	name string
+}
+
+func (i *renamedInfo) Name() string { return i.name }
+
+func (i *renamedInfo) Unwrap() fs.FileInfo { return i.FileInfo }
@@ -0,0 +1,89 @@
+package recent_test
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/recent"
+)
+
+type source map[string][]string
+
+func (s source) Recent(category string) []string {
+	return s[category]
+}
+
+func TestRecent(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "PS3ISO", "sub"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "PS2ISO"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "PS3ISO", "a.iso"), []byte("a content"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "PS3ISO", "sub", "b.iso"), []byte("b content"), 0o644))
+
+	src := source{"PS3ISO": {"PS3ISO/sub/b.iso", "PS3ISO/a.iso", "PS3ISO/removed.iso"}}
+	fsys := pkgfs.NewFS(pkgfs.NewRelaxedSystemRoot(root),
+		[]pkgfs.FileOpener{&recent.Opener{Source: src, Dir: "RECENT"}},
+		[]pkgfs.FileWrapper{&recent.FileWrapper{Source: src, Dir: "RECENT"}},
+	)
+
+	listNamesPaged := func(t *testing.T, path string, n int) []string {
+		t.Helper()
+
+		d, err := fsys.Open(t.Context(), path)
+		require.NoError(t, err)
+		defer d.Close()
+
+		var names []string
+		for {
+			entries, err := d.ReadDir(n)
+			if err == io.EOF {
+				return names
+			}
+			require.NoError(t, err)
+
+			for _, e := range entries {
+				names = append(names, e.Name())
+			}
+			if n <= 0 {
+				return names
+			}
+		}
+	}
+
+	listNames := func(t *testing.T, path string) []string {
+		return listNamesPaged(t, path, 1)
+	}
+
+	for _, n := range []int{-1, 1, 2, 3, 10} {
+		names := listNamesPaged(t, "/PS3ISO", n)
+		assert.ElementsMatch(t, []string{"a.iso", "sub", "RECENT"}, names, "page size %d", n)
+		if assert.NotEmpty(t, names) {
+			assert.Equal(t, "RECENT", names[0], "recent directory must be listed first, page size %d", n)
+		}
+	}
+
+	assert.Empty(t, listNames(t, "/PS2ISO"), "category without played games must not have recent directory")
+	assert.Equal(t, []string{"b.iso", "a.iso"}, listNames(t, "/PS3ISO/RECENT"), "removed games must be skipped")
+
+	st, err := fsys.Stat(t.Context(), "/PS3ISO/RECENT/b.iso")
+	require.NoError(t, err)
+	assert.Equal(t, "b.iso", st.Name())
+	assert.EqualValues(t, len("b content"), st.Size())
+
+	f, err := fsys.Open(t.Context(), "/PS3ISO/RECENT/b.iso")
+	require.NoError(t, err)
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, "b content", string(content))
+
+	_, err = fsys.Open(t.Context(), "/PS3ISO/RECENT/unknown.iso")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
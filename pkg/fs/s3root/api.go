@@ -0,0 +1,292 @@
+package s3root
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorBodySize limits size of error response read from server.
+const maxErrorBodySize = 64 * 1024
+
+// responseError is an error returned by S3 server.
+type responseError struct {
+	StatusCode int    `xml:"-"`
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *responseError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("s3 error: status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("s3 error: status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *responseError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return fs.ErrNotExist
+	case http.StatusForbidden, http.StatusUnauthorized:
+		return fs.ErrPermission
+	default:
+		return nil
+	}
+}
+
+func readResponseError(resp *http.Response) error {
+	respErr := &responseError{StatusCode: resp.StatusCode}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	_ = xml.Unmarshal(body, respErr)
+	return respErr
+}
+
+type objectInfo struct {
+	Key          string    `xml:"Key"`
+	Size         int64     `xml:"Size"`
+	LastModified time.Time `xml:"LastModified"`
+	ETag         string    `xml:"ETag"`
+}
+
+type listResult struct {
+	IsTruncated           bool         `xml:"IsTruncated"`
+	NextContinuationToken string       `xml:"NextContinuationToken"`
+	Contents              []objectInfo `xml:"Contents"`
+	CommonPrefixes        []struct {
+		Prefix string `xml:"Prefix"`
+	} `xml:"CommonPrefixes"`
+}
+
+type initiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type completeMultipartUpload struct {
+	XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+	Parts   []completedPart `xml:"Part"`
+}
+
+// objectURL makes URL to object or bucket itself if key is empty.
+func (r *SystemRoot) objectURL(key string, query url.Values) *url.URL {
+	u := *r.endpoint
+
+	var p string
+	if r.cfg.PathStyle {
+		p = "/" + r.cfg.Bucket
+		if key != "" {
+			p += "/" + key
+		}
+	} else {
+		u.Host = r.cfg.Bucket + "." + u.Host
+		p = "/" + key
+	}
+
+	u.Path = strings.TrimSuffix(r.endpoint.Path, "/") + p
+	u.RawPath = uriEncode(u.Path, true)
+	u.RawQuery = canonicalQuery(query)
+
+	return &u
+}
+
+// do sends signed request. Non-2xx responses are converted to errors.
+func (r *SystemRoot) do(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, r.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.ContentLength = int64(len(body))
+	if body == nil {
+		req.Body = http.NoBody
+	}
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = sha256Hex(body)
+	}
+
+	if r.cfg.AccessKeyID != "" {
+		signRequest(req, r.cfg.AccessKeyID, r.cfg.SecretAccessKey, r.cfg.Region, payloadHash, time.Now())
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		return nil, readResponseError(resp)
+	}
+
+	return resp, nil
+}
+
+func (r *SystemRoot) doXML(ctx context.Context, method, key string, query url.Values, body []byte, out any) error {
+	resp, err := r.do(ctx, method, key, query, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	if err := xml.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SystemRoot) headObject(ctx context.Context, key string) (*objectInfo, error) {
+	resp, err := r.do(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+
+	info := &objectInfo{
+		Key:  key,
+		Size: resp.ContentLength,
+		ETag: resp.Header.Get("ETag"),
+	}
+	if lastModified := resp.Header.Get("Last-Modified"); lastModified != "" {
+		info.LastModified, _ = http.ParseTime(lastModified)
+	}
+
+	return info, nil
+}
+
+func (r *SystemRoot) getObjectRange(ctx context.Context, key, etag string, p []byte, off int64) error {
+	header := http.Header{
+		"Range": {fmt.Sprintf("bytes=%d-%d", off, off+int64(len(p))-1)},
+	}
+	if etag != "" {
+		header.Set("If-Match", etag) // don't mix data of different object versions
+	}
+
+	resp, err := r.do(ctx, http.MethodGet, key, nil, header, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.ReadFull(resp.Body, p)
+	return err
+}
+
+// listObjects lists objects and common prefixes under provided prefix using "/" as a delimiter.
+// Callback called for every page.
+func (r *SystemRoot) listObjects(ctx context.Context, prefix string, maxKeys int, fn func(*listResult) bool) error {
+	var continuationToken string
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {prefix},
+			"delimiter": {"/"},
+		}
+		if maxKeys > 0 {
+			query.Set("max-keys", strconv.Itoa(maxKeys))
+		}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+
+		var result listResult
+		if err := r.doXML(ctx, http.MethodGet, "", query, nil, &result); err != nil {
+			return err
+		}
+
+		if !fn(&result) || !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+func (r *SystemRoot) putObject(ctx context.Context, key string, data []byte) error {
+	if data == nil {
+		data = []byte{} // send "Content-Length: 0" explicitly
+	}
+	return r.doXML(ctx, http.MethodPut, key, nil, data, nil)
+}
+
+func (r *SystemRoot) deleteObject(ctx context.Context, key string) error {
+	return r.doXML(ctx, http.MethodDelete, key, nil, nil, nil)
+}
+
+func (r *SystemRoot) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	var result initiateMultipartUploadResult
+	if err := r.doXML(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, nil, &result); err != nil {
+		return "", err
+	}
+
+	if result.UploadID == "" {
+		return "", errors.New("server returned empty upload id")
+	}
+
+	return result.UploadID, nil
+}
+
+func (r *SystemRoot) uploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (string, error) {
+	resp, err := r.do(ctx, http.MethodPut, key, url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadID},
+	}, nil, data)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return resp.Header.Get("ETag"), nil
+}
+
+func (r *SystemRoot) completeMultipartUpload(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(&completeMultipartUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	// server may report an error with successful status code after it started to send response
+	var result struct {
+		XMLName xml.Name
+		responseError
+	}
+	if err := r.doXML(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, body, &result); err != nil {
+		return err
+	}
+
+	if result.XMLName.Local == "Error" {
+		result.StatusCode = http.StatusOK
+		return &result.responseError
+	}
+
+	return nil
+}
+
+func (r *SystemRoot) abortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	return r.doXML(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+}
@@ -0,0 +1,223 @@
+package s3root
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	"github.com/xakep666/ps3netsrv-go/internal/remotefs"
+)
+
+// readDir lists objects and common prefixes with "directory" prefix.
+func (r *SystemRoot) readDir(name string) ([]fs.DirEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	dirPrefix := r.objectKey(name)
+	if dirPrefix != "" {
+		dirPrefix += "/"
+	}
+
+	var entries []fs.DirEntry
+	err := r.listObjects(ctx, dirPrefix, 0, func(result *listResult) bool {
+		for _, commonPrefix := range result.CommonPrefixes {
+			name := strings.TrimSuffix(strings.TrimPrefix(commonPrefix.Prefix, dirPrefix), "/")
+			if name == "" {
+				continue
+			}
+
+			entries = append(entries, fs.FileInfoToDirEntry(&remotefs.FileInfo{FileName: name, Directory: true, Writable: true}))
+		}
+
+		for _, obj := range result.Contents {
+			name := strings.TrimPrefix(obj.Key, dirPrefix)
+			if name == "" {
+				continue // directory marker
+			}
+
+			entries = append(entries, fs.FileInfoToDirEntry(&remotefs.FileInfo{
+				FileName: name,
+				FileSize: obj.Size,
+				Writable: true,
+				Modified: obj.LastModified,
+			}))
+		}
+
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// file reads object using ranged GetObject requests through block cache.
+type file struct {
+	*blockcache.Reader
+
+	root *SystemRoot
+	name string
+	key  string
+	etag string
+	info *remotefs.FileInfo
+}
+
+func (f *file) fetch(p []byte, off int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	return f.root.getObjectRange(ctx, f.key, f.etag, p, off)
+}
+
+func (f *file) ReadDir(int) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+func (f *file) Close() error {
+	return nil
+}
+
+// writableFile uploads written data using multipart upload.
+// Data is buffered until part is filled, small files are uploaded by a single request on Close.
+type writableFile struct {
+	root *SystemRoot
+	name string
+	key  string
+
+	buf      []byte
+	uploadID string
+	parts    []completedPart
+	written  int64
+	err      error // upload failed, all subsequent writes fail too
+}
+
+func (f *writableFile) uploadPart(ctx context.Context, data []byte) error {
+	if f.uploadID == "" {
+		uploadID, err := f.root.createMultipartUpload(ctx, f.key)
+		if err != nil {
+			return fmt.Errorf("create multipart upload: %w", err)
+		}
+		f.uploadID = uploadID
+	}
+
+	partNumber := len(f.parts) + 1
+	etag, err := f.root.uploadPart(ctx, f.key, f.uploadID, partNumber, data)
+	if err != nil {
+		return fmt.Errorf("upload part %d: %w", partNumber, err)
+	}
+
+	f.parts = append(f.parts, completedPart{PartNumber: partNumber, ETag: etag})
+	return nil
+}
+
+// abort cancels multipart upload to not leave garbage in storage.
+func (f *writableFile) abort() {
+	if f.uploadID == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	_ = f.root.abortMultipartUpload(ctx, f.key, f.uploadID)
+	f.uploadID = ""
+}
+
+func (f *writableFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	f.buf = append(f.buf, p...)
+	f.written += int64(len(p))
+
+	partSize := int(f.root.cfg.PartSize)
+	for len(f.buf) >= partSize {
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		err := f.uploadPart(ctx, f.buf[:partSize])
+		cancel()
+		if err != nil {
+			f.abort()
+			f.err = &fs.PathError{Op: "write", Path: f.name, Err: err}
+			return 0, f.err
+		}
+
+		f.buf = append(f.buf[:0], f.buf[partSize:]...)
+	}
+
+	return len(p), nil
+}
+
+func (f *writableFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *writableFile) ReadDir(int) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *writableFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.written, nil
+	}
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *writableFile) Stat() (fs.FileInfo, error) {
+	return &remotefs.FileInfo{
+		FileName: path.Base(f.key),
+		FileSize: f.written,
+		Writable: true,
+		Modified: time.Now(),
+	}, nil
+}
+
+func (f *writableFile) Name() string {
+	return f.name
+}
+
+func (f *writableFile) Close() error {
+	if f.err != nil {
+		return f.err
+	}
+	f.err = fs.ErrClosed
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if f.uploadID == "" {
+		if err := f.root.putObject(ctx, f.key, f.buf); err != nil {
+			return &fs.PathError{Op: "close", Path: f.name, Err: err}
+		}
+		return nil
+	}
+
+	if len(f.buf) > 0 {
+		if err := f.uploadPart(ctx, f.buf); err != nil {
+			f.abort()
+			return &fs.PathError{Op: "close", Path: f.name, Err: err}
+		}
+	}
+
+	if err := f.root.completeMultipartUpload(ctx, f.key, f.uploadID, f.parts); err != nil {
+		f.abort()
+		return &fs.PathError{Op: "close", Path: f.name, Err: fmt.Errorf("complete multipart upload: %w", err)}
+	}
+
+	return nil
+}
@@ -0,0 +1,285 @@
+// Package s3root implements [pkgfs.SystemRoot] on top of S3-compatible object storage.
+// Objects are read using ranged GetObject requests, "directories" are key prefixes delimited by "/".
+// Writes are implemented using multipart upload.
+package s3root
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/remotefs"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+)
+
+const (
+	// requestTimeout limits a single request to storage.
+	requestTimeout = time.Minute
+
+	// MinPartSize is a minimal size of multipart upload part allowed by S3 (except the last one).
+	MinPartSize = 5 << 20
+
+	// DefaultPartSize used if Config.PartSize is not set.
+	DefaultPartSize = 16 << 20
+
+	defaultRegion = "us-east-1"
+)
+
+// Config describes bucket access.
+type Config struct {
+	// Endpoint is an URL of storage, i.e. "https://s3.amazonaws.com" or "http://localhost:9000".
+	Endpoint string
+	// Region used for request signing.
+	Region string
+	Bucket string
+	// Prefix is a key prefix used as root directory.
+	Prefix string
+
+	// AccessKeyID and SecretAccessKey are used to sign requests. Requests are sent anonymously if AccessKeyID is empty.
+	AccessKeyID     string
+	SecretAccessKey string
+
+	// PathStyle enables path-style requests ("endpoint/bucket/key") instead of virtual-hosted style ("bucket.endpoint/key").
+	// Usually required for self-hosted storages.
+	PathStyle bool
+
+	// PartSize is a size of part for multipart upload.
+	PartSize int64
+}
+
+// SystemRoot serves objects from bucket.
+type SystemRoot struct {
+	cfg       Config
+	endpoint  *url.URL
+	prefix    string
+	client    *http.Client
+	cache     blockcache.Cache
+	blockSize int64
+}
+
+var _ pkgfs.SystemRoot = (*SystemRoot)(nil)
+
+// NewSystemRoot creates SystemRoot for provided bucket. Cache may be nil to disable caching of object data.
+func NewSystemRoot(cfg Config, client *http.Client, cache blockcache.Cache, blockSize int64) (*SystemRoot, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("parse endpoint: %w", err)
+	}
+
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported endpoint scheme %q", endpoint.Scheme)
+	}
+
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("bucket must be provided")
+	}
+
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+
+	switch {
+	case cfg.PartSize == 0:
+		cfg.PartSize = DefaultPartSize
+	case cfg.PartSize < MinPartSize:
+		return nil, fmt.Errorf("part size must be at least %d bytes", MinPartSize)
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &SystemRoot{
+		cfg:       cfg,
+		endpoint:  endpoint,
+		prefix:    prefix,
+		client:    client,
+		cache:     cache,
+		blockSize: blockSize,
+	}, nil
+}
+
+// objectKey converts path to object key. Empty key means root.
+func (r *SystemRoot) objectKey(name string) string {
+	p := path.Clean("/" + filepath.ToSlash(name))
+	if p == "/" {
+		return strings.TrimSuffix(r.prefix, "/")
+	}
+
+	return r.prefix + p[1:]
+}
+
+func (r *SystemRoot) isRoot(key string) bool {
+	return key == strings.TrimSuffix(r.prefix, "/")
+}
+
+func (r *SystemRoot) Stat(name string) (fs.FileInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	info, _, err := r.stat(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return info, nil
+}
+
+// stat returns information about object or "directory".
+// For objects etag returned to detect object changes.
+func (r *SystemRoot) stat(ctx context.Context, name string) (info *remotefs.FileInfo, etag string, err error) {
+	key := r.objectKey(name)
+	baseName := path.Base("/" + filepath.ToSlash(name))
+	if r.isRoot(key) {
+		return &remotefs.FileInfo{FileName: baseName, Directory: true, Writable: true}, "", nil
+	}
+
+	obj, err := r.headObject(ctx, key)
+	switch {
+	case errors.Is(err, nil):
+		return &remotefs.FileInfo{
+			FileName: baseName,
+			FileSize: obj.Size,
+			Writable: true,
+			Modified: obj.LastModified,
+		}, obj.ETag, nil
+	case errors.Is(err, fs.ErrNotExist):
+		// check if it's a "directory"
+	default:
+		return nil, "", err
+	}
+
+	var isDir bool
+	err = r.listObjects(ctx, key+"/", 1, func(result *listResult) bool {
+		isDir = len(result.Contents) > 0 || len(result.CommonPrefixes) > 0
+		return false
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !isDir {
+		return nil, "", fs.ErrNotExist
+	}
+
+	return &remotefs.FileInfo{FileName: baseName, Directory: true, Writable: true}, "", nil
+}
+
+func (r *SystemRoot) Open(name string) (handler.File, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	info, etag, err := r.stat(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	if info.IsDir() {
+		return remotefs.NewDir(name, info, func() ([]fs.DirEntry, error) {
+			return r.readDir(name)
+		}), nil
+	}
+
+	f := &file{
+		root: r,
+		name: name,
+		key:  r.objectKey(name),
+		etag: etag,
+		info: info,
+	}
+	f.Reader = blockcache.NewReader(r.cache,
+		blockcache.Key(r.cfg.Endpoint, r.cfg.Bucket, f.key, etag, strconv.FormatInt(info.FileSize, 10)),
+		r.blockSize, info.FileSize, f.fetch,
+	)
+
+	return f, nil
+}
+
+func (r *SystemRoot) Create(name string) (handler.WritableFile, error) {
+	key := r.objectKey(name)
+	if r.isRoot(key) {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return &writableFile{
+		root: r,
+		name: name,
+		key:  key,
+	}, nil
+}
+
+func (r *SystemRoot) Remove(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if err := r.remove(ctx, name); err != nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: err}
+	}
+
+	return nil
+}
+
+func (r *SystemRoot) remove(ctx context.Context, name string) error {
+	key := r.objectKey(name)
+	if r.isRoot(key) {
+		return fs.ErrInvalid
+	}
+
+	info, _, err := r.stat(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return r.deleteObject(ctx, key)
+	}
+
+	// only empty "directory" may be removed, it may contain only a marker object
+	dirPrefix := key + "/"
+	var notEmpty bool
+	err = r.listObjects(ctx, dirPrefix, 2, func(result *listResult) bool {
+		notEmpty = len(result.CommonPrefixes) > 0
+		for _, obj := range result.Contents {
+			notEmpty = notEmpty || obj.Key != dirPrefix
+		}
+		return false
+	})
+	if err != nil {
+		return err
+	}
+
+	if notEmpty {
+		return errors.New("directory not empty")
+	}
+
+	return r.deleteObject(ctx, dirPrefix)
+}
+
+func (r *SystemRoot) Mkdir(name string, _ os.FileMode) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	key := r.objectKey(name)
+	if _, _, err := r.stat(ctx, name); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	// "directory" exists only if there are objects with its prefix, so put an empty marker object
+	if err := r.putObject(ctx, key+"/", nil); err != nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: err}
+	}
+
+	return nil
+}
@@ -0,0 +1,403 @@
+package s3root_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	seekable "github.com/SaveTheRbtz/zstd-seekable-format-go/pkg"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/s3root"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/seekablezstd"
+)
+
+const (
+	bucket    = "games"
+	blockSize = 4096
+)
+
+// fakeS3 is a minimal in-memory S3 stand-in supporting path-style requests to a single bucket.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	uploads map[string]map[int][]byte
+	gets    int
+
+	failPuts bool // respond with error to object and part uploads
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects: make(map[string][]byte),
+		uploads: make(map[string]map[int][]byte),
+	}
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func (s *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key/") {
+		s.writeError(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+bucket)
+	if !ok {
+		s.writeError(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key = strings.TrimPrefix(key, "/")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	query := r.URL.Query()
+	switch {
+	case s.failPuts && r.Method == http.MethodPut:
+		s.writeError(w, http.StatusInternalServerError, "InternalError")
+	case key == "" && r.Method == http.MethodGet:
+		s.list(w, query)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		uploadID := strconv.Itoa(len(s.uploads) + 1)
+		s.uploads[uploadID] = make(map[int][]byte)
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		data, _ := io.ReadAll(r.Body)
+		parts[partNumber] = data
+		w.Header().Set("ETag", etag(data))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		parts, ok := s.uploads[query.Get("uploadId")]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var req struct {
+			Parts []struct {
+				PartNumber int
+				ETag       string
+			} `xml:"Part"`
+		}
+		if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeError(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		var data []byte
+		for _, part := range req.Parts {
+			if etag(parts[part.PartNumber]) != part.ETag || (len(parts[part.PartNumber]) < s3root.MinPartSize && part.PartNumber != len(req.Parts)) {
+				s.writeError(w, http.StatusBadRequest, "InvalidPart")
+				return
+			}
+			data = append(data, parts[part.PartNumber]...)
+		}
+		delete(s.uploads, query.Get("uploadId"))
+		s.objects[key] = data
+		_, _ = fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(s.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		s.objects[key] = data
+	case r.Method == http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := s.objects[key]
+		if !ok {
+			s.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		if r.Method == http.MethodGet {
+			s.gets++
+		}
+		w.Header().Set("ETag", etag(data))
+		http.ServeContent(w, r, key, time.Unix(1700000000, 0), bytes.NewReader(data))
+	default:
+		s.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (s *fakeS3) list(w http.ResponseWriter, query map[string][]string) {
+	get := func(k string) string {
+		if v := query[k]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+
+	prefix, delimiter := get("prefix"), get("delimiter")
+	maxKeys, err := strconv.Atoi(get("max-keys"))
+	if err != nil {
+		maxKeys = 2 // small pages to test pagination
+	}
+
+	keys := make([]string, 0, len(s.objects))
+	for k := range s.objects {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	type content struct {
+		Key          string
+		Size         int
+		LastModified string
+		ETag         string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	var result struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		IsTruncated           bool
+		NextContinuationToken string         `xml:",omitempty"`
+		Contents              []content      `xml:"Contents"`
+		CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+	}
+
+	cursor := get("continuation-token")
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) || k <= cursor {
+			continue
+		}
+
+		if len(result.Contents)+len(result.CommonPrefixes) >= maxKeys {
+			result.IsTruncated = true
+			break
+		}
+
+		if i := strings.Index(k[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			p := k[:len(prefix)+i+1]
+			if !slices.Contains(result.CommonPrefixes, commonPrefix{p}) {
+				result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{p})
+			}
+			cursor = p + "\xff" // skip all keys with this prefix
+			result.NextContinuationToken = cursor
+			continue
+		}
+
+		result.Contents = append(result.Contents, content{
+			Key:          k,
+			Size:         len(s.objects[k]),
+			LastModified: time.Unix(1700000000, 0).UTC().Format(time.RFC3339),
+			ETag:         etag(s.objects[k]),
+		})
+		cursor = k
+		result.NextContinuationToken = cursor
+	}
+
+	if !result.IsTruncated {
+		result.NextContinuationToken = ""
+	}
+
+	_ = xml.NewEncoder(w).Encode(&result)
+}
+
+func newRoot(t *testing.T, s3 *fakeS3, prefix string, cache blockcache.Cache) *s3root.SystemRoot {
+	t.Helper()
+
+	srv := httptest.NewServer(s3)
+	t.Cleanup(srv.Close)
+
+	root, err := s3root.NewSystemRoot(s3root.Config{
+		Endpoint:        srv.URL,
+		Bucket:          bucket,
+		Prefix:          prefix,
+		AccessKeyID:     "key",
+		SecretAccessKey: "secret",
+		PathStyle:       true,
+		PartSize:        s3root.MinPartSize,
+	}, srv.Client(), cache, blockSize)
+	require.NoError(t, err)
+
+	return root
+}
+
+func TestSystemRoot(t *testing.T) {
+	s3 := newFakeS3()
+
+	content := make([]byte, 3*blockSize+123)
+	_, _ = rand.Read(content)
+
+	s3.objects["library/PS3ISO/game.iso"] = content
+	s3.objects["library/PS3ISO/other.iso"] = []byte("other")
+	s3.objects["library/PS3ISO/sub/nested.iso"] = []byte("nested")
+	s3.objects["outside.iso"] = []byte("outside")
+
+	root := newRoot(t, s3, "library", blockcache.NewMemory(1<<20))
+
+	t.Run("stat", func(t *testing.T) {
+		fi, err := root.Stat(filepath.Join("PS3ISO", "game.iso"))
+		require.NoError(t, err)
+		assert.Equal(t, "game.iso", fi.Name())
+		assert.Equal(t, int64(len(content)), fi.Size())
+		assert.False(t, fi.IsDir())
+
+		fi, err = root.Stat("PS3ISO")
+		require.NoError(t, err)
+		assert.True(t, fi.IsDir())
+
+		_, err = root.Stat(filepath.Join("PS3ISO", "missing.iso"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+
+		_, err = root.Stat(filepath.Join("..", "outside.iso"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("readdir", func(t *testing.T) {
+		d, err := root.Open("PS3ISO")
+		require.NoError(t, err)
+		defer d.Close()
+
+		entries, err := d.ReadDir(-1)
+		require.NoError(t, err)
+
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+			assert.Equal(t, entry.Name() == "sub", entry.IsDir())
+		}
+		assert.ElementsMatch(t, []string{"game.iso", "other.iso", "sub"}, names)
+	})
+
+	t.Run("range read", func(t *testing.T) {
+		f, err := root.Open(filepath.Join("PS3ISO", "game.iso"))
+		require.NoError(t, err)
+		defer f.Close()
+
+		_, err = f.Seek(blockSize/2, io.SeekStart)
+		require.NoError(t, err)
+
+		data, err := io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, content[blockSize/2:], data)
+
+		// second read must be served from cache
+		gets := s3.gets
+		_, err = f.Seek(0, io.SeekStart)
+		require.NoError(t, err)
+		data, err = io.ReadAll(f)
+		require.NoError(t, err)
+		assert.Equal(t, content, data)
+		assert.Equal(t, gets, s3.gets)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		require.NoError(t, root.Mkdir("GAMES", os.ModePerm))
+		assert.ErrorIs(t, root.Mkdir("GAMES", os.ModePerm), os.ErrExist)
+
+		fi, err := root.Stat("GAMES")
+		require.NoError(t, err)
+		assert.True(t, fi.IsDir())
+
+		// small file uploaded by single request
+		wf, err := root.Create(filepath.Join("GAMES", "small.bin"))
+		require.NoError(t, err)
+		_, err = wf.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, wf.Close())
+		assert.Equal(t, []byte("hello"), s3.objects["library/GAMES/small.bin"])
+
+		// large file uploaded by parts
+		large := make([]byte, 2*s3root.MinPartSize+100)
+		_, _ = rand.Read(large)
+		wf, err = root.Create(filepath.Join("GAMES", "large.bin"))
+		require.NoError(t, err)
+		for chunk := range slices.Chunk(large, 64*1024) {
+			_, err = wf.Write(chunk)
+			require.NoError(t, err)
+		}
+		require.NoError(t, wf.Close())
+		assert.Equal(t, large, s3.objects["library/GAMES/large.bin"])
+		assert.Empty(t, s3.uploads)
+
+		assert.Error(t, root.Remove("GAMES"), "non-empty directory must not be removed")
+
+		// upload failures are reported by Close for small files and by Write for large ones
+		s3.failPuts = true
+		wf, err = root.Create(filepath.Join("GAMES", "failed.bin"))
+		require.NoError(t, err)
+		_, err = wf.Write([]byte("hello"))
+		require.NoError(t, err, "small write is buffered")
+		assert.Error(t, wf.Close())
+		assert.NotContains(t, s3.objects, "library/GAMES/failed.bin")
+
+		wf, err = root.Create(filepath.Join("GAMES", "failed.bin"))
+		require.NoError(t, err)
+		_, err = wf.Write(large)
+		assert.Error(t, err)
+		assert.Error(t, wf.Close())
+		assert.NotContains(t, s3.objects, "library/GAMES/failed.bin")
+		assert.Empty(t, s3.uploads, "failed multipart upload must be aborted")
+		s3.failPuts = false
+
+		require.NoError(t, root.Remove(filepath.Join("GAMES", "small.bin")))
+		require.NoError(t, root.Remove(filepath.Join("GAMES", "large.bin")))
+		require.NoError(t, root.Remove("GAMES"))
+
+		_, err = root.Stat("GAMES")
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestSystemRootWithOpener(t *testing.T) {
+	s3 := newFakeS3()
+
+	content := make([]byte, 3*blockSize+123)
+	_, _ = rand.Read(content)
+
+	var compressed bytes.Buffer
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	w, err := seekable.NewWriter(&compressed, enc)
+	require.NoError(t, err)
+	for chunk := range slices.Chunk(content, blockSize) {
+		_, err = w.Write(chunk)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+	s3.objects["PS3ISO/packed.zst"] = compressed.Bytes()
+
+	fsys := pkgfs.NewFS(newRoot(t, s3, "", nil), []pkgfs.FileOpener{seekablezstd.Opener{}}, nil)
+
+	f, err := fsys.Open(context.Background(), filepath.Join("PS3ISO", "packed.zst.iso"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	require.NoError(t, err)
+	assert.Equal(t, content, data)
+}
@@ -0,0 +1,217 @@
+package upstream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	"github.com/xakep666/ps3netsrv-go/internal/remotefs"
+	"github.com/xakep666/ps3netsrv-go/pkg/client"
+)
+
+// readDir lists upstream directory.
+func (r *SystemRoot) readDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	err := r.withClient(func(ctx context.Context, c *client.Client) error {
+		entries = entries[:0]
+		if err := c.OpenDir(ctx, remotePath(name)); err != nil {
+			return err
+		}
+
+		for {
+			entry, err := c.ReadDirEntryV2(ctx)
+			switch {
+			case errors.Is(err, nil):
+				// pass
+			case errors.Is(err, io.EOF):
+				return nil // directory closed by upstream automatically
+			default:
+				return err
+			}
+
+			entries = append(entries, fs.FileInfoToDirEntry(&remotefs.FileInfo{
+				FileName:  entry.Name,
+				FileSize:  entry.FileSize,
+				Directory: entry.IsDirectory,
+				Modified:  time.Unix(int64(entry.ModTime), 0),
+				Accessed:  time.Unix(int64(entry.AccessTime), 0),
+				Changed:   time.Unix(int64(entry.ChangeTime), 0),
+			}))
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// file reads upstream file through block cache using dedicated connection.
+type file struct {
+	*blockcache.Reader
+
+	root   *SystemRoot
+	name   string
+	client *client.Client
+	broken bool // client must not be reused
+	info   *remotefs.FileInfo
+}
+
+func (f *file) open(ctx context.Context) error {
+	c, _, err := f.root.acquire(ctx)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.OpenFile(ctx, remotePath(f.name))
+	if err != nil {
+		f.root.release(c, err)
+		return err
+	}
+
+	info := &remotefs.FileInfo{
+		FileName: path.Base(remotePath(f.name)),
+		FileSize: res.FileSize,
+		Modified: time.Unix(int64(res.ModTime), 0),
+	}
+	if f.info != nil && (f.info.FileSize != info.FileSize || !f.info.Modified.Equal(info.Modified)) {
+		f.root.release(c, nil)
+		return fmt.Errorf("file changed on upstream")
+	}
+
+	f.client = c
+	f.broken = false
+	if f.info == nil {
+		f.info = info
+		f.Reader = blockcache.NewReader(f.root.cache,
+			blockcache.Key(remotePath(f.name), strconv.FormatInt(info.FileSize, 10), strconv.FormatInt(info.Modified.Unix(), 10)),
+			f.root.blockSize, info.FileSize, f.fetch,
+		)
+	}
+
+	return nil
+}
+
+type sliceWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *sliceWriter) Write(p []byte) (int, error) {
+	n := copy(w.buf[w.n:], p)
+	w.n += n
+	if n < len(p) {
+		return n, io.ErrShortWrite
+	}
+	return n, nil
+}
+
+func (f *file) fetch(p []byte, off int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	err := f.fetchWithClient(ctx, p, off)
+	if err == nil {
+		return nil
+	}
+
+	// connection may be broken, try to reopen file once
+	_ = f.client.Close()
+	f.broken = true
+	if err = f.open(ctx); err != nil {
+		return fmt.Errorf("reopen: %w", err)
+	}
+
+	return f.fetchWithClient(ctx, p, off)
+}
+
+func (f *file) fetchWithClient(ctx context.Context, p []byte, off int64) error {
+	w := &sliceWriter{buf: p}
+	for w.n < len(p) {
+		toRead := min(len(p)-w.n, maxRequestSize)
+		if err := f.client.ReadFileCritical(ctx, uint32(toRead), uint64(off)+uint64(w.n), w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *file) ReadDir(int) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *file) Name() string {
+	return f.name
+}
+
+func (f *file) Close() error {
+	var err error
+	if f.broken {
+		err = fs.ErrClosed
+	}
+
+	f.root.release(f.client, err)
+	return nil
+}
+
+// writableFile sends written data to upstream. Connection is closed with file to close file on upstream.
+type writableFile struct {
+	client  *client.Client
+	name    string
+	written int64
+}
+
+func (f *writableFile) Write(p []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	if err := f.client.WriteFile(ctx, maxRequestSize, bytes.NewReader(p)); err != nil {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: err}
+	}
+
+	f.written += int64(len(p))
+	return len(p), nil
+}
+
+func (f *writableFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *writableFile) ReadDir(int) ([]fs.DirEntry, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *writableFile) Seek(offset int64, whence int) (int64, error) {
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.written, nil
+	}
+	return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errors.ErrUnsupported}
+}
+
+func (f *writableFile) Stat() (fs.FileInfo, error) {
+	return &remotefs.FileInfo{
+		FileName: path.Base(remotePath(f.name)),
+		FileSize: f.written,
+		Modified: time.Now(),
+	}, nil
+}
+
+func (f *writableFile) Name() string {
+	return f.name
+}
+
+func (f *writableFile) Close() error {
+	return f.client.Close()
+}
@@ -0,0 +1,247 @@
+// Package upstream implements [pkgfs.SystemRoot] on top of another ps3netsrv server.
+// It allows running a local caching proxy in front of a remote server.
+package upstream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/remotefs"
+	"github.com/xakep666/ps3netsrv-go/pkg/client"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+)
+
+const (
+	// requestTimeout limits a single operation with upstream.
+	requestTimeout = time.Minute
+
+	// maxRequestSize is a maximum amount of data requested or sent by a single command.
+	maxRequestSize = 256 * 1024
+
+	maxIdleClients = 4
+)
+
+// DialFunc establishes a new connection to upstream server.
+type DialFunc func(ctx context.Context) (*client.Client, error)
+
+// SystemRoot forwards filesystem operations to upstream server.
+// Every opened file uses its own connection because protocol allows only one opened file per connection.
+// Other operations use a small pool of connections.
+type SystemRoot struct {
+	dial      DialFunc
+	cache     blockcache.Cache
+	blockSize int64
+
+	mu   sync.Mutex
+	idle []*client.Client
+}
+
+var _ pkgfs.SystemRoot = (*SystemRoot)(nil)
+
+// NewSystemRoot creates SystemRoot. Cache may be nil to disable caching of file data.
+func NewSystemRoot(dial DialFunc, cache blockcache.Cache, blockSize int64) *SystemRoot {
+	return &SystemRoot{
+		dial:      dial,
+		cache:     cache,
+		blockSize: blockSize,
+	}
+}
+
+func (r *SystemRoot) acquire(ctx context.Context) (c *client.Client, pooled bool, err error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		c = r.idle[n-1]
+		r.idle = r.idle[:n-1]
+	}
+	r.mu.Unlock()
+
+	if c != nil {
+		return c, true, nil
+	}
+
+	c, err = r.dial(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("dial upstream: %w", err)
+	}
+
+	return c, false, nil
+}
+
+// release returns client to pool if it's still usable after operation finished with provided error.
+func (r *SystemRoot) release(c *client.Client, opErr error) {
+	if !clientUsable(opErr) {
+		_ = c.Close()
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.idle) >= maxIdleClients {
+		_ = c.Close()
+		return
+	}
+
+	r.idle = append(r.idle, c)
+}
+
+func clientUsable(err error) bool {
+	return err == nil || errors.Is(err, client.ErrUnsuccessfulResponse)
+}
+
+// withClient runs fn with pooled client. Operation retried once with a fresh connection
+// if pooled one is broken (i.e. closed by upstream due to inactivity).
+func (r *SystemRoot) withClient(fn func(ctx context.Context, c *client.Client) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	for {
+		c, pooled, err := r.acquire(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = fn(ctx, c)
+		r.release(c, err)
+		if clientUsable(err) || !pooled {
+			return err
+		}
+	}
+}
+
+// Close closes idle connections.
+func (r *SystemRoot) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	for _, c := range r.idle {
+		errs = append(errs, c.Close())
+	}
+	r.idle = nil
+
+	return errors.Join(errs...)
+}
+
+func remotePath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+func pathError(op, name string, err error) error {
+	// upstream reports failures without details, most likely reason for lookups is a missing file
+	if (op == "stat" || op == "open") && errors.Is(err, client.ErrUnsuccessfulResponse) {
+		err = fs.ErrNotExist
+	}
+
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+func (r *SystemRoot) Stat(name string) (fs.FileInfo, error) {
+	var info fs.FileInfo
+	err := r.withClient(func(ctx context.Context, c *client.Client) error {
+		res, err := c.StatFile(ctx, remotePath(name))
+		if err != nil {
+			return err
+		}
+
+		info = &remotefs.FileInfo{
+			FileName:  path.Base(remotePath(name)),
+			FileSize:  res.FileSize,
+			Directory: res.IsDirectory,
+			Modified:  time.Unix(int64(res.ModTime), 0),
+			Accessed:  time.Unix(int64(res.AccessTime), 0),
+			Changed:   time.Unix(int64(res.ChangeTime), 0),
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	}
+
+	return info, nil
+}
+
+func (r *SystemRoot) Open(name string) (handler.File, error) {
+	info, err := r.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return remotefs.NewDir(name, info, func() ([]fs.DirEntry, error) {
+			return r.readDir(name)
+		}), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	f := &file{
+		root: r,
+		name: name,
+	}
+	if err = f.open(ctx); err != nil {
+		return nil, pathError("open", name, err)
+	}
+
+	return f, nil
+}
+
+func (r *SystemRoot) Create(name string) (handler.WritableFile, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	c, _, err := r.acquire(ctx)
+	if err != nil {
+		return nil, pathError("create", name, err)
+	}
+
+	if err = c.CreateFile(ctx, remotePath(name)); err != nil {
+		r.release(c, err)
+		return nil, pathError("create", name, err)
+	}
+
+	return &writableFile{
+		client: c,
+		name:   name,
+	}, nil
+}
+
+func (r *SystemRoot) Remove(name string) error {
+	info, err := r.Stat(name)
+	if err != nil {
+		return err
+	}
+
+	err = r.withClient(func(ctx context.Context, c *client.Client) error {
+		if info.IsDir() {
+			return c.RmDir(ctx, remotePath(name))
+		}
+		return c.DeleteFile(ctx, remotePath(name))
+	})
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+
+	return nil
+}
+
+func (r *SystemRoot) Mkdir(name string, _ os.FileMode) error {
+	err := r.withClient(func(ctx context.Context, c *client.Client) error {
+		return c.MkDir(ctx, remotePath(name))
+	})
+	if err != nil {
+		return pathError("mkdir", name, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package upstream_test
+
+import (
+	"context"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/blockcache"
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/ioutil"
+	"github.com/xakep666/ps3netsrv-go/pkg/client"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/upstream"
+	"github.com/xakep666/ps3netsrv-go/pkg/server"
+)
+
+func startUpstream(t *testing.T, root string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &server.Server[handler.State]{
+		Handler: &handler.Handler{
+			Fs:         pkgfs.NewFS(pkgfs.NewRelaxedSystemRoot(root), nil, nil),
+			Copier:     ioutil.NewCopier(),
+			AllowWrite: true,
+		},
+		Logger: slog.Default(),
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { _ = s.Close() })
+
+	return ln.Addr().String()
+}
+
+func TestSystemRoot(t *testing.T) {
+	const blockSize = 4096
+
+	upstreamDir := t.TempDir()
+	addr := startUpstream(t, upstreamDir)
+
+	content := make([]byte, 3*blockSize+123)
+	_, _ = rand.Read(content)
+
+	filePath := filepath.Join(upstreamDir, "PS3ISO", "game.iso")
+	require.NoError(t, os.Mkdir(filepath.Dir(filePath), os.ModePerm))
+	require.NoError(t, os.WriteFile(filePath, content, os.ModePerm))
+
+	cache, err := blockcache.NewDisk(t.TempDir(), 1<<20, slog.Default())
+	require.NoError(t, err)
+
+	root := upstream.NewSystemRoot(func(ctx context.Context) (*client.Client, error) {
+		return client.NewClient(ctx, ioutil.NewCopier(), addr)
+	}, cache, blockSize)
+	t.Cleanup(func() { _ = root.Close() })
+
+	t.Run("stat", func(t *testing.T) {
+		fi, err := root.Stat(filepath.Join("PS3ISO", "game.iso"))
+		require.NoError(t, err)
+		assert.Equal(t, "game.iso", fi.Name())
+		assert.Equal(t, int64(len(content)), fi.Size())
+		assert.False(t, fi.IsDir())
+
+		_, err = root.Stat(filepath.Join("PS3ISO", "missing.iso"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+
+	t.Run("readdir", func(t *testing.T) {
+		d, err := root.Open("PS3ISO")
+		require.NoError(t, err)
+		defer d.Close()
+
+		entries, err := d.ReadDir(-1)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "game.iso", entries[0].Name())
+	})
+
+	t.Run("cached read", func(t *testing.T) {
+		readAll := func() []byte {
+			f, err := root.Open(filepath.Join("PS3ISO", "game.iso"))
+			require.NoError(t, err)
+			defer f.Close()
+
+			_, err = f.Seek(blockSize/2, io.SeekStart)
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(f)
+			require.NoError(t, err)
+			return data
+		}
+
+		assert.Equal(t, content[blockSize/2:], readAll())
+		assert.Equal(t, int64(len(content)), cache.Size())
+
+		// change content on upstream keeping size and modification time, cached data must be served
+		fi, err := os.Stat(filePath)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filePath, make([]byte, len(content)), os.ModePerm))
+		require.NoError(t, os.Chtimes(filePath, time.Time{}, fi.ModTime()))
+
+		assert.Equal(t, content[blockSize/2:], readAll())
+	})
+
+	t.Run("modify", func(t *testing.T) {
+		require.NoError(t, root.Mkdir("GAMES", os.ModePerm))
+
+		wf, err := root.Create(filepath.Join("GAMES", "file.bin"))
+		require.NoError(t, err)
+		_, err = wf.Write([]byte("hello"))
+		require.NoError(t, err)
+		require.NoError(t, wf.Close())
+
+		written, err := os.ReadFile(filepath.Join(upstreamDir, "GAMES", "file.bin"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(written))
+
+		require.NoError(t, root.Remove(filepath.Join("GAMES", "file.bin")))
+		require.NoError(t, root.Remove("GAMES"))
+		assert.NoDirExists(t, filepath.Join(upstreamDir, "GAMES"))
+	})
+}
@@ -0,0 +1,303 @@
+package viso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/ird"
+)
+
+const (
+	irdExt = ".ird"
+	irdDir = "IRD"
+)
+
+// IRDISO is an on-the-fly generated disc image of PS3 game folder laid out exactly like original disc.
+// Layout is taken from IRD file:
+// * header (sector 0 up to first file) contains regions map, disc info and filesystem structures
+// * files are placed at their original locations, gaps between them are zero-filled
+// * footer is placed at the end of disc
+// So image is identical to decrypted original one and matches Redump dump after encryption with disc key from IRD.
+type IRDISO struct {
+	ctx       context.Context
+	fs        *pkgfs.FS
+	root      string
+	createdAt time.Time
+
+	isClosed    bool
+	header      []byte
+	footer      []byte
+	footerStart iso9660.SizeBytes
+	totalSize   iso9660.SizeBytes
+	files       filesList         // ordered by location
+	offset      iso9660.SizeBytes // used during Read and Seek
+}
+
+// NewIRDISO creates a virtual iso from game folder according to layout described by IRD.
+// All files listed in IRD must present in folder and have the same size.
+func NewIRDISO(ctx context.Context, fsys *pkgfs.FS, root string, disc *ird.IRD) (*IRDISO, error) {
+	discSize, err := disc.DiscSize()
+	if err != nil {
+		return nil, err
+	}
+
+	discFiles, err := disc.Files()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &IRDISO{
+		ctx:         context.WithoutCancel(ctx),
+		fs:          fsys,
+		root:        root,
+		createdAt:   time.Now(),
+		header:      disc.Header,
+		footer:      disc.Footer,
+		footerStart: iso9660.SizeBytes(discSize - int64(len(disc.Footer))),
+		totalSize:   iso9660.SizeBytes(discSize),
+	}
+
+	if ret.footerStart < iso9660.SizeBytes(len(ret.header)) {
+		return nil, fmt.Errorf("header (%d bytes) and footer (%d bytes) exceed disc size (%d)",
+			len(ret.header), len(ret.footer), discSize)
+	}
+
+	for _, df := range discFiles {
+		p := filepath.Join(root, filepath.FromSlash(df.Path))
+		fi, err := fsys.Stat(ctx, p)
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %w", df.Path, err)
+		}
+
+		if fi.Size() != df.Size {
+			return nil, fmt.Errorf("file %s: size %d differs from original %d", df.Path, fi.Size(), df.Size)
+		}
+
+		ret.files = append(ret.files, fileItem{
+			path: p,
+			size: iso9660.SizeBytes(df.Size),
+			rLBA: iso9660.SizeSectors(df.Sector),
+		})
+	}
+
+	return ret, nil
+}
+
+// IRDCache keeps parsed IRD files, so IRD isn't read and decompressed on every image open.
+// Entry is dropped when IRD file size or modification time changes.
+type IRDCache struct {
+	mu      sync.Mutex
+	entries map[string]irdCacheEntry
+}
+
+type irdCacheEntry struct {
+	size    int64
+	modTime time.Time
+	disc    *ird.IRD
+}
+
+func NewIRDCache() *IRDCache {
+	return &IRDCache{entries: make(map[string]irdCacheEntry)}
+}
+
+// parse returns cached IRD for path or parses it. Nil cache parses file every time.
+func (c *IRDCache) parse(fsys *pkgfs.FS, path string) (*ird.IRD, error) {
+	fi, err := fsys.SystemRoot().Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if c != nil {
+		c.mu.Lock()
+		entry, ok := c.entries[path]
+		c.mu.Unlock()
+		if ok && entry.size == fi.Size() && entry.modTime.Equal(fi.ModTime()) {
+			return entry.disc, nil
+		}
+	}
+
+	f, err := fsys.SystemRoot().Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	disc, err := ird.Parse(f)
+	_ = f.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	if c != nil {
+		c.mu.Lock()
+		c.entries[path] = irdCacheEntry{size: fi.Size(), modTime: fi.ModTime(), disc: disc}
+		c.mu.Unlock()
+	}
+
+	return disc, nil
+}
+
+// findIRD looks for IRD of game folder: "<folder>.ird" near it or "IRD/<TITLE_ID>.ird" in root.
+func findIRD(ctx context.Context, fsys *pkgfs.FS, cache *IRDCache, root string) (*ird.IRD, error) {
+	gameTitleID, err := titleID(ctx, fsys, root)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []string{
+		strings.TrimSuffix(root, string(filepath.Separator)) + irdExt,
+		filepath.Join(irdDir, gameTitleID+irdExt),
+	}
+
+	for _, candidate := range candidates {
+		disc, err := cache.parse(fsys, candidate)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", candidate, err)
+		}
+
+		if disc.TitleID != gameTitleID {
+			return nil, fmt.Errorf("%s: title id %s doesn't match game %s", candidate, disc.TitleID, gameTitleID)
+		}
+
+		return disc, nil
+	}
+
+	return nil, fs.ErrNotExist
+}
+
+func (d *IRDISO) Read(buf []byte) (int, error) {
+	if d.isClosed {
+		return 0, fs.ErrClosed
+	}
+
+	if d.offset >= d.totalSize || len(buf) == 0 {
+		return 0, io.EOF
+	}
+
+	read := 0
+	for len(buf) > 0 && d.offset < d.totalSize {
+		n, err := d.readPart(buf, d.offset)
+		read += n
+		d.offset += iso9660.SizeBytes(n)
+		buf = buf[n:]
+		if err != nil {
+			return read, err
+		}
+	}
+
+	return read, nil
+}
+
+// readPart reads single continuous part of image at offset: header, footer, file or gap between them.
+func (d *IRDISO) readPart(buf []byte, offset iso9660.SizeBytes) (int, error) {
+	switch {
+	case offset < iso9660.SizeBytes(len(d.header)):
+		return copy(buf, d.header[offset:]), nil
+	case offset >= d.footerStart:
+		return copy(buf, d.footer[offset-d.footerStart:]), nil
+	}
+
+	limit := d.footerStart - offset
+
+	// first file ending after offset
+	idx := sort.Search(len(d.files), func(i int) bool {
+		return d.files[i].rLBA.Bytes()+d.files[i].size > offset
+	})
+	if idx < len(d.files) {
+		fileItem := &d.files[idx]
+		start := fileItem.rLBA.Bytes()
+
+		if offset >= start {
+			f, err := fileItem.openOnDemand(d.ctx, d.fs)
+			if err != nil {
+				return 0, fmt.Errorf("failed to open %s: %w", fileItem.path, err)
+			}
+
+			if _, err = f.Seek(int64(offset-start), io.SeekStart); err != nil {
+				return 0, fmt.Errorf("seek %s failed: %w", fileItem.path, err)
+			}
+
+			n, err := io.ReadFull(f, buf[:min(iso9660.SizeBytes(len(buf)), start+fileItem.size-offset)])
+			if err != nil {
+				return n, fmt.Errorf("read %s failed: %w", fileItem.path, err)
+			}
+
+			return n, nil
+		}
+
+		limit = min(limit, start-offset)
+	}
+
+	// gap before next file or footer
+	n := min(iso9660.SizeBytes(len(buf)), limit)
+	clear(buf[:n])
+	return int(n), nil
+}
+
+func (d *IRDISO) Seek(offset int64, whence int) (int64, error) {
+	if d.isClosed {
+		return 0, fs.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += int64(d.offset)
+	case io.SeekEnd:
+		offset = int64(d.totalSize) + offset
+	default:
+		return 0, syscall.EINVAL
+	}
+
+	if offset < 0 || iso9660.SizeBytes(offset) > d.totalSize {
+		return 0, syscall.EINVAL
+	}
+
+	d.offset = iso9660.SizeBytes(offset)
+	return offset, nil
+}
+
+func (d *IRDISO) Name() string {
+	return d.root
+}
+
+func (d *IRDISO) ReadDir(count int) ([]fs.DirEntry, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (d *IRDISO) Stat() (fs.FileInfo, error) {
+	return &virtualISOStat{
+		name:      filepath.Base(d.root),
+		totalSize: int64(d.totalSize),
+		modTime:   d.createdAt,
+	}, nil
+}
+
+func (d *IRDISO) Close() error {
+	if d.isClosed {
+		return nil
+	}
+
+	var errs []error
+	d.isClosed = true
+	for i := range d.files {
+		if err := d.files[i].closeOpened(); err != nil {
+			errs = append(errs, fmt.Errorf("file %s close failed: %w", d.files[i].path, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,171 @@
+package viso_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+	"github.com/xakep666/ps3netsrv-go/internal/osutil/filesystem"
+	"github.com/xakep666/ps3netsrv-go/internal/testutil"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/viso"
+	"github.com/xakep666/ps3netsrv-go/pkg/ird"
+)
+
+// paramSFO contains TITLE_ID=BLUS12345.
+var paramSFO = []byte{
+	0x00, 0x50, 0x53, 0x46, 0x01, 0x01, 0x00, 0x00, 0x24, 0x00, 0x00, 0x00, 0x30, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x04, 0x02, 0x0A, 0x00, 0x00, 0x00, 0x0F, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x54, 0x49, 0x54, 0x4C, 0x45, 0x5F, 0x49, 0x44, 0x00, 0x00, 0x00, 0x00,
+	0x42, 0x4C, 0x55, 0x53, 0x31, 0x32, 0x33, 0x34, 0x35, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+func readImage(t *testing.T, f interface {
+	io.Reader
+	Stat() (os.FileInfo, error)
+}) []byte {
+	t.Helper()
+
+	fi, err := f.Stat()
+	require.NoError(t, err)
+
+	data := make([]byte, fi.Size())
+	_, err = io.ReadFull(f, data)
+	require.NoError(t, err)
+
+	return data
+}
+
+// makeIRD makes IRD describing provided disc image.
+func makeIRD(t *testing.T, disc []byte) *ird.IRD {
+	t.Helper()
+
+	img, err := iso9660.OpenImage(bytes.NewReader(disc))
+	require.NoError(t, err)
+
+	ret := &ird.IRD{TitleID: "BLUS12345", Title: "Test", SystemVersion: "4.00", GameVersion: "01.00", AppVersion: "01.00"}
+	var firstFile, filesEnd iso9660.SizeBytes = iso9660.SizeBytes(len(disc)), 0
+	var walk func(dir iso9660.DirectoryEntry)
+	walk = func(dir iso9660.DirectoryEntry) {
+		entries, err := img.ReadDir(dir)
+		require.NoError(t, err)
+
+		for _, e := range entries {
+			if e.FileFlags&iso9660.DirFlagDir != 0 {
+				walk(e)
+				continue
+			}
+
+			start := e.ExtentLocation.Bytes()
+			firstFile = min(firstFile, start)
+			filesEnd = max(filesEnd, start+e.ExtentLength.AlignToSectors())
+			ret.FileHashes = append(ret.FileHashes, ird.FileHash{
+				Sector: int64(e.ExtentLocation),
+				MD5:    md5.Sum(disc[start : start+e.ExtentLength]),
+			})
+		}
+	}
+	walk(img.Root())
+
+	ret.Header = disc[:firstFile]
+	ret.Footer = disc[filesEnd:]
+
+	return ret
+}
+
+func TestIRDISO(t *testing.T) {
+	root, err := os.OpenRoot(t.TempDir())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = root.Close() })
+
+	const gameDir = "GAMES/BLUS12345-Test"
+
+	eboot := make([]byte, 5000)
+	_, _ = rand.Read(eboot)
+
+	files := map[string][]byte{
+		"PS3_DISC.SFB":              []byte("sfb content"),
+		"PS3_GAME/PARAM.SFO":        paramSFO,
+		"PS3_GAME/USRDIR/EBOOT.BIN": eboot,
+	}
+	for name, content := range files {
+		require.NoError(t, root.MkdirAll(filepath.Join(gameDir, filepath.Dir(name)), os.ModePerm))
+		require.NoError(t, root.WriteFile(filepath.Join(gameDir, name), content, os.ModePerm))
+	}
+
+	fsys := pkgfs.NewFS(filesystem.NewStrictSystemRoot(root), []pkgfs.FileOpener{viso.Opener{IRDs: viso.NewIRDCache()}}, nil)
+
+	// use generated image as "original" disc
+	generated, err := viso.NewVirtualISO(t.Context(), fsys, gameDir, true)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = generated.Close() })
+	original := readImage(t, generated)
+
+	disc := makeIRD(t, original)
+
+	discFiles, err := disc.Files()
+	require.NoError(t, err)
+	if assert.Len(t, discFiles, 3) {
+		assert.Equal(t, "PS3_DISC.SFB", discFiles[0].Path)
+		assert.True(t, discFiles[0].HasMD5)
+	}
+
+	parsed, err := ird.Parse(bytes.NewReader(testutil.EncodeIRD(t, disc)))
+	require.NoError(t, err)
+	assert.Equal(t, disc.TitleID, parsed.TitleID)
+	assert.Equal(t, disc.FileHashes, parsed.FileHashes)
+
+	require.NoError(t, root.WriteFile(gameDir+".ird", testutil.EncodeIRD(t, disc), os.ModePerm))
+
+	f, err := fsys.Open(t.Context(), filepath.Join("***PS3***", gameDir))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = f.Close() })
+
+	irdISO, ok := handler.FileAsType[*viso.IRDISO](f)
+	require.True(t, ok, "image must be built from IRD")
+
+	// generated image contains random data in disc info sector, so equality means that layout is taken from IRD
+	assert.Equal(t, original, readImage(t, irdISO))
+
+	t.Run("cached IRD", func(t *testing.T) {
+		irdPath := gameDir + ".ird"
+		fi, err := root.Stat(irdPath)
+		require.NoError(t, err)
+
+		// corrupted file with the same size and modification time is taken from cache
+		require.NoError(t, root.WriteFile(irdPath, make([]byte, fi.Size()), os.ModePerm))
+		require.NoError(t, root.Chtimes(irdPath, fi.ModTime(), fi.ModTime()))
+
+		f, err := fsys.Open(t.Context(), filepath.Join("***PS3***", gameDir))
+		require.NoError(t, err)
+		_, ok := handler.FileAsType[*viso.IRDISO](f)
+		assert.True(t, ok, "image must be built from cached IRD")
+		require.NoError(t, f.Close())
+
+		// modified file is parsed again
+		require.NoError(t, root.Chtimes(irdPath, fi.ModTime(), fi.ModTime().Add(time.Second)))
+
+		f, err = fsys.Open(t.Context(), filepath.Join("***PS3***", gameDir))
+		require.NoError(t, err)
+		_, ok = handler.FileAsType[*viso.IRDISO](f)
+		assert.False(t, ok, "corrupted IRD must not be used")
+		require.NoError(t, f.Close())
+	})
+
+	t.Run("size mismatch", func(t *testing.T) {
+		require.NoError(t, root.WriteFile(filepath.Join(gameDir, "PS3_DISC.SFB"), []byte("changed"), os.ModePerm))
+
+		_, err := viso.NewIRDISO(t.Context(), fsys, gameDir, disc)
+		assert.Error(t, err)
+	})
+}
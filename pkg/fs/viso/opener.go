@@ -2,16 +2,20 @@ package viso
 
 import (
 	"context"
+	"errors"
 	"io/fs"
 	"log/slog"
 	"path/filepath"
 	"strings"
 
 	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
 	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
 )
 
-type Opener struct{}
+type Opener struct {
+	IRDs *IRDCache // optional, IRD files are parsed on every open if not set
+}
 
 type fileType int
 
@@ -37,12 +41,32 @@ func translatePath(path string) (string, fileType) {
 	}
 }
 
-func (Opener) Open(ctx context.Context, fsys *pkgfs.FS, path string) (handler.File, error) {
+func (o Opener) Open(ctx context.Context, fsys *pkgfs.FS, path string) (handler.File, error) {
 	path, typ := translatePath(path)
 	if typ == genericFile {
 		return nil, pkgfs.ErrTryNext
 	}
 
+	if typ == virtualPS3ISOFile {
+		disc, err := findIRD(ctx, fsys, o.IRDs, path)
+		switch {
+		case errors.Is(err, nil):
+			slog.InfoContext(ctx, "Engaging Virtual ISO with original disc layout from IRD",
+				slog.String("path", path), slog.String("title_id", disc.TitleID))
+
+			irdISO, err := NewIRDISO(ctx, fsys, path, disc)
+			if err == nil {
+				return irdISO, nil
+			}
+
+			slog.WarnContext(ctx, "Folder doesn't match IRD, falling back to generated layout",
+				slog.String("path", path), logutil.ErrorAttr(err))
+		case errors.Is(err, fs.ErrNotExist):
+		default:
+			slog.WarnContext(ctx, "IRD lookup failed", slog.String("path", path), logutil.ErrorAttr(err))
+		}
+	}
+
 	slog.InfoContext(ctx, "Engaging Virtual ISO", slog.String("path", path), slog.Bool("ps3_mode", typ == virtualPS3ISOFile))
 	return NewVirtualISO(ctx, fsys, path, typ == virtualPS3ISOFile)
 }
@@ -26,9 +26,9 @@ type sfoIndexTableEntry struct {
 	DataOffset uint32 // relative to data table start
 }
 
-// sfoField returns provided field from param.sfo file.
+// SFOField returns provided string field from param.sfo file.
 // See https://psdevwiki.com/ps3/PARAM.SFO for file format.
-func sfoField(f io.ReadSeeker, field string) (string, error) {
+func SFOField(f io.ReadSeeker, field string) (string, error) {
 	var hdr sfoHeader
 
 	if err := binary.Read(f, binary.LittleEndian, &hdr); err != nil {
@@ -136,14 +136,19 @@ func (viso *VirtualISO) init() error {
 }
 
 func (viso *VirtualISO) getTitleID() (string, error) {
-	f, err := viso.fs.Open(viso.ctx, filepath.Join(viso.root, paramSFOPath))
+	return titleID(viso.ctx, viso.fs, viso.root)
+}
+
+// titleID reads TITLE_ID of PS3 game folder from PARAM.SFO.
+func titleID(ctx context.Context, fsys *pkgfs.FS, root string) (string, error) {
+	f, err := fsys.Open(ctx, filepath.Join(root, paramSFOPath))
 	if err != nil {
 		return "", fmt.Errorf("param.sfo open failed: %w", err)
 	}
 
 	defer f.Close()
 
-	return sfoField(f, "TITLE_ID")
+	return SFOField(f, "TITLE_ID")
 }
 
 func (viso *VirtualISO) buildFS(volumeName, gameCode string) error {
@@ -24,7 +24,7 @@ func TestSFO(t *testing.T) {
 	f, err := baseFS.Open("param.sfo")
 	require.NoError(t, err)
 
-	v, err := sfoField(f, "TITLE_ID")
+	v, err := SFOField(f, "TITLE_ID")
 	if assert.NoError(t, err) {
 		assert.Equal(t, "BLUS12345", v)
 	}
@@ -0,0 +1,120 @@
+package iprange
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// DynamicFilter drops connections if peer address is not in ip range which may be changed at any time.
+// Unlike FilterListener, it tracks accepted connections, so range change applies to them too.
+// Nil range allows all connections.
+type DynamicFilter struct {
+	r atomic.Pointer[IPRange]
+
+	mu    sync.Mutex
+	conns map[*dynamicFilterConn]struct{}
+}
+
+func NewDynamicFilter(r *IPRange) *DynamicFilter {
+	f := &DynamicFilter{conns: make(map[*dynamicFilterConn]struct{})}
+	f.r.Store(r)
+	return f
+}
+
+// Range returns current ip range.
+func (f *DynamicFilter) Range() *IPRange {
+	return f.r.Load()
+}
+
+// SetRange changes ip range and closes already accepted connections with peer address not in new range.
+// It returns amount of closed connections.
+func (f *DynamicFilter) SetRange(r *IPRange) int {
+	f.r.Store(r)
+
+	f.mu.Lock()
+	var toClose []*dynamicFilterConn
+	for conn := range f.conns {
+		if !f.allowed(conn.RemoteAddr()) {
+			toClose = append(toClose, conn)
+		}
+	}
+	f.mu.Unlock()
+
+	for _, conn := range toClose {
+		_ = conn.Close()
+	}
+
+	return len(toClose)
+}
+
+// Listener returns listener that drops connections using this filter.
+func (f *DynamicFilter) Listener(l net.Listener) net.Listener {
+	return &dynamicFilteringListener{Listener: l, f: f}
+}
+
+func (f *DynamicFilter) allowed(addr net.Addr) bool {
+	r := f.r.Load()
+	if r == nil {
+		return true
+	}
+
+	ip := addrIP(addr)
+	return ip == nil || r.Contains(ip)
+}
+
+func (f *DynamicFilter) track(conn *dynamicFilterConn, add bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if add {
+		f.conns[conn] = struct{}{}
+	} else {
+		delete(f.conns, conn)
+	}
+}
+
+type dynamicFilteringListener struct {
+	net.Listener
+
+	f *DynamicFilter
+}
+
+func (l *dynamicFilteringListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return conn, err
+		}
+
+		if !l.f.allowed(conn.RemoteAddr()) {
+			_ = conn.Close()
+			continue
+		}
+
+		fconn := &dynamicFilterConn{Conn: conn}
+		fconn.close = sync.OnceValue(func() error {
+			l.f.track(fconn, false)
+			return fconn.Conn.Close()
+		})
+		l.f.track(fconn, true)
+
+		// range may be changed before connection was tracked
+		if !l.f.allowed(conn.RemoteAddr()) {
+			_ = fconn.Close()
+			continue
+		}
+
+		return fconn, nil
+	}
+}
+
+type dynamicFilterConn struct {
+	net.Conn
+
+	close func() error
+}
+
+func (c *dynamicFilterConn) Close() error {
+	return c.close()
+}
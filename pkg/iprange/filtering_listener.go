@@ -26,17 +26,7 @@ func (l *filteringListener) Accept() (net.Conn, error) {
 			return conn, err
 		}
 
-		shouldAccept := true
-		switch addr := conn.RemoteAddr().(type) {
-		case *net.TCPAddr:
-			shouldAccept = l.shouldAccept(addr.IP)
-		case *net.IPAddr:
-			shouldAccept = l.shouldAccept(addr.IP)
-		case *net.UDPAddr:
-			shouldAccept = l.shouldAccept(addr.IP)
-		}
-
-		if !shouldAccept {
+		if !l.shouldAccept(conn.RemoteAddr()) {
 			_ = conn.Close()
 			continue
 		}
@@ -45,7 +35,12 @@ func (l *filteringListener) Accept() (net.Conn, error) {
 	}
 }
 
-func (l *filteringListener) shouldAccept(ip net.IP) bool {
+func (l *filteringListener) shouldAccept(addr net.Addr) bool {
+	ip := addrIP(addr)
+	if ip == nil {
+		return true
+	}
+
 	ok := l.r.Contains(ip)
 	if l.invert {
 		ok = !ok
@@ -53,3 +48,17 @@ func (l *filteringListener) shouldAccept(ip net.IP) bool {
 
 	return ok
 }
+
+// addrIP extracts IP from network address. Nil returned for addresses without IP, i.e. unix sockets.
+func addrIP(addr net.Addr) net.IP {
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.IPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	default:
+		return nil
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/xakep666/ps3netsrv-go/pkg/iprange"
 )
 
@@ -209,3 +210,26 @@ func TestParseIPRange(t *testing.T) {
 func prepareRange(start, end string) *iprange.IPRange {
 	return iprange.New(net.ParseIP(start), net.ParseIP(end))
 }
+
+func TestDynamicFilter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	f := iprange.NewDynamicFilter(prepareRange("127.0.0.1", "127.0.0.1"))
+	fln := f.Listener(ln)
+	t.Cleanup(func() { _ = fln.Close() })
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	defer client.Close()
+
+	conn, err := fln.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	assert.Zero(t, f.SetRange(prepareRange("127.0.0.1", "127.0.0.2")), "allowed connection must be kept")
+	assert.Equal(t, 1, f.SetRange(prepareRange("192.0.2.0", "192.0.2.10")), "disallowed connection must be closed")
+
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, net.ErrClosed)
+}
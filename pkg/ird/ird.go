@@ -0,0 +1,287 @@
+// Package ird reads PS3 IRD (ISO Rebuild Data) files.
+// IRD contains everything except files content needed to rebuild original disc image:
+// disc header (filesystem structures) and footer, MD5 hashes of regions and files and disc keys.
+package ird
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/xakep666/ps3netsrv-go/internal/iso9660"
+)
+
+const (
+	magic = "3IRD"
+
+	picSize = 115
+	keySize = 16
+
+	minVersion = 6
+	maxVersion = 9
+
+	maxSectionSize = 1 << 30 // sanity limit for header and footer
+)
+
+// ErrNotIRD occurs when provided file is not an IRD.
+var ErrNotIRD = errors.New("not an ird file")
+
+// FileHash is a hash of file content, file identified by its first sector on disc.
+type FileHash struct {
+	Sector int64
+	MD5    [md5.Size]byte
+}
+
+// IRD is a parsed IRD file.
+type IRD struct {
+	Version       byte
+	TitleID       string // i.e. BLES00000
+	Title         string
+	SystemVersion string // minimal required firmware version
+	GameVersion   string
+	AppVersion    string
+
+	Header []byte // disc start (sector 0 up to first file) including filesystem structures
+	Footer []byte // disc end after last file
+
+	RegionHashes [][md5.Size]byte
+	FileHashes   []FileHash
+
+	PIC   []byte // disc PIC (permanent information and control) data
+	Data1 []byte // disc key, same as in .dkey file
+	Data2 []byte
+	UID   uint32
+}
+
+// Parse reads and decodes IRD file. Both gzip-compressed and plain files are accepted.
+func Parse(r io.Reader) (*IRD, error) {
+	br := bufio.NewReader(r)
+	if head, err := br.Peek(2); err == nil && head[0] == 0x1f && head[1] == 0x8b {
+		gzr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("ird: gzip: %w", err)
+		}
+		defer gzr.Close()
+
+		r = gzr
+	} else {
+		r = br
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("ird: read: %w", err)
+	}
+
+	if len(data) < len(magic)+4 || string(data[:len(magic)]) != magic {
+		return nil, ErrNotIRD
+	}
+
+	// crc32 of whole file except crc itself placed at the end
+	if expected, actual := binary.LittleEndian.Uint32(data[len(data)-4:]), crc32.ChecksumIEEE(data[:len(data)-4]); expected != actual {
+		return nil, fmt.Errorf("ird: crc32 mismatch: expected %08x, computed %08x", expected, actual)
+	}
+
+	d := decoder{data: data[len(magic) : len(data)-4]}
+	ret := &IRD{Version: d.byte()}
+	if ret.Version < minVersion || ret.Version > maxVersion {
+		return nil, fmt.Errorf("ird: unsupported version %d", ret.Version)
+	}
+
+	ret.TitleID = string(d.bytes(9))
+	ret.Title = string(d.bytes(int(d.byte())))
+	ret.SystemVersion = strings.TrimSpace(string(d.bytes(4)))
+	ret.GameVersion = strings.TrimSpace(string(d.bytes(5)))
+	ret.AppVersion = strings.TrimSpace(string(d.bytes(5)))
+	if ret.Version == 7 {
+		d.uint32() // id
+	}
+
+	if ret.Header, err = d.gzipped(); err != nil {
+		return nil, fmt.Errorf("ird: header: %w", err)
+	}
+	if ret.Footer, err = d.gzipped(); err != nil {
+		return nil, fmt.Errorf("ird: footer: %w", err)
+	}
+
+	ret.RegionHashes = make([][md5.Size]byte, d.byte())
+	for i := range ret.RegionHashes {
+		ret.RegionHashes[i] = [md5.Size]byte(d.bytes(md5.Size))
+	}
+
+	filesCount := d.uint32()
+	if int(filesCount) > len(d.data)/(8+md5.Size) {
+		return nil, fmt.Errorf("ird: too many files: %d", filesCount)
+	}
+	ret.FileHashes = make([]FileHash, filesCount)
+	for i := range ret.FileHashes {
+		ret.FileHashes[i].Sector = int64(d.uint64())
+		ret.FileHashes[i].MD5 = [md5.Size]byte(d.bytes(md5.Size))
+	}
+
+	d.uint32() // extra config and attachments
+	if ret.Version >= 9 {
+		ret.PIC = d.bytes(picSize)
+	}
+	ret.Data1 = d.bytes(keySize)
+	ret.Data2 = d.bytes(keySize)
+	if ret.Version < 9 {
+		ret.PIC = d.bytes(picSize)
+	}
+	if ret.Version > 7 {
+		ret.UID = d.uint32()
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("ird: %w", d.err)
+	}
+
+	return ret, nil
+}
+
+// File is a file on disc described by IRD.
+type File struct {
+	Path   string // slash-separated path relative to disc root
+	Sector int64
+	Size   int64
+	MD5    [md5.Size]byte
+	HasMD5 bool
+}
+
+// image returns filesystem of original disc read from header.
+func (ird *IRD) image() (*iso9660.Image, error) {
+	img, err := iso9660.OpenImage(bytes.NewReader(ird.Header))
+	if err != nil {
+		return nil, fmt.Errorf("ird: header filesystem: %w", err)
+	}
+
+	return img, nil
+}
+
+// DiscSize returns size of original disc image in bytes.
+func (ird *IRD) DiscSize() (int64, error) {
+	img, err := ird.image()
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(img.Primary.VolumeSpaceSize.Bytes()), nil
+}
+
+// Files lists files of disc ordered by location. Filesystem structures are taken from header.
+func (ird *IRD) Files() ([]File, error) {
+	img, err := ird.image()
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make(map[int64][md5.Size]byte, len(ird.FileHashes))
+	for _, h := range ird.FileHashes {
+		hashes[h.Sector] = h.MD5
+	}
+
+	var ret []File
+	var walk func(dir iso9660.DirectoryEntry, dirPath string, depth int) error
+	walk = func(dir iso9660.DirectoryEntry, dirPath string, depth int) error {
+		if depth > 64 {
+			return fmt.Errorf("ird: directories nesting is too deep at %s", dirPath)
+		}
+
+		entries, err := img.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("ird: read dir %q: %w", dirPath, err)
+		}
+
+		for _, e := range entries {
+			p := path.Join(dirPath, img.Name(e))
+			if e.FileFlags&iso9660.DirFlagDir != 0 {
+				if err := walk(e, p, depth+1); err != nil {
+					return err
+				}
+				continue
+			}
+
+			f := File{
+				Path:   p,
+				Sector: int64(e.ExtentLocation),
+				Size:   int64(e.ExtentLength),
+			}
+			f.MD5, f.HasMD5 = hashes[f.Sector]
+			ret = append(ret, f)
+		}
+
+		return nil
+	}
+
+	if err := walk(img.Root(), "", 0); err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(ret, func(a, b File) int {
+		return cmp.Compare(a.Sector, b.Sector)
+	})
+
+	return ret, nil
+}
+
+type decoder struct {
+	data []byte
+	err  error
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+
+	if n > len(d.data) {
+		d.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+
+	ret := d.data[:n]
+	d.data = d.data[n:]
+	return ret
+}
+
+func (d *decoder) byte() byte {
+	return d.bytes(1)[0]
+}
+
+func (d *decoder) uint32() uint32 {
+	return binary.LittleEndian.Uint32(d.bytes(4))
+}
+
+func (d *decoder) uint64() uint64 {
+	return binary.LittleEndian.Uint64(d.bytes(8))
+}
+
+func (d *decoder) gzipped() ([]byte, error) {
+	size := d.uint32()
+	if size > maxSectionSize {
+		return nil, fmt.Errorf("too large: %d", size)
+	}
+
+	compressed := d.bytes(int(size))
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	gzr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer gzr.Close()
+
+	return io.ReadAll(io.LimitReader(gzr, maxSectionSize))
+}
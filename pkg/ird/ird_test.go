@@ -0,0 +1,176 @@
+package ird_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/testutil"
+	"github.com/xakep666/ps3netsrv-go/pkg/ird"
+)
+
+func testDisc(version byte) *ird.IRD {
+	disc := &ird.IRD{
+		Version:       version,
+		TitleID:       "BLUS12345",
+		Title:         "Test Game",
+		SystemVersion: "4.80",
+		GameVersion:   "01.00",
+		AppVersion:    "01.02",
+		Header:        bytes.Repeat([]byte("header"), 1000),
+		Footer:        []byte("footer"),
+		RegionHashes:  [][md5.Size]byte{md5.Sum([]byte("region 1")), md5.Sum([]byte("region 2"))},
+		FileHashes: []ird.FileHash{
+			{Sector: 100, MD5: md5.Sum([]byte("file 1"))},
+			{Sector: 200, MD5: md5.Sum([]byte("file 2"))},
+		},
+		PIC:   bytes.Repeat([]byte{0xAA}, 115),
+		Data1: bytes.Repeat([]byte{0x11}, 16),
+		Data2: bytes.Repeat([]byte{0x22}, 16),
+	}
+	if version > 7 {
+		disc.UID = 0x12345678
+	}
+
+	return disc
+}
+
+// plainIRD returns uncompressed IRD file.
+func plainIRD(t *testing.T, disc *ird.IRD) []byte {
+	t.Helper()
+
+	gzr, err := gzip.NewReader(bytes.NewReader(testutil.EncodeIRD(t, disc)))
+	require.NoError(t, err)
+
+	data, err := io.ReadAll(gzr)
+	require.NoError(t, err)
+
+	return data
+}
+
+// withCRC replaces crc32 at the end of file.
+func withCRC(data []byte) []byte {
+	body := data[:len(data)-4]
+	return binary.LittleEndian.AppendUint32(bytes.Clone(body), crc32.ChecksumIEEE(body))
+}
+
+func TestParse(t *testing.T) {
+	for version := byte(6); version <= 9; version++ {
+		t.Run(fmt.Sprintf("version %d", version), func(t *testing.T) {
+			disc := testDisc(version)
+
+			parsed, err := ird.Parse(bytes.NewReader(testutil.EncodeIRD(t, disc)))
+			require.NoError(t, err)
+			assert.Equal(t, disc, parsed)
+
+			// plain file is accepted too
+			parsed, err = ird.Parse(bytes.NewReader(plainIRD(t, disc)))
+			require.NoError(t, err)
+			assert.Equal(t, disc, parsed)
+		})
+	}
+}
+
+// TestParse_Fixture parses file assembled by hand, so it catches mistakes repeated in both parser and test encoder.
+func TestParse_Fixture(t *testing.T) {
+	text, err := os.ReadFile("testdata/BLES99999.ird.hex")
+	require.NoError(t, err)
+
+	var hexData strings.Builder
+	for line := range strings.Lines(string(text)) {
+		if !strings.HasPrefix(line, "#") {
+			hexData.WriteString(strings.TrimSpace(line))
+		}
+	}
+
+	data, err := hex.DecodeString(hexData.String())
+	require.NoError(t, err)
+
+	disc, err := ird.Parse(bytes.NewReader(data))
+	require.NoError(t, err)
+
+	assert.EqualValues(t, 9, disc.Version)
+	assert.Equal(t, "BLES99999", disc.TitleID)
+	assert.Equal(t, "Fixture Disc", disc.Title)
+	assert.Equal(t, "4.21", disc.SystemVersion)
+	assert.Equal(t, "01.00", disc.GameVersion)
+	assert.Equal(t, "01.02", disc.AppVersion)
+	assert.Equal(t, "PS3 disc header: sectors 0..first file", string(disc.Header))
+	assert.Equal(t, "PS3 disc footer", string(disc.Footer))
+	assert.Len(t, disc.RegionHashes, 3)
+	assert.Equal(t, bytes.Repeat([]byte{0xA2}, md5.Size), disc.RegionHashes[2][:])
+	require.Len(t, disc.FileHashes, 2)
+	assert.EqualValues(t, 0x120, disc.FileHashes[0].Sector)
+	assert.EqualValues(t, 0x1A2B, disc.FileHashes[1].Sector)
+	assert.Equal(t, bytes.Repeat([]byte{0xB2}, md5.Size), disc.FileHashes[1].MD5[:])
+	assert.Len(t, disc.PIC, 115)
+	assert.EqualValues(t, 0x10, disc.PIC[0])
+	assert.Equal(t, "00112233445566778899aabbccddeeff", hex.EncodeToString(disc.Data1))
+	assert.Equal(t, "ffeeddccbbaa99887766554433221100", hex.EncodeToString(disc.Data2))
+	assert.EqualValues(t, 0xDEADBEEF, disc.UID)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	disc := testDisc(9)
+	data := plainIRD(t, disc)
+
+	// header size follows magic, version, title id, title and versions
+	headerSizeOffset := 4 + 1 + 9 + 1 + len(disc.Title) + 4 + 5 + 5
+	headerSize := int(binary.LittleEndian.Uint32(data[headerSizeOffset:]))
+	footerSizeOffset := headerSizeOffset + 4 + headerSize
+	footerSize := int(binary.LittleEndian.Uint32(data[footerSizeOffset:]))
+	filesCountOffset := footerSizeOffset + 4 + footerSize + 1 + len(disc.RegionHashes)*md5.Size
+
+	patched := func(offset int, value uint32) []byte {
+		ret := bytes.Clone(data)
+		binary.LittleEndian.PutUint32(ret[offset:], value)
+		return withCRC(ret)
+	}
+
+	versioned := func(version byte) []byte {
+		ret := bytes.Clone(data)
+		ret[4] = version
+		return withCRC(ret)
+	}
+
+	corrupted := bytes.Clone(data)
+	corrupted[headerSizeOffset+10] ^= 0xFF
+
+	for _, tc := range []struct {
+		name  string
+		data  []byte
+		error string
+	}{
+		{name: "not ird", data: []byte("not an ird file at all"), error: ird.ErrNotIRD.Error()},
+		{name: "empty", data: nil, error: ird.ErrNotIRD.Error()},
+		{name: "crc mismatch", data: corrupted, error: "crc32 mismatch"},
+		{name: "old version", data: versioned(5), error: "unsupported version 5"},
+		{name: "new version", data: versioned(10), error: "unsupported version 10"},
+		{name: "too large header", data: patched(headerSizeOffset, 1<<30+1), error: "header: too large"},
+		{name: "truncated header", data: patched(headerSizeOffset, uint32(len(data))), error: "header: unexpected EOF"},
+		{name: "too many files", data: patched(filesCountOffset, 1<<20), error: "too many files"},
+		{name: "truncated", data: withCRC(append(bytes.Clone(data[:len(data)-4-50]), 0, 0, 0, 0)), error: "unexpected EOF"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ird.Parse(bytes.NewReader(tc.data))
+			assert.ErrorContains(t, err, tc.error)
+		})
+	}
+
+	t.Run("truncated gzip", func(t *testing.T) {
+		compressed := testutil.EncodeIRD(t, disc)
+		_, err := ird.Parse(bytes.NewReader(compressed[:len(compressed)/2]))
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
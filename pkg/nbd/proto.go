@@ -0,0 +1,109 @@
+package nbd
+
+// Constants of NBD protocol. See https://github.com/NetworkBlockDevice/nbd/blob/master/doc/proto.md
+const (
+	nbdMagic         uint64 = 0x4e42444d41474943 // "NBDMAGIC"
+	optMagic         uint64 = 0x49484156454f5054 // "IHAVEOPT"
+	optReplyMagic    uint64 = 0x0003e889045565a9
+	requestMagic     uint32 = 0x25609513
+	simpleReplyMagic uint32 = 0x67446698
+)
+
+// handshake flags
+const (
+	flagFixedNewstyle uint16 = 1 << 0
+	flagNoZeroes      uint16 = 1 << 1
+)
+
+// client flags
+const (
+	clientFlagFixedNewstyle uint32 = 1 << 0
+	clientFlagNoZeroes      uint32 = 1 << 1
+)
+
+// transmission flags
+const (
+	transFlagHasFlags     uint16 = 1 << 0
+	transFlagReadOnly     uint16 = 1 << 1
+	transFlagCanMultiConn uint16 = 1 << 8
+)
+
+// options
+const (
+	optExportName uint32 = 1
+	optAbort      uint32 = 2
+	optList       uint32 = 3
+	optInfo       uint32 = 6
+	optGo         uint32 = 7
+)
+
+// option reply types
+const (
+	repAck        uint32 = 1
+	repServer     uint32 = 2
+	repInfo       uint32 = 3
+	repErrUnsup   uint32 = 1<<31 + 1
+	repErrInvalid uint32 = 1<<31 + 3
+	repErrUnknown uint32 = 1<<31 + 6
+)
+
+// info types
+const (
+	infoExport    uint16 = 0
+	infoBlockSize uint16 = 3
+)
+
+// commands
+const (
+	cmdRead  uint16 = 0
+	cmdWrite uint16 = 1
+	cmdDisc  uint16 = 2
+	cmdFlush uint16 = 3
+)
+
+// errors
+const (
+	errPerm     uint32 = 1
+	errIO       uint32 = 5
+	errInval    uint32 = 22
+	errOverflow uint32 = 75
+	errNotSup   uint32 = 95
+)
+
+const (
+	// maxOptionLength limits size of option data sent by client.
+	maxOptionLength = 64 * 1024
+
+	// maxRequestLength limits size of data requested by a single read command.
+	maxRequestLength = 32 << 20
+
+	preferredBlockSize = 4096
+)
+
+type optionHeader struct {
+	Magic  uint64
+	Option uint32
+	Length uint32
+}
+
+type optionReplyHeader struct {
+	Magic  uint64
+	Option uint32
+	Type   uint32
+	Length uint32
+}
+
+type requestHeader struct {
+	Magic  uint32
+	Flags  uint16
+	Type   uint16
+	Cookie uint64
+	Offset uint64
+	Length uint32
+}
+
+type simpleReplyHeader struct {
+	Magic  uint32
+	Error  uint32
+	Cookie uint64
+}
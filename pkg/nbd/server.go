@@ -0,0 +1,497 @@
+// Package nbd implements read-only Network Block Device server (fixed newstyle negotiation).
+// Any path resolvable through filesystem may be exported, so images may be attached
+// as block devices i.e. with "nbd-client" or "qemu-nbd".
+package nbd
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+)
+
+var ErrServerClosed = errors.New("server closed")
+
+// errAbort returned when client aborts negotiation.
+var errAbort = errors.New("negotiation aborted by client")
+
+// Server exports files from filesystem as read-only block devices.
+type Server struct {
+	Fs handler.FS
+	// Exports maps export name to path inside filesystem.
+	Exports map[string]string
+
+	// OnConnect optionally called for every accepted connection.
+	// Returned function (if not nil) is called when connection is closed.
+	OnConnect func(c net.Conn) (onClose func())
+
+	// Logger is the logger for the server.
+	Logger *slog.Logger
+
+	inShutdown atomic.Bool
+	mu         sync.Mutex
+	listeners  map[net.Listener]struct{}
+	activeConn map[net.Conn]struct{}
+}
+
+func (s *Server) logger() *slog.Logger {
+	if s.Logger != nil {
+		return s.Logger
+	}
+	return slog.Default()
+}
+
+func (s *Server) Serve(ln net.Listener) error {
+	if !s.trackListener(ln, true) {
+		return ErrServerClosed
+	}
+	defer s.trackListener(ln, false)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.inShutdown.Load() {
+				return ErrServerClosed
+			}
+
+			return fmt.Errorf("accept failed: %w", err)
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// Close closes all listeners and active connections.
+func (s *Server) Close() error {
+	s.inShutdown.Store(true)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for ln := range s.listeners {
+		if err := ln.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+		delete(s.listeners, ln)
+	}
+
+	for c := range s.activeConn {
+		_ = c.Close()
+		delete(s.activeConn, c)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *Server) trackListener(ln net.Listener, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	if add {
+		if s.inShutdown.Load() {
+			return false
+		}
+		s.listeners[ln] = struct{}{}
+	} else {
+		delete(s.listeners, ln)
+	}
+	return true
+}
+
+func (s *Server) trackConn(c net.Conn, add bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.activeConn == nil {
+		s.activeConn = make(map[net.Conn]struct{})
+	}
+	if add {
+		if s.inShutdown.Load() {
+			return false
+		}
+		s.activeConn[c] = struct{}{}
+	} else {
+		delete(s.activeConn, c)
+	}
+	return true
+}
+
+// conn holds state of a single client connection.
+type conn struct {
+	s   *Server
+	ctx context.Context
+	log *slog.Logger
+	rd  *bufio.Reader
+	wr  *bufio.Writer
+
+	noZeroes bool
+}
+
+func (s *Server) serveConn(c net.Conn) {
+	if !s.trackConn(c, true) {
+		_ = c.Close()
+		return
+	}
+	defer s.trackConn(c, false)
+	defer c.Close()
+
+	if s.OnConnect != nil {
+		if onClose := s.OnConnect(c); onClose != nil {
+			defer onClose()
+		}
+	}
+
+	cc := &conn{
+		s:   s,
+		ctx: context.Background(),
+		log: s.logger().With(logutil.StringerAttr("remote", c.RemoteAddr())),
+		rd:  bufio.NewReader(c),
+		wr:  bufio.NewWriter(c),
+	}
+
+	cc.log.Info("NBD client connected")
+
+	f, name, err := cc.negotiate()
+	switch {
+	case errors.Is(err, nil):
+		// pass
+	case errors.Is(err, errAbort), errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
+		cc.log.Info("NBD client disconnected during negotiation")
+		return
+	default:
+		cc.log.Warn("NBD negotiation failed", logutil.ErrorAttr(err))
+		return
+	}
+	defer f.Close()
+
+	cc.log = cc.log.With(slog.String("export", name))
+	cc.log.Info("NBD export attached")
+
+	err = cc.transmission(f)
+	switch {
+	case errors.Is(err, nil), errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
+		cc.log.Info("NBD client disconnected")
+	default:
+		cc.log.Warn("NBD transmission failed", logutil.ErrorAttr(err))
+	}
+}
+
+func (c *conn) write(data ...any) error {
+	for _, d := range data {
+		if err := binary.Write(c.wr, binary.BigEndian, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) writeOptionReply(option, replyType uint32, data []byte) error {
+	err := c.write(optionReplyHeader{
+		Magic:  optReplyMagic,
+		Option: option,
+		Type:   replyType,
+		Length: uint32(len(data)),
+	}, data)
+	if err != nil {
+		return err
+	}
+
+	return c.wr.Flush()
+}
+
+// export is an opened export ready for transmission.
+type export struct {
+	name string
+	file handler.File
+	size int64
+}
+
+func (c *conn) openExport(name string) (*export, error) {
+	p, ok := c.s.Exports[name]
+	if !ok {
+		return nil, fs.ErrNotExist
+	}
+
+	f, err := c.s.Fs.Open(c.ctx, filepath.FromSlash(p))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	if info.IsDir() {
+		_ = f.Close()
+		return nil, fmt.Errorf("%q is a directory", p)
+	}
+
+	return &export{name: name, file: f, size: info.Size()}, nil
+}
+
+func transmissionFlags() uint16 {
+	return transFlagHasFlags | transFlagReadOnly | transFlagCanMultiConn
+}
+
+// negotiate performs handshake and options haggling. It returns an opened export on success.
+func (c *conn) negotiate() (handler.File, string, error) {
+	if err := c.write(nbdMagic, optMagic, flagFixedNewstyle|flagNoZeroes); err != nil {
+		return nil, "", err
+	}
+	if err := c.wr.Flush(); err != nil {
+		return nil, "", err
+	}
+
+	var clientFlags uint32
+	if err := binary.Read(c.rd, binary.BigEndian, &clientFlags); err != nil {
+		return nil, "", fmt.Errorf("read client flags: %w", err)
+	}
+
+	if clientFlags&clientFlagFixedNewstyle == 0 {
+		return nil, "", fmt.Errorf("client doesn't support fixed newstyle negotiation")
+	}
+	c.noZeroes = clientFlags&clientFlagNoZeroes != 0
+
+	for {
+		var hdr optionHeader
+		if err := binary.Read(c.rd, binary.BigEndian, &hdr); err != nil {
+			return nil, "", fmt.Errorf("read option: %w", err)
+		}
+
+		if hdr.Magic != optMagic {
+			return nil, "", fmt.Errorf("invalid option magic %#x", hdr.Magic)
+		}
+
+		if hdr.Length > maxOptionLength {
+			return nil, "", fmt.Errorf("option data too long: %d", hdr.Length)
+		}
+
+		data := make([]byte, hdr.Length)
+		if _, err := io.ReadFull(c.rd, data); err != nil {
+			return nil, "", fmt.Errorf("read option data: %w", err)
+		}
+
+		c.log.Debug("NBD option received", slog.Uint64("option", uint64(hdr.Option)))
+
+		exp, err := c.handleOption(hdr.Option, data)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if exp != nil {
+			return exp.file, exp.name, nil
+		}
+	}
+}
+
+// handleOption processes a single option. Non-nil export returned if transmission phase should be started.
+func (c *conn) handleOption(option uint32, data []byte) (*export, error) {
+	switch option {
+	case optExportName:
+		exp, err := c.openExport(string(data))
+		if err != nil {
+			// protocol doesn't allow to report error here, only to close connection
+			return nil, fmt.Errorf("open export %q: %w", string(data), err)
+		}
+
+		err = c.write(uint64(exp.size), transmissionFlags())
+		if err == nil && !c.noZeroes {
+			err = c.write(make([]byte, 124))
+		}
+		if err == nil {
+			err = c.wr.Flush()
+		}
+		if err != nil {
+			_ = exp.file.Close()
+			return nil, err
+		}
+
+		return exp, nil
+	case optAbort:
+		_ = c.writeOptionReply(option, repAck, nil)
+		return nil, errAbort
+	case optList:
+		if len(data) > 0 {
+			return nil, c.writeOptionReply(option, repErrInvalid, []byte("list option must not have data"))
+		}
+
+		for _, name := range slices.Sorted(maps.Keys(c.s.Exports)) {
+			reply := binary.BigEndian.AppendUint32(nil, uint32(len(name)))
+			reply = append(reply, name...)
+			if err := c.writeOptionReply(option, repServer, reply); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, c.writeOptionReply(option, repAck, nil)
+	case optInfo, optGo:
+		return c.handleInfoOption(option, data)
+	default:
+		return nil, c.writeOptionReply(option, repErrUnsup, nil)
+	}
+}
+
+func (c *conn) handleInfoOption(option uint32, data []byte) (*export, error) {
+	// uint32 name length, name, uint16 number of requests, uint16 requests
+	if len(data) < 4 {
+		return nil, c.writeOptionReply(option, repErrInvalid, []byte("option data too short"))
+	}
+
+	nameLen := binary.BigEndian.Uint32(data)
+	data = data[4:]
+	if uint32(len(data)) < nameLen+2 {
+		return nil, c.writeOptionReply(option, repErrInvalid, []byte("option data too short"))
+	}
+
+	name := string(data[:nameLen])
+	data = data[nameLen:]
+
+	numRequests := binary.BigEndian.Uint16(data)
+	data = data[2:]
+	if len(data) != 2*int(numRequests) {
+		return nil, c.writeOptionReply(option, repErrInvalid, []byte("invalid information requests"))
+	}
+
+	var blockSizeRequested bool
+	for i := range int(numRequests) {
+		if binary.BigEndian.Uint16(data[2*i:]) == infoBlockSize {
+			blockSizeRequested = true
+		}
+	}
+
+	exp, err := c.openExport(name)
+	if err != nil {
+		c.log.Warn("NBD export open failed", slog.String("export", name), logutil.ErrorAttr(err))
+		return nil, c.writeOptionReply(option, repErrUnknown, []byte("export not available"))
+	}
+
+	closeExport := true
+	defer func() {
+		if closeExport {
+			_ = exp.file.Close()
+		}
+	}()
+
+	reply := binary.BigEndian.AppendUint16(nil, infoExport)
+	reply = binary.BigEndian.AppendUint64(reply, uint64(exp.size))
+	reply = binary.BigEndian.AppendUint16(reply, transmissionFlags())
+	if err := c.writeOptionReply(option, repInfo, reply); err != nil {
+		return nil, err
+	}
+
+	if blockSizeRequested {
+		reply = binary.BigEndian.AppendUint16(nil, infoBlockSize)
+		reply = binary.BigEndian.AppendUint32(reply, 1)
+		reply = binary.BigEndian.AppendUint32(reply, preferredBlockSize)
+		reply = binary.BigEndian.AppendUint32(reply, maxRequestLength)
+		if err := c.writeOptionReply(option, repInfo, reply); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.writeOptionReply(option, repAck, nil); err != nil {
+		return nil, err
+	}
+
+	if option != optGo {
+		return nil, nil
+	}
+
+	closeExport = false
+	return exp, nil
+}
+
+func (c *conn) writeSimpleReply(cookie uint64, errCode uint32, data []byte) error {
+	if err := c.write(simpleReplyHeader{Magic: simpleReplyMagic, Error: errCode, Cookie: cookie}, data); err != nil {
+		return err
+	}
+
+	return c.wr.Flush()
+}
+
+func (c *conn) transmission(f handler.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+	size := info.Size()
+
+	var buf []byte
+	for {
+		var req requestHeader
+		if err := binary.Read(c.rd, binary.BigEndian, &req); err != nil {
+			return err
+		}
+
+		if req.Magic != requestMagic {
+			return fmt.Errorf("invalid request magic %#x", req.Magic)
+		}
+
+		switch req.Type {
+		case cmdRead:
+			c.log.Debug("NBD read", slog.Uint64("offset", req.Offset), slog.Uint64("length", uint64(req.Length)))
+
+			if req.Length > maxRequestLength {
+				err = c.writeSimpleReply(req.Cookie, errOverflow, nil)
+				break
+			}
+
+			if req.Offset > uint64(size) || uint64(size)-req.Offset < uint64(req.Length) {
+				err = c.writeSimpleReply(req.Cookie, errInval, nil)
+				break
+			}
+
+			if cap(buf) < int(req.Length) {
+				buf = make([]byte, req.Length)
+			}
+			buf = buf[:req.Length]
+
+			if _, rerr := f.Seek(int64(req.Offset), io.SeekStart); rerr != nil {
+				c.log.Warn("NBD seek failed", logutil.ErrorAttr(rerr))
+				err = c.writeSimpleReply(req.Cookie, errIO, nil)
+				break
+			}
+
+			if _, rerr := io.ReadFull(f, buf); rerr != nil {
+				c.log.Warn("NBD read failed", logutil.ErrorAttr(rerr))
+				err = c.writeSimpleReply(req.Cookie, errIO, nil)
+				break
+			}
+
+			err = c.writeSimpleReply(req.Cookie, 0, buf)
+		case cmdWrite:
+			// data must be consumed to keep stream in sync
+			if _, err = io.CopyN(io.Discard, c.rd, int64(req.Length)); err != nil {
+				return err
+			}
+			err = c.writeSimpleReply(req.Cookie, errPerm, nil)
+		case cmdFlush:
+			err = c.writeSimpleReply(req.Cookie, 0, nil) // nothing to flush for read-only export
+		case cmdDisc:
+			return nil
+		default:
+			err = c.writeSimpleReply(req.Cookie, errNotSup, nil)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package nbd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	seekable "github.com/SaveTheRbtz/zstd-seekable-format-go/pkg"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/testutil"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/seekablezstd"
+)
+
+// testClient is a minimal NBD client performing fixed newstyle negotiation.
+type testClient struct {
+	t    *testing.T
+	conn net.Conn
+}
+
+func dialTestClient(t *testing.T, addr string) *testClient {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	c := &testClient{t: t, conn: conn}
+
+	var hello struct {
+		Magic    uint64
+		OptMagic uint64
+		Flags    uint16
+	}
+	c.read(&hello)
+	require.Equal(t, nbdMagic, hello.Magic)
+	require.Equal(t, optMagic, hello.OptMagic)
+	require.NotZero(t, hello.Flags&flagFixedNewstyle)
+
+	c.write(clientFlagFixedNewstyle | clientFlagNoZeroes)
+
+	return c
+}
+
+func (c *testClient) read(data any) {
+	c.t.Helper()
+	require.NoError(c.t, binary.Read(c.conn, binary.BigEndian, data))
+}
+
+func (c *testClient) write(data ...any) {
+	c.t.Helper()
+	for _, d := range data {
+		require.NoError(c.t, binary.Write(c.conn, binary.BigEndian, d))
+	}
+}
+
+func (c *testClient) sendOption(option uint32, data []byte) {
+	c.t.Helper()
+	c.write(optionHeader{Magic: optMagic, Option: option, Length: uint32(len(data))}, data)
+}
+
+func (c *testClient) readOptionReply(option uint32) (uint32, []byte) {
+	c.t.Helper()
+
+	var hdr optionReplyHeader
+	c.read(&hdr)
+	require.Equal(c.t, optReplyMagic, hdr.Magic)
+	require.Equal(c.t, option, hdr.Option)
+
+	data := make([]byte, hdr.Length)
+	_, err := io.ReadFull(c.conn, data)
+	require.NoError(c.t, err)
+
+	return hdr.Type, data
+}
+
+func (c *testClient) list() []string {
+	c.t.Helper()
+
+	c.sendOption(optList, nil)
+
+	var names []string
+	for {
+		replyType, data := c.readOptionReply(optList)
+		if replyType == repAck {
+			return names
+		}
+
+		require.Equal(c.t, repServer, replyType)
+		nameLen := binary.BigEndian.Uint32(data)
+		names = append(names, string(data[4:4+nameLen]))
+	}
+}
+
+// goExport selects export. It returns export size and reply type of failed option.
+func (c *testClient) goExport(name string) (uint64, uint32) {
+	c.t.Helper()
+
+	data := binary.BigEndian.AppendUint32(nil, uint32(len(name)))
+	data = append(data, name...)
+	data = binary.BigEndian.AppendUint16(data, 1)
+	data = binary.BigEndian.AppendUint16(data, infoBlockSize)
+	c.sendOption(optGo, data)
+
+	var size uint64
+	for {
+		replyType, data := c.readOptionReply(optGo)
+		switch replyType {
+		case repAck:
+			return size, 0
+		case repInfo:
+			if binary.BigEndian.Uint16(data) == infoExport {
+				size = binary.BigEndian.Uint64(data[2:])
+				flags := binary.BigEndian.Uint16(data[10:])
+				assert.NotZero(c.t, flags&transFlagReadOnly)
+			}
+		default:
+			return 0, replyType
+		}
+	}
+}
+
+func (c *testClient) request(cmd uint16, cookie, offset uint64, length uint32, data []byte) ([]byte, uint32) {
+	c.t.Helper()
+
+	c.write(requestHeader{
+		Magic:  requestMagic,
+		Type:   cmd,
+		Cookie: cookie,
+		Offset: offset,
+		Length: length,
+	}, data)
+
+	var reply simpleReplyHeader
+	c.read(&reply)
+	require.Equal(c.t, simpleReplyMagic, reply.Magic)
+	require.Equal(c.t, cookie, reply.Cookie)
+
+	if reply.Error != 0 || cmd != cmdRead {
+		return nil, reply.Error
+	}
+
+	buf := make([]byte, length)
+	_, err := io.ReadFull(c.conn, buf)
+	require.NoError(c.t, err)
+	return buf, 0
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+
+	content := make([]byte, 3*preferredBlockSize+123)
+	_, _ = rand.Read(content)
+
+	var compressed bytes.Buffer
+	enc, err := zstd.NewWriter(nil)
+	require.NoError(t, err)
+	w, err := seekable.NewWriter(&compressed, enc)
+	require.NoError(t, err)
+	for chunk := range slices.Chunk(content, preferredBlockSize) {
+		_, err = w.Write(chunk)
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "PS3ISO"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "PS3ISO", "game.iso"), content, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "PS3ISO", "packed.zst"), compressed.Bytes(), os.ModePerm))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &Server{
+		Fs: pkgfs.NewFS(pkgfs.NewRelaxedSystemRoot(dir), []pkgfs.FileOpener{seekablezstd.Opener{}}, nil),
+		Exports: map[string]string{
+			"game":   "PS3ISO/game.iso",
+			"packed": "PS3ISO/packed.zst.iso", // decompressed view
+			"dir":    "PS3ISO",
+		},
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { _ = s.Close() })
+
+	t.Run("list", func(t *testing.T) {
+		c := dialTestClient(t, ln.Addr().String())
+		assert.Equal(t, []string{"dir", "game", "packed"}, c.list())
+	})
+
+	t.Run("unknown export", func(t *testing.T) {
+		c := dialTestClient(t, ln.Addr().String())
+
+		_, replyType := c.goExport("missing")
+		assert.Equal(t, repErrUnknown, replyType)
+
+		_, replyType = c.goExport("dir")
+		assert.Equal(t, repErrUnknown, replyType)
+	})
+
+	for _, export := range []string{"game", "packed"} {
+		t.Run(fmt.Sprintf("read %s", export), func(t *testing.T) {
+			c := dialTestClient(t, ln.Addr().String())
+
+			size, replyType := c.goExport(export)
+			require.Zero(t, replyType)
+			require.Equal(t, uint64(len(content)), size)
+
+			data, errCode := c.request(cmdRead, 1, 100, 5000, nil)
+			require.Zero(t, errCode)
+			assert.Equal(t, content[100:5100], data)
+
+			_, errCode = c.request(cmdRead, 2, size-10, 20, nil)
+			assert.Equal(t, errInval, errCode, "read beyond end")
+
+			_, errCode = c.request(cmdWrite, 3, 0, 4, []byte("data"))
+			assert.Equal(t, errPerm, errCode)
+
+			// connection must be still usable
+			data, errCode = c.request(cmdRead, 4, 0, 16, nil)
+			require.Zero(t, errCode)
+			assert.Equal(t, content[:16], data)
+
+			c.write(requestHeader{Magic: requestMagic, Type: cmdDisc})
+		})
+	}
+}
+
+func TestServer_EncryptedUnaligned(t *testing.T) {
+	dir := t.TempDir()
+
+	decrypted, encrypted, key := testutil.EncryptedImage(t, 16)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "PS3ISO"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "PS3ISO", "game.iso"), encrypted, os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "PS3ISO", "game.dkey"), []byte(hex.EncodeToString(key)), os.ModePerm))
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &Server{
+		Fs: pkgfs.NewFS(pkgfs.NewRelaxedSystemRoot(dir), nil, []pkgfs.FileWrapper{
+			encryptediso.FileWrapper{},
+		}),
+		Exports: map[string]string{"game": "PS3ISO/game.iso"},
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { _ = s.Close() })
+
+	c := dialTestClient(t, ln.Addr().String())
+	size, replyType := c.goExport("game")
+	require.Zero(t, replyType)
+	require.Equal(t, uint64(len(decrypted)), size)
+
+	for i, r := range []struct {
+		offset uint64
+		length uint32
+	}{
+		{offset: 2 * 2048, length: 20},
+		{offset: 2*2048 + 100, length: 20},
+		{offset: 512, length: 512},
+		{offset: 3*2048 - 10, length: 4096},
+		{offset: size - 2048 - 1, length: 2048 + 1},
+	} {
+		data, errCode := c.request(cmdRead, uint64(i), r.offset, r.length, nil)
+		require.Zero(t, errCode)
+		assert.Equal(t, decrypted[r.offset:r.offset+uint64(r.length)], data, "offset %d, length %d", r.offset, r.length)
+	}
+
+	c.write(requestHeader{Magic: requestMagic, Type: cmdDisc})
+}
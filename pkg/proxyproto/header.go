@@ -0,0 +1,148 @@
+// Package proxyproto implements receiving side of HAProxy PROXY protocol (versions 1 and 2)
+// to get real client address when server is behind TCP proxy or tunnel.
+// See https://www.haproxy.org/download/2.9/doc/proxy-protocol.txt
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var (
+	v1Prefix    = []byte("PROXY ")
+	v2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+)
+
+const (
+	v1MaxLength = 107 // including CRLF
+
+	v2CmdLocal = 0x0
+	v2CmdProxy = 0x1
+
+	v2FamInet  = 0x1
+	v2FamInet6 = 0x2
+)
+
+// ErrInvalidHeader returned if connection doesn't start with valid PROXY protocol header.
+var ErrInvalidHeader = errors.New("invalid PROXY protocol header")
+
+// ReadHeader reads PROXY protocol header from r without consuming any data after it.
+// It returns source address of proxied connection. Nil address without error returned
+// for connections proxy made on its own (i.e. health checks) or with unknown address family.
+func ReadHeader(r io.Reader) (net.Addr, error) {
+	// 12 bytes fits v2 signature and shortest v1 header prefix
+	var start [12]byte
+	if _, err := io.ReadFull(r, start[:]); err != nil {
+		return nil, fmt.Errorf("read header start: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(start[:], v2Signature):
+		return readV2(r)
+	case bytes.HasPrefix(start[:], v1Prefix):
+		return readV1(r, start[:])
+	default:
+		return nil, ErrInvalidHeader
+	}
+}
+
+func readV1(r io.Reader, start []byte) (net.Addr, error) {
+	line := append(make([]byte, 0, v1MaxLength), start...)
+
+	// read byte by byte to not consume data after header
+	var b [1]byte
+	for !bytes.HasSuffix(line, []byte("\r\n")) {
+		if len(line) >= v1MaxLength {
+			return nil, fmt.Errorf("%w: v1 header too long", ErrInvalidHeader)
+		}
+
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return nil, fmt.Errorf("read v1 header: %w", err)
+		}
+		line = append(line, b[0])
+	}
+
+	fields := strings.Fields(string(line[len(v1Prefix) : len(line)-2]))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("%w: v1 protocol missing", ErrInvalidHeader)
+	}
+
+	switch fields[0] {
+	case "UNKNOWN":
+		return nil, nil
+	case "TCP4", "TCP6":
+	default:
+		return nil, fmt.Errorf("%w: unsupported v1 protocol %q", ErrInvalidHeader, fields[0])
+	}
+
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: malformed v1 header", ErrInvalidHeader)
+	}
+
+	ip := net.ParseIP(fields[1])
+	if ip == nil || (fields[0] == "TCP4") != (ip.To4() != nil) {
+		return nil, fmt.Errorf("%w: invalid v1 source address %q", ErrInvalidHeader, fields[1])
+	}
+
+	port, err := strconv.ParseUint(fields[3], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid v1 source port %q", ErrInvalidHeader, fields[3])
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
+
+func readV2(r io.Reader) (net.Addr, error) {
+	var hdr struct {
+		VerCmd uint8
+		Fam    uint8
+		Len    uint16
+	}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, fmt.Errorf("read v2 header: %w", err)
+	}
+
+	if hdr.VerCmd>>4 != 2 {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidHeader, hdr.VerCmd>>4)
+	}
+
+	// addresses and TLVs must be consumed anyway
+	payload := make([]byte, hdr.Len)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("read v2 addresses: %w", err)
+	}
+
+	switch hdr.VerCmd & 0xf {
+	case v2CmdLocal:
+		return nil, nil
+	case v2CmdProxy:
+	default:
+		return nil, fmt.Errorf("%w: unsupported v2 command %d", ErrInvalidHeader, hdr.VerCmd&0xf)
+	}
+
+	var ipLen int
+	switch hdr.Fam >> 4 {
+	case v2FamInet:
+		ipLen = net.IPv4len
+	case v2FamInet6:
+		ipLen = net.IPv6len
+	default:
+		return nil, nil // i.e. unix sockets, address is meaningless for us
+	}
+
+	// source address, destination address, source port, destination port
+	if len(payload) < 2*ipLen+4 {
+		return nil, fmt.Errorf("%w: v2 addresses too short", ErrInvalidHeader)
+	}
+
+	return &net.TCPAddr{
+		IP:   net.IP(bytes.Clone(payload[:ipLen])),
+		Port: int(binary.BigEndian.Uint16(payload[2*ipLen:])),
+	}, nil
+}
@@ -0,0 +1,164 @@
+package proxyproto
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+	"github.com/xakep666/ps3netsrv-go/pkg/iprange"
+)
+
+// DefaultHeaderTimeout is a default time limit to receive PROXY header.
+const DefaultHeaderTimeout = 10 * time.Second
+
+// Listener reads PROXY protocol header from connections made by trusted proxies.
+// Real client address is reported by RemoteAddr of accepted connection. Connections from other sources
+// are passed as-is. Trusted proxy must send header, otherwise connection is dropped.
+// Headers are read in background, so slow proxy doesn't block accepting other connections.
+// Because of that connections are accepted from underlying listener without waiting for Accept call,
+// so limit of simultaneous connections must be applied to underlying listener.
+type Listener struct {
+	net.Listener
+
+	trusted []iprange.IPRange
+	timeout time.Duration
+	logger  *slog.Logger
+
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// NewListener starts accepting connections on provided listener. Zero timeout means DefaultHeaderTimeout.
+func NewListener(ln net.Listener, trusted []iprange.IPRange, timeout time.Duration, logger *slog.Logger) *Listener {
+	if timeout <= 0 {
+		timeout = DefaultHeaderTimeout
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	l := &Listener{
+		Listener: ln,
+		trusted:  trusted,
+		timeout:  timeout,
+		logger:   logger,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+
+	go l.acceptLoop()
+
+	return l
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+func (l *Listener) Close() error {
+	err := l.Listener.Close()
+	l.stop(net.ErrClosed)
+	return err
+}
+
+func (l *Listener) stop(err error) {
+	l.closeOnce.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
+
+func (l *Listener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue // temporary
+			}
+
+			l.stop(err)
+			return
+		}
+
+		go l.handle(conn)
+	}
+}
+
+func (l *Listener) isTrusted(addr net.Addr) bool {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for i := range l.trusted {
+		if l.trusted[i].Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *Listener) handle(conn net.Conn) {
+	if l.isTrusted(conn.RemoteAddr()) {
+		var err error
+		conn, err = l.readHeader(conn)
+		if err != nil {
+			l.logger.Warn("PROXY header read failed",
+				logutil.StringerAttr("proxy", conn.RemoteAddr()), logutil.ErrorAttr(err))
+			_ = conn.Close()
+			return
+		}
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+func (l *Listener) readHeader(conn net.Conn) (net.Conn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(l.timeout)); err != nil {
+		return conn, err
+	}
+
+	addr, err := ReadHeader(conn)
+	if err != nil {
+		return conn, err
+	}
+
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return conn, err
+	}
+
+	if addr == nil {
+		return conn, nil // proxy's own connection
+	}
+
+	l.logger.Debug("PROXY header received",
+		logutil.StringerAttr("proxy", conn.RemoteAddr()), logutil.StringerAttr("client", addr))
+
+	return &proxiedConn{Conn: conn, remoteAddr: addr}, nil
+}
+
+type proxiedConn struct {
+	net.Conn
+
+	remoteAddr net.Addr
+}
+
+func (c *proxiedConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
@@ -0,0 +1,199 @@
+package proxyproto_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/netutil"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/iprange"
+	"github.com/xakep666/ps3netsrv-go/pkg/proxyproto"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	require.NoError(t, err)
+	return b
+}
+
+func TestReadHeader(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		header   []byte
+		expected string
+		err      bool
+	}{
+		{name: "v1 tcp4", header: []byte("PROXY TCP4 192.168.0.10 10.0.0.1 50123 38008\r\n"), expected: "192.168.0.10:50123"},
+		{name: "v1 tcp6", header: []byte("PROXY TCP6 2001:db8::1 2001:db8::2 50123 38008\r\n"), expected: "[2001:db8::1]:50123"},
+		{name: "v1 unknown", header: []byte("PROXY UNKNOWN\r\n")},
+		{name: "v1 family mismatch", header: []byte("PROXY TCP4 2001:db8::1 2001:db8::2 50123 38008\r\n"), err: true},
+		{name: "v1 no crlf", header: append([]byte("PROXY TCP4 "), bytes.Repeat([]byte("1"), 200)...), err: true},
+		{
+			name: "v2 tcp4",
+			// signature, v2 PROXY, TCP over IPv4, 12 bytes of addresses, 192.168.0.10:50123 -> 10.0.0.1:38008
+			header:   mustHex(t, "0d0a0d0a000d0a515549540a"+"21"+"11"+"000c"+"c0a8000a"+"0a000001"+"c3cb"+"9478"),
+			expected: "192.168.0.10:50123",
+		},
+		{
+			name: "v2 tcp6 with tlv",
+			header: mustHex(t, "0d0a0d0a000d0a515549540a"+"21"+"21"+"0027"+
+				"20010db8000000000000000000000001"+"20010db8000000000000000000000002"+"c3cb"+"9478"+"040000"),
+			expected: "[2001:db8::1]:50123",
+		},
+		{name: "v2 local", header: mustHex(t, "0d0a0d0a000d0a515549540a"+"20"+"00"+"0000")},
+		{name: "v2 bad version", header: mustHex(t, "0d0a0d0a000d0a515549540a"+"11"+"11"+"0000"), err: true},
+		{name: "no header", header: []byte("\x12\x24some netiso command"), err: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := bytes.NewReader(append(tc.header, "data"...))
+
+			addr, err := proxyproto.ReadHeader(r)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if tc.expected == "" {
+				assert.Nil(t, addr)
+			} else {
+				require.NotNil(t, addr)
+				assert.Equal(t, tc.expected, addr.String())
+			}
+
+			rest, _ := io.ReadAll(r)
+			assert.Equal(t, "data", string(rest), "data after header must not be consumed")
+		})
+	}
+}
+
+func TestListener(t *testing.T) {
+	listen := func(t *testing.T, trusted string) net.Listener {
+		t.Helper()
+
+		r, err := iprange.ParseIPRange(trusted)
+		require.NoError(t, err)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		pl := proxyproto.NewListener(ln, []iprange.IPRange{*r}, 0, nil)
+		t.Cleanup(func() { _ = pl.Close() })
+
+		return pl
+	}
+
+	dial := func(t *testing.T, ln net.Listener, data string) net.Conn {
+		t.Helper()
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+
+		_, err = io.WriteString(conn, data)
+		require.NoError(t, err)
+
+		return conn
+	}
+
+	t.Run("trusted", func(t *testing.T) {
+		ln := listen(t, "127.0.0.0/8")
+
+		// stalled proxy must not block others
+		dial(t, ln, "PROXY TCP4 ")
+		dial(t, ln, "PROXY TCP4 192.168.0.10 10.0.0.1 50123 38008\r\nhello")
+
+		conn, err := ln.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		assert.Equal(t, "192.168.0.10:50123", conn.RemoteAddr().String())
+
+		buf := make([]byte, 5)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(buf))
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		ln := listen(t, "10.0.0.0/8")
+
+		client := dial(t, ln, "PROXY TCP4 192.168.0.10 10.0.0.1 50123 38008\r\n")
+
+		conn, err := ln.Accept()
+		require.NoError(t, err)
+		defer conn.Close()
+
+		assert.Equal(t, client.LocalAddr().String(), conn.RemoteAddr().String(), "header must be ignored")
+	})
+
+	t.Run("limited", func(t *testing.T) {
+		r, err := iprange.ParseIPRange("127.0.0.0/8")
+		require.NoError(t, err)
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		const maxClients = 2
+
+		pl := proxyproto.NewListener(netutil.LimitListener(ln, maxClients), []iprange.IPRange{*r}, 0, nil)
+		t.Cleanup(func() { _ = pl.Close() })
+
+		// stalled proxy holds slot too
+		dial(t, pl, "PROXY TCP4 ")
+		for range maxClients {
+			dial(t, pl, "PROXY TCP4 192.168.0.10 10.0.0.1 50123 38008\r\n")
+		}
+
+		accepted := make(chan net.Conn, maxClients)
+		go func() {
+			for {
+				conn, err := pl.Accept()
+				if err != nil {
+					return
+				}
+				accepted <- conn
+			}
+		}()
+
+		var first net.Conn
+		select {
+		case first = <-accepted:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "connection not accepted")
+		}
+		defer first.Close()
+
+		select {
+		case conn := <-accepted:
+			_ = conn.Close()
+			require.FailNow(t, "connection accepted over limit")
+		case <-time.After(200 * time.Millisecond):
+		}
+
+		// closing accepted connection frees slot for waiting one
+		require.NoError(t, first.Close())
+
+		select {
+		case conn := <-accepted:
+			_ = conn.Close()
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "connection not accepted after slot release")
+		}
+	})
+
+	t.Run("close", func(t *testing.T) {
+		ln := listen(t, "127.0.0.1")
+		require.NoError(t, ln.Close())
+
+		_, err := ln.Accept()
+		assert.ErrorIs(t, err, net.ErrClosed)
+	})
+}
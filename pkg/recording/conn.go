@@ -0,0 +1,156 @@
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+)
+
+// Conn records traffic passing through underlying connection.
+// Recording is written to provided writer which is closed with connection.
+type Conn struct {
+	net.Conn
+
+	mu     sync.Mutex
+	dec    *decoder
+	out    io.WriteCloser
+	failed bool
+	logger *slog.Logger
+
+	closeOnce sync.Once
+}
+
+// NewConn makes recording connection. If hashPayloads is true, SHA-256 hashes of transferred file data are recorded.
+func NewConn(conn net.Conn, out io.WriteCloser, hashPayloads bool, logger *slog.Logger) *Conn {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	c := &Conn{
+		Conn:   conn,
+		out:    out,
+		logger: logger,
+	}
+
+	enc := json.NewEncoder(out)
+	c.dec = newDecoder(hashPayloads, func(entry Entry) error {
+		return enc.Encode(entry)
+	})
+
+	return c
+}
+
+func (c *Conn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.mu.Lock()
+		if !c.failed {
+			c.fail(c.dec.request(p[:n]))
+		}
+		c.mu.Unlock()
+	}
+
+	return n, err
+}
+
+func (c *Conn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.mu.Lock()
+		if !c.failed {
+			c.dec.response(p[:n])
+		}
+		c.mu.Unlock()
+	}
+
+	return n, err
+}
+
+// Close closes connection and flushes last recorded command.
+func (c *Conn) Close() error {
+	err := c.Conn.Close()
+
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if !c.failed {
+			c.fail(c.dec.flush())
+		}
+		if closeErr := c.out.Close(); closeErr != nil {
+			c.logger.Warn("Recording close failed", logutil.ErrorAttr(closeErr))
+		}
+	})
+
+	return err
+}
+
+// fail disables recording on error. Client session is not affected.
+func (c *Conn) fail(err error) {
+	if err == nil {
+		return
+	}
+
+	c.failed = true
+	c.logger.Warn("Recording failed, it's disabled for this session",
+		logutil.StringerAttr("remote", c.Conn.RemoteAddr()), logutil.ErrorAttr(err))
+}
+
+// Listener records every accepted connection to a separate file in Dir.
+// Files are named by session start time and client address.
+type Listener struct {
+	net.Listener
+
+	Dir          string
+	HashPayloads bool
+	Logger       *slog.Logger
+}
+
+func (l *Listener) logger() *slog.Logger {
+	if l.Logger != nil {
+		return l.Logger
+	}
+	return slog.Default()
+}
+
+func (l *Listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s_%s.jsonl", time.Now().UTC().Format("20060102T150405.000000Z"), fileNameAddr(conn.RemoteAddr()))
+	out, err := os.OpenFile(filepath.Join(l.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		// don't break serving because of recording
+		l.logger().Warn("Recording file create failed", logutil.ErrorAttr(err))
+		return conn, nil
+	}
+
+	return NewConn(conn, out, l.HashPayloads, l.logger()), nil
+}
+
+// fileNameAddr makes address suitable for file name on any OS.
+func fileNameAddr(addr net.Addr) string {
+	if addr == nil {
+		return "unknown"
+	}
+
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ':', '[', ']', '/', '\\', '@', '%':
+			return '_'
+		default:
+			return r
+		}
+	}, addr.String())
+}
@@ -0,0 +1,275 @@
+package recording
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/proto"
+)
+
+// decoder reconstructs entries from raw session traffic.
+// Protocol is strictly request-response, so entry is complete when next command arrives or session ends.
+type decoder struct {
+	hashPayloads bool
+	emit         func(Entry) error
+
+	seq int
+	cur *Entry
+
+	// request side
+	cmd      [16]byte
+	cmdLen   int
+	tailLeft int
+	path     []byte
+	isPath   bool
+	reqHash  hash.Hash
+
+	// response side
+	respHash  hash.Hash
+	respBuf   []byte
+	respNeed  int
+	respParse func([]byte)
+}
+
+func newDecoder(hashPayloads bool, emit func(Entry) error) *decoder {
+	return &decoder{
+		hashPayloads: hashPayloads,
+		emit:         emit,
+	}
+}
+
+// request consumes data sent by client.
+func (d *decoder) request(p []byte) error {
+	for len(p) > 0 {
+		if d.tailLeft > 0 {
+			n := min(d.tailLeft, len(p))
+			if d.isPath {
+				d.path = append(d.path, p[:n]...)
+			} else if d.reqHash != nil {
+				d.reqHash.Write(p[:n])
+			}
+			d.tailLeft -= n
+			p = p[n:]
+
+			if d.tailLeft == 0 {
+				d.finishRequest()
+			}
+			continue
+		}
+
+		n := copy(d.cmd[d.cmdLen:], p)
+		d.cmdLen += n
+		p = p[n:]
+
+		if d.cmdLen < len(d.cmd) {
+			continue
+		}
+
+		d.cmdLen = 0
+		if err := d.flush(); err != nil {
+			return err
+		}
+		d.startEntry()
+	}
+
+	return nil
+}
+
+// response consumes data sent by server.
+func (d *decoder) response(p []byte) {
+	if d.cur == nil {
+		return
+	}
+
+	for len(p) > 0 {
+		if d.respParse != nil {
+			n := min(d.respNeed-len(d.respBuf), len(p))
+			d.respBuf = append(d.respBuf, p[:n]...)
+			p = p[n:]
+
+			if len(d.respBuf) == d.respNeed {
+				parse := d.respParse
+				d.respParse = nil
+				parse(d.respBuf)
+			}
+			continue
+		}
+
+		d.cur.Response.PayloadSize += int64(len(p))
+		if d.respHash != nil {
+			d.respHash.Write(p)
+		}
+		p = nil
+	}
+}
+
+// flush emits current entry if any.
+func (d *decoder) flush() error {
+	if d.cur == nil {
+		return nil
+	}
+
+	entry := *d.cur
+	d.cur = nil
+
+	if d.tailLeft == 0 && d.reqHash != nil {
+		entry.Request.PayloadSHA256 = hex.EncodeToString(d.reqHash.Sum(nil))
+	}
+	if d.respHash != nil && entry.Response.PayloadSize > 0 {
+		entry.Response.PayloadSHA256 = hex.EncodeToString(d.respHash.Sum(nil))
+	}
+
+	d.tailLeft = 0
+	d.path = d.path[:0]
+	d.isPath = false
+	d.reqHash = nil
+	d.respHash = nil
+	d.respParse = nil
+
+	return d.emit(entry)
+}
+
+func (d *decoder) startEntry() {
+	opCode := proto.OpCode(binary.BigEndian.Uint16(d.cmd[:]))
+	d.seq++
+	d.cur = &Entry{
+		Seq:    d.seq,
+		Time:   time.Now(),
+		OpCode: opCode,
+		Op:     opCode.String(),
+	}
+
+	if d.hashPayloads {
+		d.respHash = sha256.New()
+	}
+
+	tail := d.cmd[2:]
+	req := &d.cur.Request
+	switch opCode {
+	case proto.CmdOpenDir, proto.CmdStatFile, proto.CmdOpenFile, proto.CmdCreateFile,
+		proto.CmdDeleteFile, proto.CmdMkdir, proto.CmdRmdir, proto.CmdGetDirSize:
+		// all path commands start with path length
+		d.tailLeft = int(binary.BigEndian.Uint16(tail))
+		d.isPath = true
+	case proto.CmdReadFile, proto.CmdReadFileCritical:
+		var cmd proto.ReadFileCommand
+		_, _ = binary.Decode(tail, binary.BigEndian, &cmd)
+		req.BytesToRead, req.Offset = cmd.BytesToRead, cmd.Offset
+	case proto.CmdReadCD2048Critical:
+		var cmd proto.ReadCD2048CriticalCommand
+		_, _ = binary.Decode(tail, binary.BigEndian, &cmd)
+		req.StartSector, req.SectorsToRead = cmd.StartSector, cmd.SectorsToRead
+	case proto.CmdWriteFile:
+		var cmd proto.WriteFileCommand
+		_, _ = binary.Decode(tail, binary.BigEndian, &cmd)
+		req.BytesToWrite = cmd.BytesToWrite
+		d.tailLeft = int(cmd.BytesToWrite)
+		if d.hashPayloads {
+			d.reqHash = sha256.New()
+		}
+	}
+
+	if d.tailLeft == 0 {
+		d.finishRequest()
+	}
+}
+
+// finishRequest prepares response parsing when command with its trailer is fully received.
+func (d *decoder) finishRequest() {
+	if d.isPath {
+		d.cur.Request.Path = string(d.path)
+	}
+
+	resp := &d.cur.Response
+	switch d.cur.OpCode {
+	case proto.CmdOpenDir, proto.CmdCreateFile, proto.CmdDeleteFile, proto.CmdMkdir, proto.CmdRmdir:
+		expectResult(d, func(res proto.OpenDirResult) {
+			resp.Result = int64(res.Result)
+		})
+	case proto.CmdWriteFile:
+		expectResult(d, func(res proto.WriteFileResult) {
+			resp.Result = int64(res.BytesWritten)
+		})
+	case proto.CmdReadFile:
+		expectResult(d, func(res proto.ReadFileResult) {
+			resp.Result = int64(res.BytesRead)
+		})
+	case proto.CmdGetDirSize:
+		expectResult(d, func(res proto.GetDirSizeResult) {
+			resp.Result = res.Size
+		})
+	case proto.CmdOpenFile:
+		expectResult(d, func(res proto.OpenFileResult) {
+			resp.Result, resp.ModTime = res.FileSize, res.ModTime
+		})
+	case proto.CmdStatFile:
+		expectResult(d, func(res proto.StatFileResult) {
+			resp.Result, resp.IsDirectory = res.FileSize, res.IsDirectory
+			resp.ModTime, resp.ChangeTime, resp.AccessTime = res.ModTime, res.ChangeTime, res.AccessTime
+		})
+	case proto.CmdReadDirEntry:
+		expectResult(d, func(res proto.ReadDirEntryResult) {
+			resp.Result, resp.IsDirectory = res.FileSize, res.IsDirectory
+			d.expectName(int(res.FilenameLen))
+		})
+	case proto.CmdReadDirEntryV2:
+		expectResult(d, func(res proto.ReadDirEntryV2Result) {
+			resp.Result, resp.IsDirectory = res.FileSize, res.IsDirectory
+			resp.ModTime, resp.ChangeTime, resp.AccessTime = res.ModTime, res.ChangeTime, res.AccessTime
+			d.expectName(int(res.FilenameLen))
+		})
+	case proto.CmdReadDir:
+		expectResult(d, func(res proto.ReadDirResult) {
+			resp.Result = res.Size
+			d.expectDirEntries(res.Size)
+		})
+	default:
+		// critical reads and unknown commands: everything sent is payload
+	}
+}
+
+// expectResult schedules decoding of fixed-size response structure.
+func expectResult[T any](d *decoder, parse func(T)) {
+	var res T
+	d.expect(binary.Size(res), func(b []byte) {
+		_, _ = binary.Decode(b, binary.BigEndian, &res)
+		parse(res)
+	})
+}
+
+func (d *decoder) expect(n int, parse func([]byte)) {
+	d.respBuf = d.respBuf[:0]
+	d.respNeed = n
+	d.respParse = parse
+}
+
+func (d *decoder) expectName(n int) {
+	if n <= 0 {
+		return
+	}
+
+	d.expect(n, func(b []byte) {
+		d.cur.Response.Name = string(b)
+	})
+}
+
+func (d *decoder) expectDirEntries(left int64) {
+	if left <= 0 {
+		return
+	}
+
+	expectResult(d, func(e proto.DirEntry) {
+		name, _, _ := bytes.Cut(e.Name[:], []byte{0})
+		d.cur.Response.Entries = append(d.cur.Response.Entries, DirEntry{
+			Name:        string(name),
+			FileSize:    e.FileSize,
+			ModTime:     e.ModTime,
+			IsDirectory: e.IsDirectory,
+		})
+		d.expectDirEntries(left - 1)
+	})
+}
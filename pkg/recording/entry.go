@@ -0,0 +1,91 @@
+// Package recording captures decoded NETISO command stream of client sessions and replays it against a server.
+// Recordings are JSON Lines files, one Entry per command. They are useful to reproduce client behavior,
+// i.e. for regression testing of webMAN MOD interaction without a console.
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/proto"
+)
+
+// Entry is a single recorded command with its response.
+type Entry struct {
+	// Seq is a sequence number of command in session starting from 1.
+	Seq int `json:"seq"`
+
+	// Time is a moment when command was received.
+	Time time.Time `json:"time"`
+
+	OpCode proto.OpCode `json:"opcode"`
+
+	// Op is a human-readable name of OpCode.
+	Op string `json:"op"`
+
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request contains decoded command parameters.
+type Request struct {
+	Path          string `json:"path,omitempty"`
+	BytesToRead   uint32 `json:"bytes_to_read,omitempty"`
+	Offset        uint64 `json:"offset,omitempty"`
+	StartSector   uint32 `json:"start_sector,omitempty"`
+	SectorsToRead uint32 `json:"sectors_to_read,omitempty"`
+	BytesToWrite  uint32 `json:"bytes_to_write,omitempty"`
+
+	// PayloadSHA256 is a hash of data sent with CmdWriteFile. Only filled if payload hashing is enabled.
+	PayloadSHA256 string `json:"payload_sha256,omitempty"`
+}
+
+// Response contains decoded response header.
+type Response struct {
+	// Result holds main value of response header: operation result, file or directory size,
+	// number of bytes read or written depending on command.
+	Result int64 `json:"result"`
+
+	ModTime     uint64     `json:"mod_time,omitempty"`
+	ChangeTime  uint64     `json:"change_time,omitempty"`
+	AccessTime  uint64     `json:"access_time,omitempty"`
+	IsDirectory bool       `json:"is_directory,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Entries     []DirEntry `json:"entries,omitempty"`
+
+	// PayloadSize is a number of file data bytes sent after response header.
+	PayloadSize int64 `json:"payload_size,omitempty"`
+
+	// PayloadSHA256 is a hash of file data sent after response header. Only filled if payload hashing is enabled.
+	PayloadSHA256 string `json:"payload_sha256,omitempty"`
+}
+
+// DirEntry is a decoded entry of CmdReadDir response.
+type DirEntry struct {
+	Name        string `json:"name"`
+	FileSize    int64  `json:"file_size"`
+	ModTime     uint64 `json:"mod_time"`
+	IsDirectory bool   `json:"is_directory"`
+}
+
+// ReadEntries reads all entries from recording.
+func ReadEntries(r io.Reader) ([]Entry, error) {
+	dec := json.NewDecoder(r)
+
+	var entries []Entry
+	for {
+		var entry Entry
+		err := dec.Decode(&entry)
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("decode entry %d: %w", len(entries)+1, err)
+		}
+
+		entries = append(entries, entry)
+	}
+}
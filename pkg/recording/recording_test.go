@@ -0,0 +1,149 @@
+package recording_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/ioutil"
+	"github.com/xakep666/ps3netsrv-go/pkg/client"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/proto"
+	"github.com/xakep666/ps3netsrv-go/pkg/recording"
+	"github.com/xakep666/ps3netsrv-go/pkg/server"
+)
+
+func startServer(t *testing.T, root, recordDir string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &server.Server[handler.State]{
+		Handler: &handler.Handler{
+			Fs:         pkgfs.NewFS(pkgfs.NewRelaxedSystemRoot(root), nil, nil),
+			Copier:     ioutil.NewCopier(),
+			AllowWrite: true,
+		},
+		Logger: slog.Default(),
+	}
+
+	var socket net.Listener = ln
+	if recordDir != "" {
+		socket = &recording.Listener{Listener: ln, Dir: recordDir, HashPayloads: true}
+	}
+	go s.Serve(socket)
+	t.Cleanup(func() { _ = s.Close() })
+
+	return ln.Addr().String()
+}
+
+func readRecording(dir string) []recording.Entry {
+	files, err := os.ReadDir(dir)
+	if err != nil || len(files) != 1 {
+		return nil
+	}
+
+	f, err := os.Open(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	entries, _ := recording.ReadEntries(f)
+	return entries
+}
+
+func TestRecordReplay(t *testing.T) {
+	root, recordDir := t.TempDir(), t.TempDir()
+
+	content := make([]byte, 10000)
+	_, _ = rand.Read(content)
+
+	require.NoError(t, os.Mkdir(filepath.Join(root, "PS3ISO"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "PS3ISO", "game.iso"), content, os.ModePerm))
+
+	addr := startServer(t, root, recordDir)
+	ctx := context.Background()
+
+	c, err := client.NewClient(ctx, ioutil.NewCopier(), addr)
+	require.NoError(t, err)
+
+	require.NoError(t, c.OpenDir(ctx, "/PS3ISO"))
+	_, err = c.ReadDir(ctx)
+	require.NoError(t, err)
+	_, err = c.StatFile(ctx, "/PS3ISO/missing.iso")
+	require.ErrorIs(t, err, client.ErrUnsuccessfulResponse)
+	_, err = c.OpenFile(ctx, "/PS3ISO/game.iso")
+	require.NoError(t, err)
+	require.NoError(t, c.ReadFileCritical(ctx, 2048, 100, io.Discard))
+	require.NoError(t, c.ReadFile(ctx, 4096, 8000, io.Discard))
+	require.NoError(t, c.MkDir(ctx, "/GAMES"))
+	require.NoError(t, c.CreateFile(ctx, "/GAMES/data.bin"))
+	require.NoError(t, c.WriteFile(ctx, 512, bytes.NewReader(make([]byte, 100))))
+	require.NoError(t, c.Close())
+
+	// last entry is written when server closes connection
+	var entries []recording.Entry
+	require.Eventually(t, func() bool {
+		entries = readRecording(recordDir)
+		return len(entries) == 9
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, proto.CmdOpenDir, entries[0].OpCode)
+	assert.Equal(t, "/PS3ISO", entries[0].Request.Path)
+	assert.Equal(t, []recording.DirEntry{{
+		Name:     "game.iso",
+		FileSize: int64(len(content)),
+		ModTime:  entries[1].Response.Entries[0].ModTime,
+	}}, entries[1].Response.Entries)
+	assert.Equal(t, int64(-1), entries[2].Response.Result)
+	assert.Equal(t, int64(len(content)), entries[3].Response.Result)
+	assert.Equal(t, int64(2048), entries[4].Response.PayloadSize)
+	assert.NotEmpty(t, entries[4].Response.PayloadSHA256)
+	assert.Equal(t, int64(len(content)-8000), entries[5].Response.Result)
+	assert.Equal(t, uint32(100), entries[8].Request.BytesToWrite)
+	assert.Equal(t, int64(100), entries[8].Response.Result)
+
+	// replay against server with the same content
+	replayRoot := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(replayRoot, "PS3ISO"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(replayRoot, "PS3ISO", "game.iso"), content, os.ModePerm))
+
+	replay := func(t *testing.T) []recording.Mismatch {
+		c, err := client.NewClient(ctx, ioutil.NewCopier(), startServer(t, replayRoot, ""))
+		require.NoError(t, err)
+		defer c.Close()
+
+		mismatches, err := recording.Replay(ctx, c, entries, recording.ReplayOptions{IgnoreTimes: true})
+		require.NoError(t, err)
+		return mismatches
+	}
+
+	t.Run("same", func(t *testing.T) {
+		assert.Empty(t, replay(t))
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		require.NoError(t, os.RemoveAll(filepath.Join(replayRoot, "GAMES")))
+		content[200] ^= 0xff
+		require.NoError(t, os.WriteFile(filepath.Join(replayRoot, "PS3ISO", "game.iso"), content, os.ModePerm))
+
+		mismatches := replay(t)
+		require.Len(t, mismatches, 1)
+		assert.Equal(t, proto.CmdReadFileCritical, mismatches[0].Entry.OpCode)
+		require.Len(t, mismatches[0].Differences, 1)
+		assert.Equal(t, "payload_sha256", mismatches[0].Differences[0].Field)
+	})
+}
@@ -0,0 +1,234 @@
+package recording
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"reflect"
+	"strconv"
+
+	"github.com/xakep666/ps3netsrv-go/pkg/client"
+	"github.com/xakep666/ps3netsrv-go/pkg/proto"
+)
+
+// ReplayOptions controls comparison of replayed responses.
+type ReplayOptions struct {
+	// IgnoreTimes skips comparison of file times, useful if files were copied or touched after recording.
+	IgnoreTimes bool
+}
+
+// Difference describes mismatched response field.
+type Difference struct {
+	Field    string
+	Expected any
+	Actual   any
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: expected %v, got %v", d.Field, d.Expected, d.Actual)
+}
+
+// Mismatch is a replayed command which response differs from recorded one.
+type Mismatch struct {
+	Entry       Entry
+	Actual      Response
+	Differences []Difference
+}
+
+// Replay sends recorded commands to server in the same order and compares responses with recorded ones.
+// Data for CmdWriteFile is not recorded, so zeroes are sent instead.
+// Payload hashes are compared only if they were recorded. Error is returned if replay can't continue.
+func Replay(ctx context.Context, c *client.Client, entries []Entry, opts ReplayOptions) ([]Mismatch, error) {
+	var mismatches []Mismatch
+	for _, entry := range entries {
+		actual, err := replayEntry(ctx, c, entry)
+		if err != nil {
+			return mismatches, fmt.Errorf("replay #%d (%s): %w", entry.Seq, entry.Op, err)
+		}
+
+		if diffs := compareResponses(entry.Response, actual, opts); len(diffs) > 0 {
+			mismatches = append(mismatches, Mismatch{
+				Entry:       entry,
+				Actual:      actual,
+				Differences: diffs,
+			})
+		}
+	}
+
+	return mismatches, nil
+}
+
+// payloadWriter counts and optionally hashes received file data.
+type payloadWriter struct {
+	size int64
+	hash hash.Hash
+}
+
+func newPayloadWriter(expected Response) *payloadWriter {
+	w := &payloadWriter{}
+	if expected.PayloadSHA256 != "" {
+		w.hash = sha256.New()
+	}
+	return w
+}
+
+func (w *payloadWriter) Write(p []byte) (int, error) {
+	w.size += int64(len(p))
+	if w.hash != nil {
+		w.hash.Write(p)
+	}
+	return len(p), nil
+}
+
+func (w *payloadWriter) fill(resp *Response) {
+	resp.PayloadSize = w.size
+	if w.hash != nil && w.size > 0 {
+		resp.PayloadSHA256 = hex.EncodeToString(w.hash.Sum(nil))
+	}
+}
+
+// unsuccessful converts client error about failed operation to response result.
+func unsuccessful(err error, resp *Response, result int64) error {
+	if errors.Is(err, client.ErrUnsuccessfulResponse) {
+		resp.Result = result
+		return nil
+	}
+	return err
+}
+
+func replayEntry(ctx context.Context, c *client.Client, entry Entry) (Response, error) {
+	var (
+		resp Response
+		err  error
+		req  = entry.Request
+	)
+
+	switch entry.OpCode {
+	case proto.CmdOpenDir:
+		err = unsuccessful(c.OpenDir(ctx, req.Path), &resp, -1)
+	case proto.CmdCreateFile:
+		err = unsuccessful(c.CreateFile(ctx, req.Path), &resp, -1)
+	case proto.CmdDeleteFile:
+		err = unsuccessful(c.DeleteFile(ctx, req.Path), &resp, -1)
+	case proto.CmdMkdir:
+		err = unsuccessful(c.MkDir(ctx, req.Path), &resp, -1)
+	case proto.CmdRmdir:
+		err = unsuccessful(c.RmDir(ctx, req.Path), &resp, -1)
+	case proto.CmdGetDirSize:
+		resp.Result, err = c.GetDirSize(ctx, req.Path)
+		err = unsuccessful(err, &resp, resp.Result)
+	case proto.CmdOpenFile:
+		var res proto.OpenFileResult
+		res, err = c.OpenFile(ctx, req.Path)
+		resp.Result, resp.ModTime = res.FileSize, res.ModTime
+		err = unsuccessful(err, &resp, -1)
+	case proto.CmdStatFile:
+		var res *proto.StatFileResult
+		res, err = c.StatFile(ctx, req.Path)
+		if err == nil {
+			resp.Result, resp.IsDirectory = res.FileSize, res.IsDirectory
+			resp.ModTime, resp.ChangeTime, resp.AccessTime = res.ModTime, res.ChangeTime, res.AccessTime
+		}
+		err = unsuccessful(err, &resp, -1)
+	case proto.CmdReadDirEntry:
+		var res client.DirEntry
+		res, err = c.ReadDirEntry(ctx)
+		resp.Result, resp.IsDirectory, resp.Name = res.FileSize, res.IsDirectory, res.Name
+		if errors.Is(err, io.EOF) {
+			resp.Result, err = -1, nil
+		}
+	case proto.CmdReadDirEntryV2:
+		var res client.DirEntryV2
+		res, err = c.ReadDirEntryV2(ctx)
+		resp.Result, resp.IsDirectory, resp.Name = res.FileSize, res.IsDirectory, res.Name
+		resp.ModTime, resp.ChangeTime, resp.AccessTime = res.ModTime, res.ChangeTime, res.AccessTime
+		if errors.Is(err, io.EOF) {
+			resp.Result, err = -1, nil
+		}
+	case proto.CmdReadDir:
+		var res []proto.DirEntry
+		res, err = c.ReadDir(ctx)
+		resp.Result = int64(len(res))
+		for _, e := range res {
+			name, _, _ := bytes.Cut(e.Name[:], []byte{0})
+			resp.Entries = append(resp.Entries, DirEntry{
+				Name:        string(name),
+				FileSize:    e.FileSize,
+				ModTime:     e.ModTime,
+				IsDirectory: e.IsDirectory,
+			})
+		}
+	case proto.CmdReadFile:
+		w := newPayloadWriter(entry.Response)
+		err = unsuccessful(c.ReadFile(ctx, req.BytesToRead, req.Offset, w), &resp, 0)
+		w.fill(&resp)
+		if err == nil && w.size > 0 {
+			resp.Result = w.size
+		}
+	case proto.CmdReadFileCritical:
+		w := newPayloadWriter(entry.Response)
+		err = c.ReadFileCritical(ctx, req.BytesToRead, req.Offset, w)
+		w.fill(&resp)
+	case proto.CmdReadCD2048Critical:
+		w := newPayloadWriter(entry.Response)
+		err = c.ReadCD2048Critical(ctx, req.SectorsToRead, req.StartSector, w)
+		w.fill(&resp)
+	case proto.CmdWriteFile:
+		err = c.WriteFile(ctx, req.BytesToWrite, io.LimitReader(zeroReader{}, int64(req.BytesToWrite)))
+		resp.Result = int64(req.BytesToWrite)
+		err = unsuccessful(err, &resp, -1)
+	default:
+		return Response{}, fmt.Errorf("unsupported opcode %s", entry.OpCode)
+	}
+
+	return resp, err
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func compareResponses(expected, actual Response, opts ReplayOptions) []Difference {
+	var diffs []Difference
+	check := func(field string, e, a any) {
+		if !reflect.DeepEqual(e, a) {
+			diffs = append(diffs, Difference{Field: field, Expected: e, Actual: a})
+		}
+	}
+
+	check("result", expected.Result, actual.Result)
+	if !opts.IgnoreTimes {
+		check("mod_time", expected.ModTime, actual.ModTime)
+		check("change_time", expected.ChangeTime, actual.ChangeTime)
+		check("access_time", expected.AccessTime, actual.AccessTime)
+	}
+	check("is_directory", expected.IsDirectory, actual.IsDirectory)
+	check("name", expected.Name, actual.Name)
+
+	check("entries.length", len(expected.Entries), len(actual.Entries))
+	for i := range min(len(expected.Entries), len(actual.Entries)) {
+		e, a := expected.Entries[i], actual.Entries[i]
+		prefix := "entries[" + strconv.Itoa(i) + "]."
+		check(prefix+"name", e.Name, a.Name)
+		check(prefix+"file_size", e.FileSize, a.FileSize)
+		check(prefix+"is_directory", e.IsDirectory, a.IsDirectory)
+		if !opts.IgnoreTimes {
+			check(prefix+"mod_time", e.ModTime, a.ModTime)
+		}
+	}
+
+	check("payload_size", expected.PayloadSize, actual.PayloadSize)
+	if expected.PayloadSHA256 != "" {
+		check("payload_sha256", expected.PayloadSHA256, actual.PayloadSHA256)
+	}
+
+	return diffs
+}
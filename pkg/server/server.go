@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"math/rand/v2"
 	"net"
 	"path"
 	"sync"
@@ -24,6 +25,10 @@ type Server[StateT any] struct {
 	Handler     Handler[StateT]
 	ReadTimeout time.Duration
 
+	// ReadTimeoutFunc optionally overrides ReadTimeout if it may be changed while serving.
+	// It's called before reading every command, so new value applies to already connected clients too.
+	ReadTimeoutFunc func() time.Duration
+
 	// ConnContext optionally specifies a function that modifies
 	// the context used for a new connection c.
 	ConnContext func(ctx context.Context, c net.Conn) context.Context
@@ -34,10 +39,34 @@ type Server[StateT any] struct {
 	inShutdown    atomic.Bool // true when server is in shutdown
 	mu            sync.Mutex
 	listeners     map[*net.Listener]struct{}
-	activeConn    map[*net.Conn]struct{}
+	activeConn    map[*net.Conn]*connState
 	listenerGroup sync.WaitGroup
 }
 
+// connState is a state of served connection guarded by Server.mu.
+type connState struct {
+	idle   bool // waiting for command, no command bytes received yet
+	kicked bool // read deadline was moved to the past by Shutdown to stop waiting for command
+}
+
+// activityReader reports arrival of command data.
+type activityReader struct {
+	io.Reader
+
+	waiting bool // waiting for command
+	onData  func()
+}
+
+func (r *activityReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 && r.waiting {
+		r.waiting = false
+		r.onData()
+	}
+
+	return n, err
+}
+
 func (s *Server[StateT]) Serve(ln net.Listener) error {
 	ln = newOnceCloseListener(ln)
 	defer ln.Close()
@@ -62,11 +91,19 @@ func (s *Server[StateT]) Serve(ln net.Listener) error {
 }
 
 func (s *Server[StateT]) setConnReadDeadline(conn net.Conn) error {
-	if s.ReadTimeout <= 0 {
+	readTimeout := s.ReadTimeout
+	if s.ReadTimeoutFunc != nil {
+		readTimeout = s.ReadTimeoutFunc()
+		if readTimeout <= 0 {
+			return conn.SetReadDeadline(time.Time{}) // timeout may be disabled while serving
+		}
+	}
+
+	if readTimeout <= 0 {
 		return nil
 	}
 
-	return conn.SetReadDeadline(time.Now().Add(s.ReadTimeout))
+	return conn.SetReadDeadline(time.Now().Add(readTimeout))
 }
 
 func (s *Server[StateT]) deriveConnContext(conn net.Conn) context.Context {
@@ -78,12 +115,14 @@ func (s *Server[StateT]) deriveConnContext(conn net.Conn) context.Context {
 }
 
 func (s *Server[StateT]) serveConn(conn net.Conn) {
-	s.trackConn(&conn, true)
-	defer s.trackConn(&conn, false)
+	state := new(connState)
+	s.trackConn(&conn, state, true)
+	defer s.trackConn(&conn, state, false)
 
+	rd := &activityReader{Reader: conn, onData: func() { s.setConnActive(conn, state) }}
 	ctx := &Context[StateT]{
 		RemoteAddr: conn.RemoteAddr(),
-		rd:         proto.Reader{Reader: conn},
+		rd:         proto.Reader{Reader: rd},
 		wr:         proto.Writer{Writer: conn},
 	}
 	ctx.Context, ctx.cancel = context.WithCancel(s.deriveConnContext(conn))
@@ -106,16 +145,28 @@ func (s *Server[StateT]) serveConn(conn net.Conn) {
 	}
 
 	for {
+		if s.shuttingDown() {
+			log.InfoContext(ctx, "Client disconnected: server shutting down")
+			return
+		}
+
 		if err := s.setConnReadDeadline(conn); err != nil {
 			log.ErrorContext(ctx, "Failed to set read deadline", logutil.ErrorAttr(err))
 			return
 		}
 
+		s.setConnIdle(state)
+		rd.waiting = true
 		opCode, err := ctx.rd.ReadCommand()
+		rd.waiting = false
+
 		var netErr net.Error
 		switch {
 		case errors.Is(err, nil):
 			// pass
+		case s.shuttingDown():
+			log.InfoContext(ctx, "Client disconnected: server shutting down")
+			return
 		case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
 			log.InfoContext(ctx, "Client disconnected: connection closed")
 			return
@@ -161,19 +212,38 @@ func (s *Server[StateT]) trackListener(ln *net.Listener, add bool) bool {
 	return true
 }
 
-func (s *Server[StateT]) trackConn(c *net.Conn, add bool) {
+func (s *Server[StateT]) trackConn(c *net.Conn, state *connState, add bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.activeConn == nil {
-		s.activeConn = make(map[*net.Conn]struct{})
+		s.activeConn = make(map[*net.Conn]*connState)
 	}
 	if add {
-		s.activeConn[c] = struct{}{}
+		s.activeConn[c] = state
 	} else {
 		delete(s.activeConn, c)
 	}
 }
 
+func (s *Server[StateT]) setConnIdle(state *connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state.idle = true
+}
+
+// setConnActive marks connection as busy once command data arrives.
+// If Shutdown already kicked connection, read deadline is restored to let command be read and handled.
+func (s *Server[StateT]) setConnActive(conn net.Conn, state *connState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state.idle = false
+	if state.kicked {
+		state.kicked = false
+		_ = conn.SetReadDeadline(time.Time{})
+		_ = s.setConnReadDeadline(conn)
+	}
+}
+
 func (s *Server[StateT]) shuttingDown() bool {
 	return s.inShutdown.Load()
 }
@@ -199,6 +269,75 @@ func (s *Server[StateT]) Close() error {
 	return err
 }
 
+// shutdownPollIntervalMax is the max polling interval when checking
+// quiescence during Server.Shutdown.
+const shutdownPollIntervalMax = 500 * time.Millisecond
+
+// Shutdown gracefully shuts down the server without interrupting clients in the middle of command.
+// It closes all listeners, then closes connections waiting for next command
+// and waits for others to finish current command.
+// If the provided context expires before the shutdown is complete,
+// remaining connections are closed and Shutdown returns the context's error.
+func (s *Server[StateT]) Shutdown(ctx context.Context) error {
+	s.inShutdown.Store(true)
+
+	s.mu.Lock()
+	lnerr := s.closeListenersLocked()
+	s.mu.Unlock()
+	s.listenerGroup.Wait()
+
+	pollIntervalBase := time.Millisecond
+	nextPollInterval := func() time.Duration {
+		// Add 10% jitter.
+		interval := pollIntervalBase + time.Duration(rand.IntN(int(pollIntervalBase/10)))
+		// Double and clamp for next time.
+		pollIntervalBase *= 2
+		if pollIntervalBase > shutdownPollIntervalMax {
+			pollIntervalBase = shutdownPollIntervalMax
+		}
+		return interval
+	}
+
+	timer := time.NewTimer(nextPollInterval())
+	defer timer.Stop()
+	for {
+		if s.closeIdleConns() {
+			return lnerr
+		}
+		select {
+		case <-ctx.Done():
+			s.closeAllConns()
+			return ctx.Err()
+		case <-timer.C:
+			timer.Reset(nextPollInterval())
+		}
+	}
+}
+
+// closeIdleConns stops connections waiting for command and reports whether the server is quiescent.
+// Connections are not closed here because command may be already arriving. Instead, waiting for command
+// is interrupted with read deadline, so connection either exits or reads and handles command (see setConnActive).
+func (s *Server[StateT]) closeIdleConns() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c, state := range s.activeConn {
+		if state.idle && !state.kicked {
+			state.kicked = true
+			_ = (*c).SetReadDeadline(time.Now())
+		}
+	}
+	return len(s.activeConn) == 0
+}
+
+func (s *Server[StateT]) closeAllConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.activeConn {
+		(*c).Close()
+		delete(s.activeConn, c)
+	}
+}
+
 func (s *Server[StateT]) closeListenersLocked() error {
 	var errs []error
 	for ln := range s.listeners {
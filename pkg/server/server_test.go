@@ -0,0 +1,231 @@
+package server_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/ioutil"
+	"github.com/xakep666/ps3netsrv-go/pkg/client"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/server"
+)
+
+// blockingHandler blocks stat requests until released.
+type blockingHandler struct {
+	*handler.Handler
+
+	started chan struct{}
+	release chan struct{}
+}
+
+func (h *blockingHandler) HandleStatFile(ctx *handler.Context, path string) (fs.FileInfo, error) {
+	h.started <- struct{}{}
+	<-h.release
+	return h.Handler.HandleStatFile(ctx, path)
+}
+
+// splitConn sends only the first byte of the first write and the rest after release.
+type splitConn struct {
+	net.Conn
+
+	once    sync.Once
+	sent    chan struct{}
+	release chan struct{}
+}
+
+func (c *splitConn) Write(p []byte) (int, error) {
+	split := false
+	c.once.Do(func() { split = true })
+	if !split || len(p) < 2 {
+		return c.Conn.Write(p)
+	}
+
+	n, err := c.Conn.Write(p[:1])
+	if err != nil {
+		return n, err
+	}
+
+	close(c.sent)
+	<-c.release
+
+	m, err := c.Conn.Write(p[1:])
+	return n + m, err
+}
+
+func TestShutdown(t *testing.T) {
+	start := func(t *testing.T) (*server.Server[handler.State], *blockingHandler, string) {
+		t.Helper()
+
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		root := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0o755))
+
+		h := &blockingHandler{
+			Handler: &handler.Handler{
+				Fs:     pkgfs.NewFS(pkgfs.NewRelaxedSystemRoot(root), nil, nil),
+				Copier: ioutil.NewCopier(),
+			},
+			started: make(chan struct{}),
+			release: make(chan struct{}),
+		}
+		s := &server.Server[handler.State]{Handler: h, Logger: slog.Default()}
+		go s.Serve(ln)
+		t.Cleanup(func() { _ = s.Close() })
+
+		return s, h, ln.Addr().String()
+	}
+
+	connect := func(t *testing.T, addr string) *client.Client {
+		t.Helper()
+
+		c, err := client.NewClient(t.Context(), ioutil.NewCopier(), addr)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = c.Close() })
+
+		return c
+	}
+
+	t.Run("drain", func(t *testing.T) {
+		s, h, addr := start(t)
+
+		idle := connect(t, addr)
+		_, err := idle.GetDirSize(t.Context(), "/dir")
+		require.NoError(t, err, "server must be ready before shutdown")
+		busy := connect(t, addr)
+
+		statErr := make(chan error, 1)
+		go func() {
+			_, err := busy.StatFile(context.Background(), "/dir")
+			statErr <- err
+		}()
+		<-h.started
+
+		shutdownErr := make(chan error, 1)
+		go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+
+		// idle connection is closed while in-flight command is running
+		assert.Eventually(t, func() bool {
+			_, err := idle.GetDirSize(t.Context(), "/dir")
+			return err != nil
+		}, time.Second, 10*time.Millisecond)
+		assert.Empty(t, shutdownErr, "shutdown must wait for in-flight command")
+
+		close(h.release)
+		assert.NoError(t, <-statErr, "in-flight command must finish")
+		assert.NoError(t, <-shutdownErr)
+	})
+
+	t.Run("command arriving", func(t *testing.T) {
+		s, _, addr := start(t)
+
+		conn, err := net.Dial("tcp", addr)
+		require.NoError(t, err)
+		split := &splitConn{Conn: conn, sent: make(chan struct{}), release: make(chan struct{})}
+		c, err := client.NewClientFromConn(ioutil.NewCopier(), split)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = c.Close() })
+
+		cmdErr := make(chan error, 1)
+		go func() {
+			_, err := c.GetDirSize(context.Background(), "/dir")
+			cmdErr <- err
+		}()
+		<-split.sent
+		time.Sleep(50 * time.Millisecond) // let server receive the first byte
+
+		shutdownErr := make(chan error, 1)
+		go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+
+		time.Sleep(50 * time.Millisecond)
+		assert.Empty(t, shutdownErr, "shutdown must wait for command being received")
+
+		close(split.release)
+		assert.NoError(t, <-cmdErr, "command being received must be handled")
+		assert.NoError(t, <-shutdownErr)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		s, h, addr := start(t)
+
+		busy := connect(t, addr)
+
+		statErr := make(chan error, 1)
+		go func() {
+			_, err := busy.StatFile(context.Background(), "/")
+			statErr <- err
+		}()
+		<-h.started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+		close(h.release)
+		assert.Error(t, <-statErr, "connection must be closed when shutdown timed out")
+	})
+}
+
+// failingCloseRoot creates files failing on close like remote roots failing to upload data.
+type failingCloseRoot struct {
+	*pkgfs.RelaxedSystemRoot
+}
+
+type failingCloseFile struct {
+	handler.WritableFile
+}
+
+func (f failingCloseFile) Close() error {
+	_ = f.WritableFile.Close()
+	return errors.New("upload failed")
+}
+
+func (r failingCloseRoot) Create(path string) (handler.WritableFile, error) {
+	f, err := r.RelaxedSystemRoot.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return failingCloseFile{WritableFile: f}, nil
+}
+
+func TestCreateFile_CloseError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "dir"), 0o755))
+
+	s := &server.Server[handler.State]{
+		Handler: &handler.Handler{
+			Fs:         pkgfs.NewFS(failingCloseRoot{pkgfs.NewRelaxedSystemRoot(root)}, nil, nil),
+			Copier:     ioutil.NewCopier(),
+			AllowWrite: true,
+		},
+		Logger: slog.Default(),
+	}
+	go s.Serve(ln)
+	t.Cleanup(func() { _ = s.Close() })
+
+	c, err := client.NewClient(t.Context(), ioutil.NewCopier(), ln.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = c.Close() })
+
+	require.NoError(t, c.CreateFile(t.Context(), "/dir/file.bin"))
+	require.NoError(t, c.WriteFile(t.Context(), 1024, strings.NewReader("data")))
+	assert.ErrorIs(t, c.CreateFile(t.Context(), "/dir"), client.ErrUnsuccessfulResponse, "close failure must be reported")
+}
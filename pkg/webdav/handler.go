@@ -0,0 +1,286 @@
+// Package webdav serves virtual filesystem over HTTP for software that can't speak NETISO protocol, i.e. PC emulators.
+// Files are served with Range requests support. Directories may be listed using simple HTML page or
+// read-only WebDAV (PROPFIND), so share may be mounted as a network drive.
+package webdav
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/xakep666/ps3netsrv-go/internal/handler"
+	"github.com/xakep666/ps3netsrv-go/internal/logutil"
+)
+
+// Handler serves files from provided filesystem. Only read operations are supported.
+type Handler struct {
+	Fs     handler.FS
+	Logger *slog.Logger
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// allowedMethods is a list of supported methods reported in "Allow" header.
+var allowedMethods = []string{http.MethodOptions, http.MethodGet, http.MethodHead, "PROPFIND"}
+
+func (h *Handler) logger() *slog.Logger {
+	if h.Logger != nil {
+		return h.Logger
+	}
+	return slog.Default()
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	urlPath := path.Clean("/" + r.URL.Path)
+	name := filepath.FromSlash(strings.TrimPrefix(urlPath, "/"))
+
+	log := h.logger().With(
+		slog.String("method", r.Method),
+		slog.String("path", urlPath),
+		slog.String("remote_addr", r.RemoteAddr),
+	)
+
+	var err error
+	switch r.Method {
+	case http.MethodOptions:
+		w.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+		w.Header().Set("DAV", "1")
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		log.InfoContext(r.Context(), "HTTP get")
+		err = h.serveGet(w, r, urlPath, name)
+	case "PROPFIND":
+		log.InfoContext(r.Context(), "HTTP propfind", slog.String("depth", r.Header.Get("Depth")))
+		err = h.servePropfind(w, r, urlPath, name)
+	default:
+		w.Header().Set("Allow", strings.Join(allowedMethods, ", "))
+		http.Error(w, "read-only server", http.StatusMethodNotAllowed)
+	}
+
+	if err == nil {
+		return
+	}
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, "not found", http.StatusNotFound)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	default:
+		log.WarnContext(r.Context(), "HTTP request failed", logutil.ErrorAttr(err))
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) serveGet(w http.ResponseWriter, r *http.Request, urlPath, name string) error {
+	f, err := h.Fs.Open(r.Context(), name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+
+	if info.IsDir() {
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, hrefPath(urlPath, true), http.StatusMovedPermanently)
+			return nil
+		}
+
+		return h.serveDirListing(w, r, urlPath, f)
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(info.Name()))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	return nil
+}
+
+// readDir returns information about directory entries. Entries are stat-ed through filesystem,
+// so virtual files produced by openers have proper sizes.
+func (h *Handler) readDir(r *http.Request, dirName string, dir handler.File) ([]fs.FileInfo, error) {
+	entries, err := dir.ReadDir(-1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("readdir: %w", err)
+	}
+
+	infos := make([]fs.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Name() == "." || entry.Name() == ".." {
+			continue
+		}
+
+		info, err := h.Fs.Stat(r.Context(), filepath.Join(dirName, entry.Name()))
+		if err != nil {
+			h.logger().WarnContext(r.Context(), "Stat failed", slog.String("name", entry.Name()), logutil.ErrorAttr(err))
+			continue
+		}
+
+		infos = append(infos, info)
+	}
+
+	slices.SortFunc(infos, func(a, b fs.FileInfo) int {
+		return strings.Compare(a.Name(), b.Name())
+	})
+
+	return infos, nil
+}
+
+func (h *Handler) serveDirListing(w http.ResponseWriter, r *http.Request, urlPath string, dir handler.File) error {
+	infos, err := h.readDir(r, filepath.FromSlash(strings.TrimPrefix(urlPath, "/")), dir)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return nil
+	}
+
+	var sb strings.Builder
+	title := html.EscapeString(hrefPath(urlPath, true))
+	_, _ = fmt.Fprintf(&sb, "<!DOCTYPE html>\n<html><head><title>Index of %s</title></head><body>\n<h1>Index of %s</h1>\n<pre>\n", title, title)
+	if urlPath != "/" {
+		sb.WriteString("<a href=\"../\">../</a>\n")
+	}
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() {
+			name += "/"
+		}
+		href := (&url.URL{Path: name}).EscapedPath()
+		if strings.Contains(name, ":") {
+			href = "./" + href // prevent treating name as scheme
+		}
+		_, _ = fmt.Fprintf(&sb, "<a href=\"%s\">%s</a>\n", html.EscapeString(href), html.EscapeString(name))
+	}
+	sb.WriteString("</pre>\n</body></html>\n")
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+func hrefPath(urlPath string, isDir bool) string {
+	if isDir && !strings.HasSuffix(urlPath, "/") {
+		urlPath += "/"
+	}
+	return (&url.URL{Path: urlPath}).EscapedPath()
+}
+
+type propfindResponse struct {
+	Href     string `xml:"D:href"`
+	Propstat struct {
+		Prop struct {
+			DisplayName      string        `xml:"D:displayname"`
+			ResourceType     *resourceType `xml:"D:resourcetype"`
+			GetContentLength *int64        `xml:"D:getcontentlength,omitempty"`
+			GetContentType   string        `xml:"D:getcontenttype,omitempty"`
+			GetLastModified  string        `xml:"D:getlastmodified,omitempty"`
+		} `xml:"D:prop"`
+		Status string `xml:"D:status"`
+	} `xml:"D:propstat"`
+}
+
+type resourceType struct {
+	Collection *struct{} `xml:"D:collection,omitempty"`
+}
+
+type multistatus struct {
+	XMLName   xml.Name           `xml:"D:multistatus"`
+	Namespace string             `xml:"xmlns:D,attr"`
+	Responses []propfindResponse `xml:"D:response"`
+}
+
+func makePropfindResponse(href string, info fs.FileInfo) propfindResponse {
+	var resp propfindResponse
+	resp.Href = href
+	resp.Propstat.Status = "HTTP/1.1 200 OK"
+
+	prop := &resp.Propstat.Prop
+	prop.DisplayName = info.Name()
+	prop.ResourceType = &resourceType{}
+	if info.IsDir() {
+		prop.ResourceType.Collection = &struct{}{}
+	} else {
+		size := info.Size()
+		prop.GetContentLength = &size
+		prop.GetContentType = mime.TypeByExtension(filepath.Ext(info.Name()))
+		if prop.GetContentType == "" {
+			prop.GetContentType = "application/octet-stream"
+		}
+	}
+	if modTime := info.ModTime(); !modTime.IsZero() {
+		prop.GetLastModified = modTime.UTC().Format(http.TimeFormat)
+	}
+
+	return resp
+}
+
+// servePropfind responds with all supported properties regardless of requested ones.
+// Only "0" and "1" depths are supported as allowed by RFC 4918.
+func (h *Handler) servePropfind(w http.ResponseWriter, r *http.Request, urlPath, name string) error {
+	depth := r.Header.Get("Depth")
+	if depth != "0" && depth != "1" {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.WriteHeader(http.StatusForbidden)
+		_, err := io.WriteString(w, xml.Header+`<D:error xmlns:D="DAV:"><D:propfind-finite-depth/></D:error>`)
+		return err
+	}
+
+	_, _ = io.Copy(io.Discard, io.LimitReader(r.Body, 1<<20)) // request body is not interpreted
+
+	f, err := h.Fs.Open(r.Context(), name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("stat: %w", err)
+	}
+
+	ms := multistatus{Namespace: "DAV:"}
+	ms.Responses = append(ms.Responses, makePropfindResponse(hrefPath(urlPath, info.IsDir()), info))
+
+	if info.IsDir() && depth == "1" {
+		infos, err := h.readDir(r, name, f)
+		if err != nil {
+			return err
+		}
+
+		for _, childInfo := range infos {
+			ms.Responses = append(ms.Responses,
+				makePropfindResponse(hrefPath(path.Join(urlPath, childInfo.Name()), childInfo.IsDir()), childInfo),
+			)
+		}
+	}
+
+	body, err := xml.Marshal(&ms)
+	if err != nil {
+		return fmt.Errorf("marshal response: %w", err)
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, err = io.WriteString(w, xml.Header+string(body))
+	return err
+}
@@ -0,0 +1,157 @@
+package webdav_test
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/xakep666/ps3netsrv-go/internal/testutil"
+	pkgfs "github.com/xakep666/ps3netsrv-go/pkg/fs"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/encryptediso"
+	"github.com/xakep666/ps3netsrv-go/pkg/fs/httproot"
+	"github.com/xakep666/ps3netsrv-go/pkg/webdav"
+)
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+
+	content := make([]byte, 10000)
+	_, _ = rand.Read(content)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "PS3ISO", "sub dir"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "PS3ISO", "game #1.iso"), content, os.ModePerm))
+
+	srv := httptest.NewServer(&webdav.Handler{
+		Fs: pkgfs.NewFS(pkgfs.NewRelaxedSystemRoot(dir), nil, nil),
+	})
+	t.Cleanup(srv.Close)
+
+	do := func(t *testing.T, method, path string, header http.Header) (*http.Response, []byte) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, srv.URL+path, nil)
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header[k] = v
+		}
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return resp, body
+	}
+
+	t.Run("range", func(t *testing.T) {
+		resp, body := do(t, http.MethodGet, "/PS3ISO/game%20%231.iso", http.Header{"Range": {"bytes=100-199"}})
+		assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		assert.Equal(t, content[100:200], body)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		resp, _ := do(t, http.MethodGet, "/PS3ISO/missing.iso", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("read-only", func(t *testing.T) {
+		resp, _ := do(t, http.MethodPut, "/PS3ISO/new.iso", nil)
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+		resp, _ = do(t, http.MethodDelete, "/PS3ISO/game%20%231.iso", nil)
+		assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+		assert.FileExists(t, filepath.Join(dir, "PS3ISO", "game #1.iso"))
+	})
+
+	t.Run("propfind", func(t *testing.T) {
+		resp, body := do(t, "PROPFIND", "/PS3ISO", http.Header{"Depth": {"1"}})
+		require.Equal(t, http.StatusMultiStatus, resp.StatusCode)
+
+		var ms struct {
+			Responses []struct {
+				Href string `xml:"href"`
+				Prop struct {
+					ResourceType struct {
+						Collection *struct{} `xml:"collection"`
+					} `xml:"resourcetype"`
+					ContentLength int64 `xml:"getcontentlength"`
+				} `xml:"propstat>prop"`
+			} `xml:"response"`
+		}
+		require.NoError(t, xml.Unmarshal(body, &ms))
+		require.Len(t, ms.Responses, 3)
+
+		assert.Equal(t, "/PS3ISO/", ms.Responses[0].Href)
+		assert.NotNil(t, ms.Responses[0].Prop.ResourceType.Collection)
+		assert.Equal(t, "/PS3ISO/game%20%231.iso", ms.Responses[1].Href)
+		assert.Equal(t, int64(len(content)), ms.Responses[1].Prop.ContentLength)
+		assert.Nil(t, ms.Responses[1].Prop.ResourceType.Collection)
+		assert.Equal(t, "/PS3ISO/sub%20dir/", ms.Responses[2].Href)
+
+		resp, _ = do(t, "PROPFIND", "/PS3ISO", http.Header{"Depth": {"infinity"}})
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	})
+
+	t.Run("listing", func(t *testing.T) {
+		resp, body := do(t, http.MethodGet, "/PS3ISO/", nil)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html"))
+		assert.Contains(t, string(body), `href="game%20%231.iso"`)
+
+		// listing must be understandable by http root
+		root, err := httproot.NewSystemRoot(srv.URL, srv.Client(), nil, 4096)
+		require.NoError(t, err)
+
+		d, err := root.Open("PS3ISO")
+		require.NoError(t, err)
+		defer d.Close()
+
+		entries, err := d.ReadDir(-1)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, "game #1.iso", entries[0].Name())
+		assert.Equal(t, "sub dir", entries[1].Name())
+		assert.True(t, entries[1].IsDir())
+	})
+}
+
+func TestHandler_EncryptedRange(t *testing.T) {
+	dir := t.TempDir()
+
+	decrypted, encrypted, key := testutil.EncryptedImage(t, 16)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "PS3ISO"), os.ModePerm))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "PS3ISO", "game.iso"), encrypted, os.ModePerm))
+
+	srv := httptest.NewServer(&webdav.Handler{
+		Fs: pkgfs.NewFS(pkgfs.NewRelaxedSystemRoot(dir), nil, []pkgfs.FileWrapper{
+			encryptediso.FileWrapper{Keys: encryptediso.MapKeySource{"GAME": key}},
+		}),
+	})
+	t.Cleanup(srv.Close)
+
+	for _, r := range [][2]int{{4096, 4115}, {4196, 4215}, {6134, 10239}, {len(decrypted) - 2049, len(decrypted) - 1}} {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/PS3ISO/game.iso", nil)
+		require.NoError(t, err)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", r[0], r[1]))
+
+		resp, err := srv.Client().Do(req)
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		assert.Equal(t, decrypted[r[0]:r[1]+1], body, "range %d-%d", r[0], r[1])
+	}
+}